@@ -17,68 +17,25 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/gin-contrib/sessions"
-	"io"
-	"io/ioutil"
-	"link/cinema/config"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 )
 
-func CallAPI(path, method string, query map[string]string, params map[string]interface{}) ([]byte, error) {
-	client := http.Client{}
-	var body io.Reader
-	queryStr := ""
-	if method == "POST" {
-		jsonParams, _ := json.Marshal(params)
-		body = bytes.NewReader(jsonParams)
-	}
-	if query != nil {
-		prefix := "?"
-		for k, v := range query {
-			queryStr += fmt.Sprintf("%s%s=%s", prefix, k, v)
-			prefix = "&"
-		}
-	}
-
-	req, err := http.NewRequest(method, config.GetAPIConfig().LBDAPIEndpoint+path+queryStr, body)
-	if err != nil {
-		return nil, err
-	}
-
-	timestamp, err := GetServerTime()
-
-	if err != nil {
-		return nil, err
-	}
-
-	nonce := makeNonce(8)
-
-	sig := getSignature(nonce, timestamp, method, path, queryStr, params)
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("service-api-key", config.GetAPIConfig().APIKey)
-	req.Header.Add("signature", sig)
-	req.Header.Add("nonce", nonce)
-	req.Header.Add("timestamp", timestamp)
-
-	resp, err := client.Do(req)
-
-	if err != nil {
-		return nil, err
-	}
-
-	apiResult, err := ioutil.ReadAll(resp.Body)
+// CallAPI calls LBD API through the client carried by ctx.
+func CallAPI(ctx context.Context, path, method string, query url.Values, params map[string]interface{}) ([]byte, error) {
+	return FromContext(ctx).Call(ctx, path, method, query, params)
+}
 
+func parseResponse(path string, resp *http.Response, apiResult []byte) ([]byte, error) {
 	type response struct {
 		ResponseTime  uint64      `json:"responseTime"`
 		StatusCode    int         `json:"statusCode"`
@@ -87,10 +44,10 @@ func CallAPI(path, method string, query map[string]string, params map[string]int
 	}
 
 	unmarshalResult := response{}
-	err = json.Unmarshal(apiResult, &unmarshalResult)
+	err := json.Unmarshal(apiResult, &unmarshalResult)
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("invalid API response, path: %s, response: %s(%d %s)", path, resp.Status, unmarshalResult.StatusCode, unmarshalResult.StatusMessage)
+		return nil, newError(path, resp.StatusCode, unmarshalResult.StatusCode, unmarshalResult.StatusMessage)
 	}
 
 	if err != nil {
@@ -100,91 +57,150 @@ func CallAPI(path, method string, query map[string]string, params map[string]int
 	if unmarshalResult.StatusCode >= 1000 && unmarshalResult.StatusCode <= 1999 {
 		return json.Marshal(unmarshalResult.ResponseData)
 	}
-	return nil, errors.New(fmt.Sprintf("%d: %s", unmarshalResult.StatusCode, unmarshalResult.StatusMessage))
+	return nil, newError(path, resp.StatusCode, unmarshalResult.StatusCode, unmarshalResult.StatusMessage)
+}
+
+const (
+	nonceCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvxwyz0123456789"
+)
+
+// encodeQuery returns the query string sent to LBD, including the leading
+// "?". Keys are sorted and values escaped, and the same string is signed.
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
 }
 
-func makeNonce(length int) string {
-	result := make([]byte, 0)
-	charset := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvxwyz0123456789"
-	for i := 0; i < length; i++ {
-		n := rand.Intn(len(charset))
-		result = append(result, charset[n])
+// Signature returns the base64 HMAC-SHA512 of the signature message, as sent
+// in the signature header. query includes the leading "?" and body is the
+// JSON request body, if any.
+func Signature(secret, nonce, timestamp, method, path, query string, body []byte) (string, error) {
+	msg, err := signatureMessage(nonce, timestamp, method, path, query, body)
+	if err != nil {
+		return "", err
 	}
 
-	return string(result)
+	hash := hmac.New(sha512.New, []byte(secret))
+	hash.Write([]byte(msg))
+
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil)), nil
 }
 
-func getSignature(nonce, timestamp, method, path string, query string, params map[string]interface{}) string {
+// signatureMessage builds the string LBD signs: nonce, timestamp, method,
+// path and query string as sent, followed by the flattened body params
+// sorted by key. The params are read back from the marshaled body so the
+// signed values always match the ones sent.
+func signatureMessage(nonce, timestamp, method, path, query string, body []byte) (string, error) {
 	msg := nonce + timestamp + method + path + query
 	prefix := "?"
 	if len(query) > 0 {
 		prefix = "&"
 	}
 
-	if params != nil {
-		paramMap := make(map[string]string)
-		parseParams(paramMap, "", params)
+	if len(body) == 0 {
+		return msg, nil
+	}
 
-		sortable := make([]string, 0)
+	var params interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil {
+		return "", err
+	}
 
-		for k, _ := range paramMap {
-			sortable = append(sortable, k)
-		}
+	paramMap := make(map[string]string)
+	parseParams(paramMap, "", params)
 
-		sort.Slice(sortable, func(i, j int) bool {
-			return strings.Compare(sortable[i], sortable[j]) < 0
-		})
+	sortable := make([]string, 0)
 
-		for _, k := range sortable {
-			msg += fmt.Sprintf("%s%s=%s", prefix, k, paramMap[k])
-			prefix = "&"
-		}
+	for k := range paramMap {
+		sortable = append(sortable, k)
 	}
 
-	hash := hmac.New(sha512.New, []byte(config.GetAPIConfig().APISecret))
-	hash.Write([]byte(msg))
+	sort.Strings(sortable)
 
-	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	for _, k := range sortable {
+		msg += fmt.Sprintf("%s%s=%s", prefix, k, paramMap[k])
+		prefix = "&"
+	}
+
+	return msg, nil
 }
 
+// parseParams flattens params into dotted keys. Following LBD's signature
+// rules, array values are joined with commas, and an array of objects
+// becomes one key per field whose values are joined in element order, with
+// an empty value for elements lacking the field.
 func parseParams(result map[string]string, key string, params interface{}) {
-	if mp, ok := params.(map[string]interface{}); ok {
-		for k, v := range mp {
-			newKey := fmt.Sprintf("%s.%s", key, k)
-			if len(key) == 0 {
-				newKey = k
+	switch value := params.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			parseParams(result, joinKey(key, k), v)
+		}
+	case []interface{}:
+		if !isObjectArray(value) {
+			values := make([]string, 0, len(value))
+			for _, v := range value {
+				values = append(values, paramString(v))
 			}
-			parseParams(result, newKey, v)
+			result[key] = strings.Join(values, ",")
+			return
 		}
-		return
-	}
 
-	result[key] = fmt.Sprint(params)
+		elements := make([]map[string]string, 0, len(value))
+		fields := make(map[string]bool)
+		for _, v := range value {
+			element := make(map[string]string)
+			parseParams(element, "", v)
+			for field := range element {
+				fields[field] = true
+			}
+			elements = append(elements, element)
+		}
+		for field := range fields {
+			values := make([]string, 0, len(elements))
+			for _, element := range elements {
+				values = append(values, element[field])
+			}
+			result[joinKey(key, field)] = strings.Join(values, ",")
+		}
+	case nil:
+	default:
+		result[key] = paramString(value)
+	}
 }
 
-func GetServerTime() (string, error) {
-	client := http.Client{}
-	req, err := http.NewRequest("GET", config.GetAPIConfig().LBDAPIEndpoint+"/v1/time", nil)
-
-	if err != nil {
-		return "", err
+func joinKey(key, field string) string {
+	if len(key) == 0 {
+		return field
 	}
+	return key + "." + field
+}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("service-api-key", config.GetAPIConfig().APIKey)
-
-	resp, err := client.Do(req)
-
-	if err != nil {
-		return "", err
+func isObjectArray(values []interface{}) bool {
+	for _, v := range values {
+		if _, ok := v.(map[string]interface{}); !ok {
+			return false
+		}
 	}
+	return len(values) > 0
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		return "", err
+func paramString(value interface{}) string {
+	if value == nil {
+		return ""
 	}
+	return fmt.Sprint(value)
+}
+
+// GetServerTime fetches the LBD server time through the client carried by ctx.
+func GetServerTime(ctx context.Context) (string, error) {
+	return FromContext(ctx).GetServerTime(ctx)
+}
 
+func parseServerTime(body []byte) (string, error) {
 	type timeResult struct {
 		ResponseTime uint64 `json:"responseTime"`
 	}
@@ -194,64 +210,4 @@ func GetServerTime() (string, error) {
 		return "", err
 	}
 	return strconv.FormatUint(result.ResponseTime, 10), nil
-
-}
-
-func GetUserProfileFromSession(session sessions.Session) (*UserProfile, error) {
-	profile := &UserProfile{}
-
-	accessTokenI := session.Get("accessToken")
-
-	if accessTokenI == nil {
-		return nil, errors.New("accessToken not found")
-	}
-
-	accessToken, ok := accessTokenI.(string)
-
-	if !ok {
-		return nil, errors.New("invalid accessToken")
-	}
-
-	tokenTypeI := session.Get("tokenType")
-
-	if tokenTypeI == nil {
-		return nil, errors.New("tokenType not found")
-	}
-
-	tokenType, ok := tokenTypeI.(string)
-
-	if !ok {
-		return nil, errors.New("invalid tokenType")
-	}
-
-	client := http.Client{}
-
-	url := fmt.Sprintf("%s/v2/profile", config.GetAPIConfig().LINEAPIEndpoint)
-
-	req, _ := http.NewRequest("GET", url, nil)
-
-	req.Header.Set("Authorization", fmt.Sprintf("%s %s", tokenType, accessToken))
-
-	resp, err := client.Do(req)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("%d: %s", resp.StatusCode, resp.Status)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if err := json.Unmarshal(body, profile); err != nil {
-		return nil, err
-	}
-
-	return profile, nil
-
 }
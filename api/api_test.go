@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestEncodeQuery(t *testing.T) {
+	query := url.Values{
+		"orderBy": {"desc"},
+		"msgType": {"link/MsgSend"},
+		"memo":    {"a&b=c d"},
+		"tokenId": {"1", "2"},
+	}
+
+	expected := "?memo=a%26b%3Dc+d&msgType=link%2FMsgSend&orderBy=desc&tokenId=1&tokenId=2"
+	for i := 0; i < 10; i++ {
+		if result := encodeQuery(query); result != expected {
+			t.Fatal("Unexpected query string", result)
+		}
+	}
+
+	if result := encodeQuery(nil); result != "" {
+		t.Error("Unexpected query string", result)
+	}
+}
+
+func TestSignatureMessage(t *testing.T) {
+	testdata := []struct {
+		query    string
+		body     string
+		expected string
+	}{
+		{"", "", "nonce1581000000000GET/v1/path"},
+		{"?page=1", "", "nonce1581000000000GET/v1/path?page=1"},
+		{"", `{"amount":"10","toUserId":"U1"}`, "nonce1581000000000GET/v1/path?amount=10&toUserId=U1"},
+		{"?requestType=redirectUri", `{"amount":1000000}`, "nonce1581000000000GET/v1/path?requestType=redirectUri&amount=1000000"},
+		{"", `{"meta":{"name":"a b","seat":"M14"}}`, "nonce1581000000000GET/v1/path?meta.name=a b&meta.seat=M14"},
+		{"", `{"tokenIds":["1","2"]}`, "nonce1581000000000GET/v1/path?tokenIds=1,2"},
+		{
+			"",
+			`{"mintList":[{"tokenType":"10000001","name":"NewNFT"},{"tokenType":"10000003","name":"NewNFT2","meta":"New nft 2 meta"}]}`,
+			"nonce1581000000000GET/v1/path?mintList.meta=,New nft 2 meta&mintList.name=NewNFT,NewNFT2&mintList.tokenType=10000001,10000003",
+		},
+		{"", `null`, "nonce1581000000000GET/v1/path"},
+	}
+
+	for _, data := range testdata {
+		result, err := signatureMessage("nonce", "1581000000000", "GET", "/v1/path", data.query, []byte(data.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != data.expected {
+			t.Error("Unexpected signature message", result, data.expected)
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	testdata := []struct {
+		err      *Error
+		target   error
+		expected bool
+	}{
+		{newError("/v1/users/U1", 404, 4040, "Not found"), ErrNotFound, true},
+		{newError("/v1/users/U1", 404, 0, ""), ErrNotFound, true},
+		{newError("/v1/users/U1", 400, 4310, "Insufficient balance"), ErrInsufficientBalance, true},
+		{newError("/v1/users/U1", 401, 4011, "Invalid signature"), ErrInvalidSignature, true},
+		{newError("/v1/users/U1", 401, 0, "Invalid signature"), ErrInvalidSignature, true},
+		{newError("/v1/user-requests/T/commit", 400, 4047, "Session token expired"), ErrSessionTokenExpired, true},
+		{newError("/v1/users/U1", 401, 4013, "Invalid timestamp"), ErrTimestampRejected, true},
+		{newError("/v1/users/U1", 401, 4011, "Invalid signature"), ErrNotFound, false},
+		{newError("/v1/users/U1", 500, 5000, "Internal error"), ErrNotFound, false},
+	}
+
+	for _, data := range testdata {
+		var err error = fmt.Errorf("wrapped: %w", data.err)
+		if errors.Is(err, data.target) != data.expected {
+			t.Error("Unexpected match", data.err, data.target, !data.expected)
+		}
+		if apiErr, ok := AsError(err); !ok || apiErr != data.err {
+			t.Error("Expected to unwrap the API error", err)
+		}
+	}
+
+	if !newError("/v1/users/U1", 503, 0, "").Retryable || newError("/v1/users/U1", 400, 4000, "").Retryable {
+		t.Error("Unexpected retryable flag")
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package api
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	DefaultBreakerPolicy = BreakerPolicy{
+		Threshold: 5,
+		Cooldown:  30 * time.Second,
+	}
+)
+
+// BreakerPolicy opens a breaker after Threshold consecutive server failures
+// and lets a single probe through once Cooldown has passed.
+type BreakerPolicy struct {
+	Threshold int
+	Cooldown  time.Duration
+}
+
+type BreakerState struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+// Breaker fails calls to one endpoint group fast while LBD is degraded.
+type Breaker struct {
+	policy BreakerPolicy
+	clock  Clock
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewBreaker(policy BreakerPolicy, clock Clock) *Breaker {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Breaker{
+		policy: policy,
+		clock:  clock,
+		state:  BreakerClosed,
+	}
+}
+
+// Allow returns ErrCircuitOpen when a call must not be sent. Every allowed
+// call must be followed by Record or Cancel.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.policy.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.policy.Threshold > 0 && b.failures >= b.policy.Threshold) {
+		b.state = BreakerOpen
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// Cancel ends an allowed call which got no result, because its context was
+// done before LBD answered. The breaker stays as it was, and a half-open one
+// lets the next probe through.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := BreakerState{
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		state.OpenedAt = &openedAt
+	}
+	return state
+}
+
+// endpointGroup names the breaker guarding path, e.g. "users" for
+// /v1/users/{userId}/base-coin.
+func endpointGroup(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 1 {
+		return segments[1]
+	}
+	return segments[0]
+}
+
+func (c *Client) breaker(group string) *Breaker {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+
+	breaker, ok := c.breakers[group]
+	if !ok {
+		breaker = NewBreaker(c.breakerPolicy, c.clock)
+		c.breakers[group] = breaker
+	}
+	return breaker
+}
+
+// BreakerStates returns the state of every endpoint group called so far.
+func (c *Client) BreakerStates() map[string]BreakerState {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+
+	states := make(map[string]BreakerState)
+	for group, breaker := range c.breakers {
+		states[group] = breaker.State()
+	}
+	return states
+}
@@ -0,0 +1,376 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"link/cinema/config"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	TransportLive   = ""
+	TransportRecord = "record"
+	TransportReplay = "replay"
+
+	redacted = "REDACTED"
+)
+
+var (
+	ErrNoCassettePath = errors.New("no cassette path")
+
+	// headers carrying credentials or values which change on every request
+	redactedHeaders = []string{"service-api-key", "signature", "nonce", "timestamp", "Authorization"}
+)
+
+// Cassette is a recorded sequence of LBD API traffic. Recorders write it as
+// one interaction per line; a single JSON object of them is read as well.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   string            `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+func (r RecordedRequest) String() string {
+	result := r.Method + " " + r.Path
+	if r.Query != "" {
+		result += "?" + r.Query
+	}
+	if r.Body != "" {
+		result += " " + r.Body
+	}
+	return result
+}
+
+// TransportFromConfig returns the transport selected by LBDTransportMode:
+// live traffic, live traffic recorded to LBDCassettePath, or responses
+// replayed from LBDCassettePath.
+func TransportFromConfig(cfg *config.APIConfig) (http.RoundTripper, error) {
+	switch cfg.LBDTransportMode {
+	case TransportLive:
+		return http.DefaultTransport, nil
+	case TransportRecord:
+		return NewRecorder(cfg.LBDCassettePath, http.DefaultTransport)
+	case TransportReplay:
+		return NewReplayer(cfg.LBDCassettePath)
+	}
+	return nil, fmt.Errorf("unknown LBD transport mode: %s", cfg.LBDTransportMode)
+}
+
+// Recorder is an http.RoundTripper which appends every request and response
+// to a cassette file, with secrets, signatures and nonces redacted.
+type Recorder struct {
+	next http.RoundTripper
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder starts a new cassette at path, replacing the one there.
+func NewRecorder(path string, next http.RoundTripper) (*Recorder, error) {
+	if path == "" {
+		return nil, ErrNoCassettePath
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		next: next,
+		file: file,
+	}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordedReq, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	line, err := json.Marshal(Interaction{
+		Request: recordedReq,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    flattenHeaders(resp.Header),
+			Body:       string(body),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// Replayer is an http.RoundTripper which serves responses from a cassette
+// instead of calling LBD. Requests match on method, path, query and
+// redacted body; identical requests get their recorded responses in order.
+type Replayer struct {
+	mu         sync.Mutex
+	cassette   Cassette
+	used       []bool
+	mismatches []*MismatchError
+}
+
+func NewReplayer(path string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayerFromCassette(data)
+}
+
+func NewReplayerFromCassette(data []byte) (*Replayer, error) {
+	cassette := Cassette{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		value := struct {
+			Cassette
+			Interaction
+		}{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		if value.Interactions != nil {
+			cassette.Interactions = append(cassette.Interactions, value.Interactions...)
+			continue
+		}
+		cassette.Interactions = append(cassette.Interactions, value.Interaction)
+	}
+	return &Replayer{
+		cassette: cassette,
+		used:     make([]bool, len(cassette.Interactions)),
+	}, nil
+}
+
+// MismatchError reports a request with no recorded match, along with the
+// recorded requests to the same method and path.
+type MismatchError struct {
+	Request    RecordedRequest
+	Candidates []RecordedRequest
+}
+
+func (e *MismatchError) Error() string {
+	msg := fmt.Sprintf("no recorded interaction for %s", e.Request)
+	if len(e.Candidates) == 0 {
+		return msg
+	}
+	candidates := make([]string, 0, len(e.Candidates))
+	for _, candidate := range e.Candidates {
+		candidates = append(candidates, candidate.String())
+	}
+	return msg + "; recorded with the same path: " + strings.Join(candidates, ", ")
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordedReq, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last := -1
+	candidates := make([]RecordedRequest, 0)
+	for i, interaction := range r.cassette.Interactions {
+		recorded := interaction.Request
+		if recorded.Method != recordedReq.Method || recorded.Path != recordedReq.Path {
+			continue
+		}
+		if recorded.Query != recordedReq.Query || recorded.Body != recordedReq.Body {
+			candidates = append(candidates, recorded)
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return replayResponse(req, interaction.Response), nil
+		}
+		last = i
+	}
+
+	// every match has been replayed, keep serving the last one
+	if last >= 0 {
+		return replayResponse(req, r.cassette.Interactions[last].Response), nil
+	}
+
+	mismatch := &MismatchError{
+		Request:    recordedReq,
+		Candidates: candidates,
+	}
+	r.mismatches = append(r.mismatches, mismatch)
+	return nil, mismatch
+}
+
+// Mismatches returns every request which had no recorded match so far.
+func (r *Replayer) Mismatches() []*MismatchError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*MismatchError(nil), r.mismatches...)
+}
+
+// Unused returns the recorded requests which have not been replayed.
+func (r *Replayer) Unused() []RecordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unused := make([]RecordedRequest, 0)
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction.Request)
+		}
+	}
+	return unused
+}
+
+func replayResponse(req *http.Request, recorded RecordedResponse) *http.Response {
+	header := make(http.Header)
+	for k, v := range recorded.Headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
+
+// recordRequest captures req with its body restored for sending, and with
+// credentials redacted.
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	body := make([]byte, 0)
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return RecordedRequest{}, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	headers := flattenHeaders(req.Header)
+	for _, key := range redactedHeaders {
+		if _, ok := headers[http.CanonicalHeaderKey(key)]; ok {
+			headers[http.CanonicalHeaderKey(key)] = redacted
+		}
+	}
+
+	return RecordedRequest{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Query:   req.URL.RawQuery,
+		Headers: headers,
+		Body:    redactBody(body),
+	}, nil
+}
+
+// redactBody replaces the values of JSON fields named like secrets, and
+// re-encodes the body with sorted keys so equal bodies compare equal.
+func redactBody(body []byte) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return string(body)
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if strings.Contains(strings.ToLower(key), "secret") {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = redactValue(element)
+		}
+	}
+	return value
+}
+
+func flattenHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for key := range header {
+		headers[key] = header.Get(key)
+	}
+	return headers
+}
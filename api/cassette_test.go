@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"link/cinema/config"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := newTestServer(t, "api-secret", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"responseTime":1581000000000,"statusCode":1002,"statusMessage":"Accepted","responseData":{"txHash":"TX1"}}`))
+	})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "cassette.json")
+
+	cfg := &config.APIConfig{
+		LBDAPIEndpoint: server.URL,
+		APIKey:         "api-key",
+		APISecret:      "api-secret",
+	}
+	params := map[string]interface{}{
+		"walletSecret": "wallet-secret",
+		"toUserId":     "U1",
+		"amount":       "100",
+	}
+
+	if _, err := NewRecorder("", http.DefaultTransport); !errors.Is(err, ErrNoCassettePath) {
+		t.Error("Expected a cassette path to be required", err)
+	}
+	transport, err := NewRecorder(path, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := NewClient(cfg, transport, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := recorder.Call(context.Background(), "/v1/wallets/W1/base-coin/transfer", "POST", nil, params); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := transport.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"api-key", "wallet-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Error("Expected the cassette to be redacted", secret)
+		}
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayCfg := &config.APIConfig{LBDAPIEndpoint: "http://lbd.invalid"}
+	client := NewClient(replayCfg, replayer, nil)
+
+	result, err := client.Call(context.Background(), "/v1/wallets/W1/base-coin/transfer", "POST", nil, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `{"txHash":"TX1"}` {
+		t.Error("Unexpected replayed result", string(result))
+	}
+	if unused := replayer.Unused(); len(unused) != 1 {
+		t.Error("Expected one interaction per recorded request", unused)
+	}
+	if _, err := client.Call(context.Background(), "/v1/wallets/W1/base-coin/transfer", "POST", nil, params); err != nil {
+		t.Fatal(err)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Error("Expected every interaction to be replayed", unused)
+	}
+
+	params["amount"] = "200"
+	_, err = client.Call(context.Background(), "/v1/wallets/W1/base-coin/transfer", "POST", nil, params)
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatal("Expected a mismatch", err)
+	}
+	if len(mismatch.Candidates) != 2 || len(replayer.Mismatches()) != 1 {
+		t.Error("Unexpected mismatch report", mismatch)
+	}
+
+	legacy, err := NewReplayerFromCassette([]byte(`{"interactions":[{"request":{"method":"GET","path":"/v1/time"},"response":{"statusCode":200,"body":"{}"}}]}`))
+	if err != nil || len(legacy.Unused()) != 1 {
+		t.Error("Expected a cassette written as one object to be read", err)
+	}
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"link/cinema/config"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout = 30 * time.Second
+)
+
+// Clock tells a Client what time it is.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var (
+	SystemClock Clock = systemClock{}
+
+	clientMu      sync.Mutex
+	defaultClient *Client
+)
+
+type clientKey struct{}
+
+// Client calls LBD API with the endpoint and keys of its own APIConfig,
+// so several differently-configured clients can live in one process.
+type Client struct {
+	config     *config.APIConfig
+	httpClient *http.Client
+	clock      Clock
+	timeSync   *TimeSync
+
+	retryPolicy   RetryPolicy
+	breakerPolicy BreakerPolicy
+	breakersMu    sync.Mutex
+	breakers      map[string]*Breaker
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+func NewClient(cfg *config.APIConfig, transport http.RoundTripper, clock Clock) *Client {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+	c := &Client{
+		config: cfg,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   DefaultTimeout,
+		},
+		clock:         clock,
+		retryPolicy:   retryPolicyFromConfig(cfg),
+		breakerPolicy: breakerPolicyFromConfig(cfg),
+		breakers:      make(map[string]*Breaker),
+		rand:          rand.New(rand.NewSource(clock.Now().UnixNano())),
+	}
+	c.timeSync = NewTimeSync(c.fetchServerTime, clock, DefaultTimeSyncInterval)
+	return c
+}
+
+func (c *Client) Config() *config.APIConfig {
+	return c.config
+}
+
+func (c *Client) TimeSync() *TimeSync {
+	return c.timeSync
+}
+
+func retryPolicyFromConfig(cfg *config.APIConfig) RetryPolicy {
+	policy := DefaultRetryPolicy
+	if cfg.LBDRetryMaxAttempts > 0 {
+		policy.MaxAttempts = cfg.LBDRetryMaxAttempts
+	}
+	if cfg.LBDRetryBaseDelayMillis > 0 {
+		policy.BaseDelay = time.Duration(cfg.LBDRetryBaseDelayMillis) * time.Millisecond
+	}
+	if cfg.LBDRetryMaxDelayMillis > 0 {
+		policy.MaxDelay = time.Duration(cfg.LBDRetryMaxDelayMillis) * time.Millisecond
+	}
+	return policy
+}
+
+func breakerPolicyFromConfig(cfg *config.APIConfig) BreakerPolicy {
+	policy := DefaultBreakerPolicy
+	if cfg.LBDBreakerThreshold > 0 {
+		policy.Threshold = cfg.LBDBreakerThreshold
+	}
+	if cfg.LBDBreakerCooldownSeconds > 0 {
+		policy.Cooldown = time.Duration(cfg.LBDBreakerCooldownSeconds) * time.Second
+	}
+	return policy
+}
+
+// GetClient returns the client set by SetClient, or a client built from
+// the global APIConfig when none has been set.
+func GetClient() *Client {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if defaultClient == nil {
+		defaultClient = NewClient(config.GetAPIConfig(), nil, nil)
+	}
+	return defaultClient
+}
+
+func SetClient(client *Client) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	defaultClient = client
+}
+
+// NewContext returns a copy of ctx carrying client, which CallAPI uses
+// instead of the default client.
+func NewContext(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// FromContext returns the client carried by ctx, or the default client.
+func FromContext(ctx context.Context) *Client {
+	if client, ok := ctx.Value(clientKey{}).(*Client); ok && client != nil {
+		return client
+	}
+	return GetClient()
+}
+
+// Call signs and sends a request to LBD through the circuit breaker of its
+// endpoint group. Server failures are retried with backoff when the request
+// is idempotent or never reached LBD.
+func (c *Client) Call(ctx context.Context, path, method string, query url.Values, params map[string]interface{}) ([]byte, error) {
+	breaker := c.breaker(endpointGroup(path))
+
+	var lastErr error
+	for attempt := 0; attempt < c.retryPolicy.MaxAttempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return nil, lastErr
+			}
+		}
+		if err := breaker.Allow(); err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, fmt.Errorf("%w, path: %s", err, path)
+		}
+
+		result, err := c.callSynced(ctx, path, method, query, params)
+		if err != nil && ctx.Err() != nil {
+			// LBD did not answer, so the call tells nothing of its health
+			breaker.Cancel()
+			return nil, err
+		}
+		breaker.Record(isServerFailure(ctx, err))
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		if !isRetryable(ctx, method, err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// callSynced sends a request once. When LBD rejects the signing timestamp,
+// the server time is resynced and the request is sent once more.
+func (c *Client) callSynced(ctx context.Context, path, method string, query url.Values, params map[string]interface{}) ([]byte, error) {
+	result, err := c.call(ctx, path, method, query, params)
+	if errors.Is(err, ErrTimestampRejected) {
+		if err := c.timeSync.Resync(ctx); err != nil {
+			return nil, err
+		}
+		return c.call(ctx, path, method, query, params)
+	}
+	return result, err
+}
+
+func (c *Client) call(ctx context.Context, path, method string, query url.Values, params map[string]interface{}) ([]byte, error) {
+	var (
+		body       io.Reader
+		jsonParams []byte
+		err        error
+	)
+	if method == "POST" || method == "PUT" {
+		jsonParams, err = json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(jsonParams)
+	}
+	queryStr := encodeQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, c.config.LBDAPIEndpoint+path+queryStr, body)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := c.timeSync.Timestamp(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := c.makeNonce(8)
+
+	sig, err := Signature(c.config.APISecret.Reveal(), nonce, timestamp, method, path, queryStr, jsonParams)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("service-api-key", c.config.APIKey)
+	req.Header.Add("signature", sig)
+	req.Header.Add("nonce", nonce)
+	req.Header.Add("timestamp", timestamp)
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	apiResult, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseResponse(path, resp, apiResult)
+}
+
+// GetServerTime fetches the current LBD server time in milliseconds.
+func (c *Client) GetServerTime(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.config.LBDAPIEndpoint+"/v1/time", nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("service-api-key", c.config.APIKey)
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	return parseServerTime(body)
+}
+
+func (c *Client) fetchServerTime(ctx context.Context) (time.Time, error) {
+	serverTime, err := c.GetServerTime(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	millis, err := strconv.ParseInt(serverTime, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), nil
+}
+
+func (c *Client) makeNonce(length int) string {
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+
+	result := make([]byte, 0)
+	for i := 0; i < length; i++ {
+		n := c.rand.Intn(len(nonceCharset))
+		result = append(result, nonceCharset[n])
+	}
+
+	return string(result)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"link/cinema/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func newTestServer(t *testing.T, secret string, handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/time" {
+			w.Write([]byte(`{"responseTime":1581000000000,"statusCode":1000,"statusMessage":"Success"}`))
+			return
+		}
+		query := ""
+		if r.URL.RawQuery != "" {
+			query = "?" + r.URL.RawQuery
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		expected, err := Signature(secret, r.Header.Get("nonce"), r.Header.Get("timestamp"), r.Method, r.URL.Path, query, body)
+		if err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get("signature") != expected {
+			t.Error("Unexpected signature", r.Header.Get("signature"), expected)
+		}
+		handler(w, r)
+	}))
+}
+
+func TestClientCall(t *testing.T) {
+	server := newTestServer(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("service-api-key") != "key" {
+			t.Error("Unexpected api key", r.Header.Get("service-api-key"))
+		}
+		w.Write([]byte(`{"responseTime":1581000000000,"statusCode":1000,"statusMessage":"Success","responseData":{"userId":"U1"}}`))
+	})
+	defer server.Close()
+
+	client := NewClient(&config.APIConfig{
+		LBDAPIEndpoint: server.URL,
+		APIKey:         "key",
+		APISecret:      "secret",
+	}, nil, fixedClock{time.Unix(1581000000, 0)})
+
+	result, err := client.Call(context.Background(), "/v1/users/U1", "GET", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `{"userId":"U1"}` {
+		t.Error("Unexpected result", string(result))
+	}
+}
+
+func TestClientFromContext(t *testing.T) {
+	testnet := NewClient(&config.APIConfig{LBDAPIEndpoint: "https://testnet"}, nil, nil)
+	mainnet := NewClient(&config.APIConfig{LBDAPIEndpoint: "https://mainnet"}, nil, nil)
+	SetClient(testnet)
+	defer SetClient(nil)
+
+	if FromContext(context.Background()) != testnet {
+		t.Error("Expected the default client")
+	}
+	if FromContext(NewContext(context.Background(), mainnet)) != mainnet {
+		t.Error("Expected the client carried by context")
+	}
+}
+
+func TestClientCallCanceled(t *testing.T) {
+	blocked := make(chan struct{})
+	server := newTestServer(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		<-blocked
+	})
+	defer server.Close()
+	defer close(blocked)
+
+	client := NewClient(&config.APIConfig{
+		LBDAPIEndpoint: server.URL,
+		APISecret:      "secret",
+	}, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.Call(ctx, "/v1/users/U1", "GET", nil, nil); err == nil {
+		t.Error("Expected an error for a canceled request")
+	}
+}
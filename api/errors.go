@@ -0,0 +1,97 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// LBD status codes which callers are likely to handle. Codes in 1000-1999
+// mean success.
+const (
+	StatusInvalidSignature    = 4011
+	StatusInvalidTimestamp    = 4013
+	StatusNotFound            = 4040
+	StatusSessionTokenExpired = 4047
+	StatusInsufficientBalance = 4310
+)
+
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrSessionTokenExpired = errors.New("session token expired")
+	ErrTimestampRejected   = errors.New("timestamp rejected")
+)
+
+// Error is a failed LBD API call. It matches the Err* sentinels with
+// errors.Is, by LBD status code or, failing that, by HTTP status and
+// status message.
+type Error struct {
+	HTTPStatus    int    `json:"httpStatus"`
+	StatusCode    int    `json:"statusCode"`
+	StatusMessage string `json:"statusMessage"`
+	Path          string `json:"path"`
+	Retryable     bool   `json:"retryable"`
+}
+
+func newError(path string, httpStatus, statusCode int, statusMessage string) *Error {
+	return &Error{
+		HTTPStatus:    httpStatus,
+		StatusCode:    statusCode,
+		StatusMessage: statusMessage,
+		Path:          path,
+		Retryable: httpStatus >= 500 ||
+			httpStatus == http.StatusTooManyRequests ||
+			httpStatus == http.StatusRequestTimeout,
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid API response, path: %s, response: %d %s(%d %s)", e.Path, e.HTTPStatus, http.StatusText(e.HTTPStatus), e.StatusCode, e.StatusMessage)
+}
+
+func (e *Error) Is(target error) bool {
+	message := strings.ToLower(e.StatusMessage)
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == StatusNotFound || e.HTTPStatus == http.StatusNotFound
+	case ErrInsufficientBalance:
+		return e.StatusCode == StatusInsufficientBalance || strings.Contains(message, "insufficient")
+	case ErrInvalidSignature:
+		return e.StatusCode == StatusInvalidSignature ||
+			(e.HTTPStatus == http.StatusUnauthorized && strings.Contains(message, "signature"))
+	case ErrSessionTokenExpired:
+		return e.StatusCode == StatusSessionTokenExpired ||
+			(strings.Contains(message, "session") && strings.Contains(message, "expired"))
+	case ErrTimestampRejected:
+		return e.StatusCode == StatusInvalidTimestamp ||
+			(e.HTTPStatus == http.StatusUnauthorized && strings.Contains(message, "timestamp"))
+	}
+	return false
+}
+
+// AsError returns the LBD error wrapped in err, if any.
+func AsError(err error) (*Error, bool) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries failed LBD calls. Delays grow
+// exponentially from BaseDelay up to MaxDelay, with full jitter.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var (
+	DefaultRetryPolicy = RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+	}
+)
+
+type idempotentKey struct{}
+
+// WithIdempotent marks the calls made with ctx as safe to send more than
+// once, so failed POSTs are retried like GETs. Use it only when LBD itself
+// refuses to apply the same request twice, e.g. committing a user request
+// session token.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context, method string) bool {
+	if method == "GET" {
+		return true
+	}
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// isServerFailure reports whether err means LBD or the connection to it is
+// unhealthy, as opposed to LBD rejecting the request itself.
+func isServerFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if apiErr, ok := AsError(err); ok {
+		return apiErr.Retryable
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRetryable reports whether a call failing with err may be sent again.
+// Requests that never reached LBD can always be retried.
+func isRetryable(ctx context.Context, method string, err error) bool {
+	if !isServerFailure(ctx, err) {
+		return false
+	}
+	if isIdempotent(ctx, method) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.retryPolicy.BaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > c.retryPolicy.MaxDelay {
+		delay = c.retryPolicy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+	return time.Duration(c.rand.Int63n(int64(delay) + 1))
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"link/cinema/config"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFlakyServer(failures int32, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/time" {
+			w.Write([]byte(`{"responseTime":1581000000000,"statusCode":1000,"statusMessage":"Success"}`))
+			return
+		}
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"responseTime":1581000000000,"statusCode":5030,"statusMessage":"Service unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"responseTime":1581000000000,"statusCode":1000,"statusMessage":"Success","responseData":{}}`))
+	}))
+}
+
+func newRetryTestClient(endpoint string) *Client {
+	return NewClient(&config.APIConfig{
+		LBDAPIEndpoint:          endpoint,
+		LBDRetryMaxAttempts:     3,
+		LBDRetryBaseDelayMillis: 1,
+		LBDRetryMaxDelayMillis:  5,
+		LBDBreakerThreshold:     3,
+	}, nil, nil)
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(2, &calls)
+	defer server.Close()
+
+	client := newRetryTestClient(server.URL)
+	if _, err := client.Call(context.Background(), "/v1/users/U1", "GET", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Error("Expected a GET to be retried until it succeeds", calls)
+	}
+	if state := client.BreakerStates()["users"]; state.State != BreakerClosed || state.Failures != 0 {
+		t.Error("Unexpected breaker state", state)
+	}
+}
+
+func TestClientNoRetryForPost(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(2, &calls)
+	defer server.Close()
+
+	client := newRetryTestClient(server.URL)
+	if _, err := client.Call(context.Background(), "/v1/wallets/W1/base-coin/transfer", "POST", nil, nil); err == nil {
+		t.Error("Expected the POST to fail")
+	}
+	if calls != 1 {
+		t.Error("Expected a POST not to be retried", calls)
+	}
+
+	calls = 0
+	ctx := WithIdempotent(context.Background())
+	if _, err := client.Call(ctx, "/v1/user-requests/T1/commit", "POST", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Error("Expected an idempotent POST to be retried", calls)
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(100, &calls)
+	defer server.Close()
+
+	client := newRetryTestClient(server.URL)
+	if _, err := client.Call(context.Background(), "/v1/users/U1", "GET", nil, nil); err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	if state := client.BreakerStates()["users"]; state.State != BreakerOpen {
+		t.Error("Expected the breaker to open", state)
+	}
+
+	calls = 0
+	_, err := client.Call(context.Background(), "/v1/users/U1", "GET", nil, nil)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Error("Expected to fail fast", err)
+	}
+	if calls != 0 {
+		t.Error("Expected no request while the breaker is open", calls)
+	}
+
+	if _, err := client.Call(context.Background(), "/v1/transactions/TX", "GET", nil, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Error("Expected other endpoint groups to be unaffected")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	breaker := NewBreaker(BreakerPolicy{Threshold: 1, Cooldown: time.Minute}, clock)
+
+	breaker.Allow()
+	breaker.Record(true)
+	if breaker.Allow() != ErrCircuitOpen {
+		t.Fatal("Expected the breaker to be open")
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatal("Expected a probe after the cooldown", err)
+	}
+	if breaker.Allow() != ErrCircuitOpen {
+		t.Error("Expected a single probe at a time")
+	}
+	breaker.Record(false)
+	if state := breaker.State(); state.State != BreakerClosed {
+		t.Error("Expected the breaker to close after a successful probe", state)
+	}
+}
+
+func TestBreakerCancelledProbe(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	breaker := NewBreaker(BreakerPolicy{Threshold: 1, Cooldown: time.Minute}, clock)
+
+	breaker.Allow()
+	breaker.Record(true)
+	clock.now = clock.now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatal("Expected a probe after the cooldown", err)
+	}
+	breaker.Cancel()
+	if state := breaker.State(); state.State != BreakerHalfOpen || state.Failures != 1 {
+		t.Error("Expected a cancelled probe to leave the breaker half-open", state)
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Error("Expected another probe after a cancelled one", err)
+	}
+}
+
+func TestClientBreakerCancelled(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(100, &calls)
+	defer server.Close()
+
+	client := NewClient(&config.APIConfig{
+		LBDAPIEndpoint:      server.URL,
+		LBDRetryMaxAttempts: 1,
+		LBDBreakerThreshold: 3,
+	}, nil, nil)
+	for i := 0; i < 2; i++ {
+		client.Call(context.Background(), "/v1/users/U1", "GET", nil, nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Call(ctx, "/v1/users/U1", "GET", nil, nil); err == nil {
+		t.Fatal("Expected the cancelled call to fail")
+	}
+	if state := client.BreakerStates()["users"]; state.State != BreakerClosed || state.Failures != 2 {
+		t.Error("Expected a cancelled call not to count as a success", state)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package api
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeSyncInterval = 10 * time.Minute
+)
+
+// TimeSync keeps the offset between the local clock and LBD server time, so
+// signing timestamps can be produced locally instead of calling /v1/time
+// before every request.
+type TimeSync struct {
+	fetch    func(ctx context.Context) (time.Time, error)
+	clock    Clock
+	interval time.Duration
+
+	mu       sync.Mutex
+	offset   time.Duration
+	syncedAt time.Time
+	synced   bool
+	inflight *syncCall
+}
+
+// syncCall is a fetch of the server time which concurrent syncs wait for
+// instead of sending their own.
+type syncCall struct {
+	done chan struct{}
+	err  error
+}
+
+func NewTimeSync(fetch func(ctx context.Context) (time.Time, error), clock Clock, interval time.Duration) *TimeSync {
+	if clock == nil {
+		clock = SystemClock
+	}
+	if interval <= 0 {
+		interval = DefaultTimeSyncInterval
+	}
+	return &TimeSync{
+		fetch:    fetch,
+		clock:    clock,
+		interval: interval,
+	}
+}
+
+// Now returns the local time corrected by the last known offset, syncing
+// first when the offset is older than the sync interval. A failed periodic
+// sync keeps using the previous offset.
+func (s *TimeSync) Now(ctx context.Context) (time.Time, error) {
+	s.mu.Lock()
+	stale := !s.synced || s.clock.Now().Sub(s.syncedAt) >= s.interval
+	s.mu.Unlock()
+
+	if stale {
+		if err := s.sync(ctx); err != nil {
+			s.mu.Lock()
+			synced := s.synced
+			s.mu.Unlock()
+			if !synced {
+				return time.Time{}, err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock.Now().Add(s.offset), nil
+}
+
+// Timestamp returns the corrected time in milliseconds, as LBD expects in
+// the timestamp header.
+func (s *TimeSync) Timestamp(ctx context.Context) (string, error) {
+	now, err := s.Now(ctx)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10), nil
+}
+
+// Resync fetches the server time regardless of when the last sync happened.
+func (s *TimeSync) Resync(ctx context.Context) error {
+	return s.sync(ctx)
+}
+
+func (s *TimeSync) Offset() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset
+}
+
+// Run resyncs every interval until ctx is done.
+func (s *TimeSync) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Resync(ctx)
+		}
+	}
+}
+
+// sync fetches the server time, or waits for the fetch already in flight.
+// The lock is not held during the fetch, so requests signed with a known
+// offset do not wait behind a slow sync.
+func (s *TimeSync) sync(ctx context.Context) error {
+	s.mu.Lock()
+	if call := s.inflight; call != nil {
+		s.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &syncCall{done: make(chan struct{})}
+	s.inflight = call
+	s.mu.Unlock()
+
+	call.err = s.fetchOffset(ctx)
+
+	s.mu.Lock()
+	s.inflight = nil
+	s.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+func (s *TimeSync) fetchOffset(ctx context.Context) error {
+	sent := s.clock.Now()
+	serverTime, err := s.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	received := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// assume the server read its clock halfway through the round trip
+	local := sent.Add(received.Sub(sent) / 2)
+	s.offset = serverTime.Sub(local)
+	s.syncedAt = received
+	s.synced = true
+	return nil
+}
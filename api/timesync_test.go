@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"link/cinema/config"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func TestTimeSyncOffset(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	serverTime := time.Unix(1060, 0)
+	fetches := 0
+	fetch := func(ctx context.Context) (time.Time, error) {
+		fetches++
+		clock.now = clock.now.Add(2 * time.Second)
+		return serverTime, nil
+	}
+
+	sync := NewTimeSync(fetch, clock, time.Minute)
+
+	now, err := sync.Now(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server read its clock halfway through a 2s round trip
+	if sync.Offset() != 59*time.Second {
+		t.Error("Unexpected offset", sync.Offset())
+	}
+	if !now.Equal(time.Unix(1061, 0)) {
+		t.Error("Unexpected corrected time", now)
+	}
+
+	clock.now = clock.now.Add(30 * time.Second)
+	if _, err := sync.Now(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 1 {
+		t.Error("Expected a cached offset within the interval", fetches)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if _, err := sync.Now(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 2 {
+		t.Error("Expected a resync after the interval", fetches)
+	}
+}
+
+func TestTimeSyncFetchOutsideLock(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (time.Time, error) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		return time.Now(), nil
+	}
+	sync := NewTimeSync(fetch, nil, time.Minute)
+	if _, err := sync.Now(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	resynced := make(chan error)
+	go func() {
+		resynced <- sync.Resync(context.Background())
+	}()
+	for atomic.LoadInt32(&fetches) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sync.Now(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a synced offset to be read while a resync is in flight")
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sync.Resync(cancelled); err != context.Canceled {
+		t.Error("Expected a resync to wait for the one in flight", err)
+	}
+
+	close(release)
+	if err := <-resynced; err != nil {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&fetches) != 2 {
+		t.Error("Expected concurrent resyncs to share one fetch", fetches)
+	}
+}
+
+func TestClientResyncOnTimestampRejected(t *testing.T) {
+	var timeCalls, apiCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/time" {
+			atomic.AddInt32(&timeCalls, 1)
+			w.Write([]byte(`{"responseTime":1581000000000,"statusCode":1000,"statusMessage":"Success"}`))
+			return
+		}
+		if atomic.AddInt32(&apiCalls, 1) == 2 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"responseTime":1581000000000,"statusCode":4013,"statusMessage":"Invalid timestamp"}`))
+			return
+		}
+		w.Write([]byte(`{"responseTime":1581000000000,"statusCode":1000,"statusMessage":"Success","responseData":{}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.APIConfig{LBDAPIEndpoint: server.URL}, nil, nil)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call(context.Background(), "/v1/users/U1", "GET", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if timeCalls != 2 {
+		t.Error("Expected one initial sync and one forced resync", timeCalls)
+	}
+	if apiCalls != 3 {
+		t.Error("Expected the rejected request to be sent again", apiCalls)
+	}
+}
@@ -18,4 +18,5 @@ package api
 type UserProfile struct {
 	DisplayName string `json:"displayName"`
 	UserID      string `json:"userId"`
+	Role        string `json:"role,omitempty"`
 }
\ No newline at end of file
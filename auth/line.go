@@ -0,0 +1,318 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+// Package auth logs users in with LINE Login. The LINE user ID in the ID
+// token is the user ID LBD knows the user by.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"link/cinema/api"
+	"link/cinema/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLINEAccessEndpoint = "https://access.line.me"
+	DefaultLINEAPIEndpoint    = "https://api.line.me"
+
+	CallbackPath = "/api/v0/user/login/callback"
+
+	loginScope = "profile openid"
+)
+
+var (
+	ErrInvalidState   = errors.New("invalid login state")
+	ErrLoginDenied    = errors.New("login denied")
+	ErrTokenExchange  = errors.New("token exchange failed")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+// LoginRequest is what a login keeps between the redirect to LINE and the
+// callback: the state the callback must echo, the nonce the ID token must
+// carry, and the PKCE code verifier.
+type LoginRequest struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+}
+
+func NewLoginRequest() (*LoginRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		data := make([]byte, 32)
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(data)
+	}
+	return &LoginRequest{
+		State:        values[0],
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+	}, nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the code verifier.
+func (r *LoginRequest) CodeChallenge() string {
+	return CodeChallenge(r.CodeVerifier)
+}
+
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CheckState reports whether state is the one sent to LINE.
+func (r *LoginRequest) CheckState(state string) error {
+	if r.State == "" || !hmac.Equal([]byte(r.State), []byte(state)) {
+		return ErrInvalidState
+	}
+	return nil
+}
+
+// Token is the response of the LINE token endpoint.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token"`
+}
+
+// IDToken holds the claims of a LINE ID token.
+type IDToken struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	Nonce     string `json:"nonce"`
+	Name      string `json:"name,omitempty"`
+	Picture   string `json:"picture,omitempty"`
+}
+
+// Profile returns the user the ID token was issued for.
+func (t *IDToken) Profile() api.UserProfile {
+	return api.UserProfile{
+		DisplayName: t.Name,
+		UserID:      t.Subject,
+	}
+}
+
+// LINELogin runs the LINE Login flow of the channel of its APIConfig.
+type LINELogin struct {
+	config     *config.APIConfig
+	httpClient *http.Client
+	clock      api.Clock
+}
+
+func NewLINELogin(cfg *config.APIConfig, httpClient *http.Client, clock api.Clock) *LINELogin {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: api.DefaultTimeout}
+	}
+	if clock == nil {
+		clock = api.SystemClock
+	}
+	return &LINELogin{
+		config:     cfg,
+		httpClient: httpClient,
+		clock:      clock,
+	}
+}
+
+// Enabled reports whether a LINE Login channel is configured.
+func (l *LINELogin) Enabled() bool {
+	return l.config.ChannelID != ""
+}
+
+func (l *LINELogin) accessEndpoint() string {
+	if l.config.LINEAccessEndpoint == "" {
+		return DefaultLINEAccessEndpoint
+	}
+	return strings.TrimSuffix(l.config.LINEAccessEndpoint, "/")
+}
+
+func (l *LINELogin) apiEndpoint() string {
+	if l.config.LINEAPIEndpoint == "" {
+		return DefaultLINEAPIEndpoint
+	}
+	return strings.TrimSuffix(l.config.LINEAPIEndpoint, "/")
+}
+
+func (l *LINELogin) RedirectURI() string {
+	return strings.TrimSuffix(l.config.Endpoint, "/") + CallbackPath
+}
+
+// AuthorizeURL returns the LINE page the user logs in at.
+func (l *LINELogin) AuthorizeURL(req *LoginRequest) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", l.config.ChannelID)
+	query.Set("redirect_uri", l.RedirectURI())
+	query.Set("state", req.State)
+	query.Set("nonce", req.Nonce)
+	query.Set("scope", loginScope)
+	query.Set("code_challenge", req.CodeChallenge())
+	query.Set("code_challenge_method", "S256")
+	return l.accessEndpoint() + "/oauth2/v2.1/authorize?" + query.Encode()
+}
+
+// Login exchanges the authorization code of a callback for tokens and
+// returns the verified ID token.
+func (l *LINELogin) Login(ctx context.Context, code string, req *LoginRequest) (*IDToken, *Token, error) {
+	token, err := l.Exchange(ctx, code, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	idToken, err := l.VerifyIDToken(token.IDToken, req.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return idToken, token, nil
+}
+
+// Exchange sends the authorization code and the PKCE code verifier to the
+// token endpoint.
+func (l *LINELogin) Exchange(ctx context.Context, code string, req *LoginRequest) (*Token, error) {
+	if code == "" {
+		return nil, fmt.Errorf("%w: missing code", ErrTokenExchange)
+	}
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", l.RedirectURI())
+	data.Set("client_id", l.config.ChannelID)
+	data.Set("client_secret", l.config.ChannelSecret.Reveal())
+	data.Set("code_verifier", req.CodeVerifier)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", l.apiEndpoint()+"/oauth2/v2.1/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := l.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		failure := struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}{}
+		if err := json.Unmarshal(body, &failure); err != nil || failure.Error == "" {
+			return nil, fmt.Errorf("%w: %s", ErrTokenExchange, resp.Status)
+		}
+		return nil, fmt.Errorf("%w: %s: %s", ErrTokenExchange, failure.Error, failure.Description)
+	}
+
+	token := &Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTokenExchange, err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token, is the openid scope enabled?", ErrTokenExchange)
+	}
+	return token, nil
+}
+
+// VerifyIDToken checks the HS256 signature of an ID token against the
+// channel secret, and that it was issued by LINE to the channel for the
+// login with nonce and has not expired.
+func (l *LINELogin) VerifyIDToken(idToken, nonce string) (*IDToken, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidIDToken)
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidIDToken, header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, SignHS256(l.config.ChannelSecret.Reveal(), parts[0]+"."+parts[1])) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	claims := &IDToken{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, err
+	}
+	switch {
+	case claims.Issuer != l.accessEndpoint():
+		return nil, fmt.Errorf("%w: issued by %s", ErrInvalidIDToken, claims.Issuer)
+	case claims.Audience != l.config.ChannelID:
+		return nil, fmt.Errorf("%w: issued to %s", ErrInvalidIDToken, claims.Audience)
+	case !l.clock.Now().Before(time.Unix(claims.ExpiresAt, 0)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case nonce == "" || !hmac.Equal([]byte(claims.Nonce), []byte(nonce)):
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// SessionKey returns the key the session cookies are signed with.
+func SessionKey(cfg *config.APIConfig) []byte {
+	if cfg.SessionSecret != "" {
+		return []byte(cfg.SessionSecret.Reveal())
+	}
+	key := sha256.Sum256([]byte("session:" + cfg.ChannelSecret.Reveal() + ":" + cfg.APISecret.Reveal()))
+	return key[:]
+}
+
+// SignHS256 returns the HMAC-SHA256 of data keyed with secret, the signature
+// of an HS256 JWT.
+func SignHS256(secret, data string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+	return nil
+}
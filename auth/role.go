@@ -0,0 +1,113 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"link/cinema/config"
+)
+
+// Role is what a user may do. Each role may do everything the roles below
+// it may.
+type Role string
+
+const (
+	// RoleCustomer buys tickets and reads their own tokens and orders.
+	RoleCustomer Role = "customer"
+	// RoleStaff checks tickets in at the theater gate.
+	RoleStaff Role = "staff"
+	// RoleOperator edits the catalog.
+	RoleOperator Role = "operator"
+	// RoleAdmin manages sessions and reads the server configuration.
+	RoleAdmin Role = "admin"
+)
+
+var (
+	ErrInvalidRole = errors.New("invalid role")
+
+	roleRanks = map[Role]int{
+		RoleCustomer: 0,
+		RoleStaff:    1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+)
+
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrInvalidRole, name)
+	}
+	return role, nil
+}
+
+// Includes reports whether r may do what other may.
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[other]
+}
+
+// UserRole returns the role UserRoles gives userID, RoleCustomer by default.
+func UserRole(cfg *config.APIConfig, userID string) Role {
+	if role, err := ParseRole(cfg.UserRoles[userID]); err == nil {
+		return role
+	}
+	return RoleCustomer
+}
+
+// FindAPIKey returns the API key of cfg matching key, or nil.
+func FindAPIKey(cfg *config.APIConfig, key string) *config.APIKey {
+	if key == "" {
+		return nil
+	}
+	// the keys are compared as hashes, so the comparison takes as long
+	// whatever their lengths
+	sent := sha256.Sum256([]byte(key))
+	var found *config.APIKey
+	for i := range cfg.APIKeys {
+		known := sha256.Sum256([]byte(cfg.APIKeys[i].Key.Reveal()))
+		if subtle.ConstantTimeCompare(sent[:], known[:]) == 1 {
+			found = &cfg.APIKeys[i]
+		}
+	}
+	return found
+}
+
+// CheckConfig checks the roles and API keys of cfg.
+func CheckConfig(cfg *config.APIConfig) error {
+	for userID, name := range cfg.UserRoles {
+		if _, err := ParseRole(name); err != nil {
+			return fmt.Errorf("role of user %s: %w", userID, err)
+		}
+	}
+	keys := make(map[config.Secret]bool)
+	for _, key := range cfg.APIKeys {
+		if _, err := ParseRole(key.Role); err != nil {
+			return fmt.Errorf("API key %s: %w", key.Name, err)
+		}
+		if len(key.Key) < 16 {
+			return fmt.Errorf("API key %s: key must be at least 16 characters", key.Name)
+		}
+		if keys[key.Key] {
+			return fmt.Errorf("API key %s: key used twice", key.Name)
+		}
+		keys[key.Key] = true
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"link/cinema/config"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	if !RoleAdmin.Includes(RoleStaff) || !RoleStaff.Includes(RoleStaff) || RoleStaff.Includes(RoleOperator) || Role("").Includes(RoleCustomer) {
+		t.Error("Unexpected role ranks")
+	}
+	if _, err := ParseRole("superuser"); !errors.Is(err, ErrInvalidRole) {
+		t.Error("Expected an unknown role to be refused", err)
+	}
+
+	cfg := &config.APIConfig{
+		UserRoles: map[string]string{"gate-user": "staff"},
+		APIKeys: []config.APIKey{
+			{Name: "scanner", Key: "scanner-key-0123456789", Role: "staff"},
+			{Name: "backoffice", Key: "backoffice-key-0123456789", Role: "admin", UserID: "ops-user"},
+		},
+	}
+	if err := CheckConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if UserRole(cfg, "gate-user") != RoleStaff || UserRole(cfg, "someone") != RoleCustomer {
+		t.Error("Unexpected user roles")
+	}
+	if key := FindAPIKey(cfg, "backoffice-key-0123456789"); key == nil || key.Name != "backoffice" {
+		t.Error("Expected the backoffice key", key)
+	}
+	if key := FindAPIKey(cfg, "backoffice-key"); key != nil {
+		t.Error("Expected no key for a prefix", key)
+	}
+
+	invalid := []*config.APIConfig{
+		{UserRoles: map[string]string{"someone": "root"}},
+		{APIKeys: []config.APIKey{{Name: "short", Key: "short", Role: "staff"}}},
+		{APIKeys: []config.APIKey{{Name: "no-role", Key: "no-role-key-0123456789"}}},
+		{APIKeys: []config.APIKey{cfg.APIKeys[0], cfg.APIKeys[0]}},
+	}
+	for _, cfg := range invalid {
+		if err := CheckConfig(cfg); err == nil {
+			t.Error("Expected an invalid config to be refused", cfg)
+		}
+	}
+}
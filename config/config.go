@@ -16,9 +16,7 @@ under the License
 package config
 
 import (
-	"fmt"
-	"github.com/BurntSushi/toml"
-	"io/ioutil"
+	"time"
 )
 
 type APIConfig struct {
@@ -27,20 +25,111 @@ type APIConfig struct {
 	LINEAccessEndpoint   string `json:"lineAccessEndpoint"`
 	Endpoint             string `json:"endpoint"`
 	WalletAddress        string `json:"walletAddress"`
-	WalletSecret         string `json:"walletSecret"`
+	WalletSecret         Secret `json:"walletSecret"`
 	APIKey               string `json:"apiKey"`
-	APISecret            string `json:"apiSecret"`
+	APISecret            Secret `json:"apiSecret"`
 	ChannelID            string `json:"channel-id"`
-	ChannelSecret        string `json:"channelSecret"`
+	ChannelSecret        Secret `json:"channelSecret"`
 	ServiceContractID    string `json:"serviceContract-id"`
 	ItemContractID       string `json:"itemContract-id"`
 	FungibleTokenType    string `json:"fungibleTokenType"`
 	NonFungibleTokenType string `json:"non-fungibleTokenType"`
 	UserID               string `json:"user-id"`
+
+	LBDRetryMaxAttempts       int `json:"lbdRetryMaxAttempts"`
+	LBDRetryBaseDelayMillis   int `json:"lbdRetryBaseDelayMillis"`
+	LBDRetryMaxDelayMillis    int `json:"lbdRetryMaxDelayMillis"`
+	LBDBreakerThreshold       int `json:"lbdBreakerThreshold"`
+	LBDBreakerCooldownSeconds int `json:"lbdBreakerCooldownSeconds"`
+
+	LBDTransportMode string `json:"lbdTransportMode"`
+	LBDCassettePath  string `json:"lbdCassettePath"`
+
+	LocalDBPath                string `json:"localDbPath"`
+	HistorySyncIntervalSeconds int    `json:"historySyncIntervalSeconds"`
+
+	QuoteSecret     Secret `json:"quoteSecret"`
+	QuoteTTLSeconds int    `json:"quoteTtlSeconds"`
+
+	CatalogPath     string        `json:"catalogPath"`
+	SeatHoldSeconds int           `json:"seatHoldSeconds"`
+	Pricing         PricingConfig `json:"pricing"`
+
+	CheckInOpensMinutes  int `json:"checkInOpensMinutes"`
+	CheckInClosesMinutes int `json:"checkInClosesMinutes"`
+
+	SessionSecret      Secret `json:"sessionSecret"`
+	SessionIdleMinutes int    `json:"sessionIdleMinutes"`
+	SessionMaxAgeHours int    `json:"sessionMaxAgeHours"`
+
+	Production bool              `json:"production"`
+	UserRoles  map[string]string `json:"userRoles"`
+	APIKeys    []APIKey          `json:"apiKeys"`
+
+	// sources tells where the fields not left at their defaults were set
+	sources map[string]Source
+}
+
+// PricingConfig holds the rules tickets are priced by. Left empty, tickets
+// are sold at their list price with the default token discounts.
+type PricingConfig struct {
+	BasePrice      int             `json:"basePrice"`
+	ShowtimePrices []ShowtimePrice `json:"showtimePrices"`
+	Discounts      []DiscountRule  `json:"discounts"`
+	Promotions     []Promotion     `json:"promotions"`
+}
+
+// ShowtimePrice is the base price of the tickets of the catalog showtime
+// ShowtimeID, or of the showtimes at Showtime in Theater, or in every theater
+// when Theater is empty.
+type ShowtimePrice struct {
+	ShowtimeID string    `json:"showtimeId"`
+	Showtime   time.Time `json:"showtime"`
+	Theater    string    `json:"theater"`
+	Price      int       `json:"price"`
+}
+
+// DiscountRule takes Value off the price for every Ratio tokens of Token the
+// user redeems, up to MaxTokens per ticket.
+type DiscountRule struct {
+	Name      string `json:"name"`
+	Token     string `json:"token"`
+	Ratio     int    `json:"ratio"`
+	Value     int    `json:"value"`
+	MaxTokens int    `json:"maxTokens"`
+	Priority  int    `json:"priority"`
+	Exclusive bool   `json:"exclusive"`
+}
+
+// Promotion takes Amount, or Percent of the base price, off the tickets
+// bought between From and Until for showtimes starting between
+// ShowtimeFromHour and ShowtimeUntilHour. Zero values leave a bound open.
+type Promotion struct {
+	Name              string    `json:"name"`
+	From              time.Time `json:"from"`
+	Until             time.Time `json:"until"`
+	ShowtimeFromHour  int       `json:"showtimeFromHour"`
+	ShowtimeUntilHour int       `json:"showtimeUntilHour"`
+	Amount            int       `json:"amount"`
+	Percent           int       `json:"percent"`
+	Priority          int       `json:"priority"`
+	Exclusive         bool      `json:"exclusive"`
+}
+
+// APIKey lets a machine client call the API with Role, sending Key in the
+// X-API-Key header. The client acts on UserID when one is given.
+type APIKey struct {
+	Name   string `json:"name"`
+	Key    Secret `json:"key"`
+	Role   string `json:"role"`
+	UserID string `json:"userId"`
 }
 
 const (
+	// Path is the environment variable naming the config file.
 	Path = "CONFIG_PATH"
+
+	DefaultLocalDBPath = "cinema.db"
 )
 
 var (
@@ -54,15 +143,3 @@ func GetAPIConfig() *APIConfig {
 func SetAPIConfig(config *APIConfig) {
 	apiConfig = config
 }
-
-func LoadAPIConfig(path string) {
-	dat, err := ioutil.ReadFile(path)
-	if err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-	if _, err := toml.Decode(string(dat), apiConfig); err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package config
+
+import (
+	"reflect"
+)
+
+// Source is where a config field was set.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Field describes a field of an APIConfig. Value is left out when the field
+// is not set, and is masked for secrets.
+type Field struct {
+	Name   string      `json:"name"`
+	Set    bool        `json:"set"`
+	Secret bool        `json:"secret,omitempty"`
+	Source Source      `json:"source"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+var (
+	secretType = reflect.TypeOf(Secret(""))
+)
+
+// setSource records that the field named like key was set from source.
+func (c *APIConfig) setSource(key string, source Source) {
+	if f, ok := fieldNamed(key); ok {
+		if c.sources == nil {
+			c.sources = make(map[string]Source)
+		}
+		c.sources[f.Name] = source
+	}
+}
+
+// Source returns where the named field was set.
+func (c *APIConfig) Source(field string) Source {
+	if source, ok := c.sources[field]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// Describe lists the fields of c with whether they are set and where.
+func (c *APIConfig) Describe() []Field {
+	v := reflect.ValueOf(*c)
+	t := v.Type()
+	fields := make([]Field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		value := v.Field(i)
+		field := Field{
+			Name:   f.Name,
+			Set:    !value.IsZero(),
+			Secret: f.Type == secretType,
+			Source: c.Source(f.Name),
+		}
+		if field.Set {
+			field.Value = value.Interface()
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
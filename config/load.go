@@ -0,0 +1,352 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvPrefix starts the names of the environment variables setting
+	// config fields, e.g. CINEMA_LBD_API_ENDPOINT.
+	EnvPrefix = "CINEMA_"
+)
+
+var (
+	// acronyms are kept whole when field names are split into words
+	acronyms = []string{"LINE", "LBD", "API", "TTL", "ID", "DB"}
+)
+
+// Default returns the config before any file, variable or flag is read.
+// Fields left empty here are defaulted by the code using them.
+func Default() *APIConfig {
+	return &APIConfig{
+		LocalDBPath: DefaultLocalDBPath,
+	}
+}
+
+// Load builds a config from its layers, each overriding the ones before:
+// the defaults, the file named by the -config flag or CONFIG_PATH, the
+// CINEMA_* variables of environ, and the flags in args. It returns
+// flag.ErrHelp when args ask for the usage, which is then printed.
+func Load(args, environ []string) (*APIConfig, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("cinema", flag.ContinueOnError)
+	path := flags.String("config", lookupEnv(environ, Path), "config file in TOML, YAML or JSON, told by its extension")
+	flagValues := make(map[string]string)
+	for _, f := range settings() {
+		flags.Var(&fieldFlag{name: f.Name, values: flagValues, bool: f.Type.Kind() == reflect.Bool}, FlagName(f.Name), "sets "+f.Name+", like "+EnvName(f.Name))
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, fmt.Errorf("reading config file %s: %w", *path, err)
+		}
+	}
+
+	errs := ValidationError{}
+	errs = append(errs, cfg.loadEnv(environ)...)
+	names := make([]string, 0, len(flagValues))
+	for name := range flagValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := cfg.set(name, flagValues[name], SourceFlag); err != nil {
+			errs = append(errs, FieldError{Field: "-" + FlagName(name), Problem: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+// loadFile reads the file at path over c, in the format told by its
+// extension, TOML by default. Keys name fields as in TOML, in any case, and
+// YAML and JSON files may also separate their words with - or _.
+func (c *APIConfig) loadFile(path string) error {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		raw := make(map[string]interface{})
+		if err := yaml.Unmarshal(dat, &raw); err != nil {
+			return err
+		}
+		return c.loadMap(raw)
+	case ".json":
+		raw := make(map[string]interface{})
+		if err := json.Unmarshal(dat, &raw); err != nil {
+			return err
+		}
+		return c.loadMap(raw)
+	}
+
+	md, err := toml.Decode(string(dat), c)
+	if err != nil {
+		return err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown key %s", undecoded[0])
+	}
+	for _, key := range md.Keys() {
+		c.setSource(key[0], SourceFile)
+	}
+	return nil
+}
+
+// loadMap decodes a YAML or JSON document over c through encoding/json,
+// after renaming its keys to the JSON names of the fields.
+func (c *APIConfig) loadMap(raw map[string]interface{}) error {
+	renamed := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		f, ok := fieldNamed(key)
+		if !ok {
+			return fmt.Errorf("unknown key %s", key)
+		}
+		value, err := jsonValue(value)
+		if err != nil {
+			return err
+		}
+		renamed[strings.Split(f.Tag.Get("json"), ",")[0]] = value
+	}
+
+	dat, err := json.Marshal(renamed)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(dat))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return err
+	}
+	for key := range raw {
+		c.setSource(key, SourceFile)
+	}
+	return nil
+}
+
+// jsonValue turns the maps YAML decodes to into ones encoding/json takes.
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			elem, err := jsonValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprint(key)] = elem
+		}
+		return result, nil
+	case map[string]interface{}:
+		for key, elem := range v {
+			elem, err := jsonValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = elem
+		}
+		return v, nil
+	case []interface{}:
+		for i, elem := range v {
+			elem, err := jsonValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = elem
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// loadEnv sets the fields named by the CINEMA_* variables of environ.
+func (c *APIConfig) loadEnv(environ []string) ValidationError {
+	names := make(map[string]string)
+	for _, f := range settings() {
+		names[EnvName(f.Name)] = f.Name
+	}
+
+	errs := ValidationError{}
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], EnvPrefix) {
+			continue
+		}
+		name, ok := names[parts[0]]
+		if !ok {
+			errs = append(errs, FieldError{Field: parts[0], Problem: "unknown setting"})
+			continue
+		}
+		if err := c.set(name, parts[1], SourceEnv); err != nil {
+			errs = append(errs, FieldError{Field: parts[0], Problem: err.Error()})
+		}
+	}
+	return errs
+}
+
+// set parses value into the field name: strings and secrets as they are,
+// numbers and booleans as in Go, and tables and lists as JSON.
+func (c *APIConfig) set(name, value string, source Source) error {
+	v := reflect.ValueOf(c).Elem().FieldByName(name)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		v.SetBool(b)
+	default:
+		decoded := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), decoded.Interface()); err != nil {
+			return fmt.Errorf("not valid JSON: %v", err)
+		}
+		v.Set(decoded.Elem())
+	}
+	c.setSource(name, source)
+	return nil
+}
+
+// fieldFlag keeps the value of a field flag until the layers below it are
+// loaded.
+type fieldFlag struct {
+	name   string
+	values map[string]string
+	bool   bool
+}
+
+func (f *fieldFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return f.values[f.name]
+}
+
+func (f *fieldFlag) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.bool
+}
+
+// settings returns the fields of APIConfig which can be set.
+func settings() []reflect.StructField {
+	t := reflect.TypeOf(APIConfig{})
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// fieldNamed returns the field named key, ignoring case and the - and _
+// between words.
+func fieldNamed(key string) (reflect.StructField, bool) {
+	for _, f := range settings() {
+		if normalize(f.Name) == normalize(key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+}
+
+// EnvName returns the environment variable setting the named field, e.g.
+// CINEMA_LBD_API_ENDPOINT for LBDAPIEndpoint.
+func EnvName(field string) string {
+	return EnvPrefix + strings.ToUpper(strings.Join(words(field), "_"))
+}
+
+// FlagName returns the flag setting the named field, e.g. lbd-api-endpoint
+// for LBDAPIEndpoint.
+func FlagName(field string) string {
+	return strings.ToLower(strings.Join(words(field), "-"))
+}
+
+// words splits a field name into its words, keeping acronyms whole.
+func words(name string) []string {
+	result := make([]string, 0)
+	for len(name) > 0 {
+		n := 0
+		for _, acronym := range acronyms {
+			if strings.HasPrefix(name, acronym) && (len(name) == len(acronym) || !isLower(name[len(acronym)])) {
+				n = len(acronym)
+				break
+			}
+		}
+		if n == 0 {
+			n = 1
+			for n < len(name) && !isUpper(name[n]) {
+				n++
+			}
+		}
+		result = append(result, name[:n])
+		name = name[n:]
+	}
+	return result
+}
+
+func isUpper(b byte) bool {
+	return 'A' <= b && b <= 'Z'
+}
+
+func isLower(b byte) bool {
+	return 'a' <= b && b <= 'z'
+}
+
+func lookupEnv(environ []string, key string) string {
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, key+"=") {
+			return kv[len(key)+1:]
+		}
+	}
+	return ""
+}
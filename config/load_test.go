@@ -0,0 +1,159 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+Endpoint = "http://file.example"
+LBDAPIEndpoint = "http://file.example"
+ChannelID = "file-channel"
+SeatHoldSeconds = 60
+`)
+	environ := []string{
+		Path + "=" + path,
+		"CINEMA_LBD_API_ENDPOINT=http://env.example",
+		"CINEMA_CHANNEL_ID=env-channel",
+		"CINEMA_USER_ROLES={\"U1\":\"admin\"}",
+		"OTHER=ignored",
+	}
+	cfg, err := Load([]string{"-channel-id", "flag-channel", "-production"}, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []struct {
+		field  string
+		value  interface{}
+		source Source
+	}{
+		{"LocalDBPath", cfg.LocalDBPath == DefaultLocalDBPath, SourceDefault},
+		{"Endpoint", cfg.Endpoint == "http://file.example", SourceFile},
+		{"SeatHoldSeconds", cfg.SeatHoldSeconds == 60, SourceFile},
+		{"LBDAPIEndpoint", cfg.LBDAPIEndpoint == "http://env.example", SourceEnv},
+		{"UserRoles", cfg.UserRoles["U1"] == "admin", SourceEnv},
+		{"ChannelID", cfg.ChannelID == "flag-channel", SourceFlag},
+		{"Production", cfg.Production, SourceFlag},
+	} {
+		if expected.value != true || cfg.Source(expected.field) != expected.source {
+			t.Error("Expected the field to be set from", expected.source, expected.field, cfg.Source(expected.field))
+		}
+	}
+
+	if _, err := Load([]string{"-h"}, nil); err != flag.ErrHelp {
+		t.Error("Expected the usage to be asked for", err)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `
+WalletSecret = "secret"
+[[APIKeys]]
+Name = "gate"
+Key = "gate-key"
+[Pricing]
+BasePrice = 10
+[[Pricing.Promotions]]
+Name = "early"
+From = 2020-01-01T00:00:00Z
+`,
+		"config.yaml": `
+walletSecret: secret
+api_keys:
+  - name: gate
+    key: gate-key
+pricing:
+  basePrice: 10
+  promotions:
+    - name: early
+      from: 2020-01-01T00:00:00Z
+`,
+		"config.json": `{
+  "WalletSecret": "secret",
+  "api-keys": [{"Name": "gate", "Key": "gate-key"}],
+  "Pricing": {"BasePrice": 10, "Promotions": [{"Name": "early", "From": "2020-01-01T00:00:00Z"}]}
+}`,
+	}
+	for name, content := range files {
+		cfg, err := Load(nil, []string{Path + "=" + writeFile(t, name, content)})
+		if err != nil {
+			t.Error(name, err)
+			continue
+		}
+		if cfg.WalletSecret.Reveal() != "secret" || len(cfg.APIKeys) != 1 || cfg.APIKeys[0].Key.Reveal() != "gate-key" {
+			t.Error("Expected the secrets to be read", name, cfg.APIKeys)
+		}
+		if cfg.Pricing.BasePrice != 10 || len(cfg.Pricing.Promotions) != 1 || cfg.Pricing.Promotions[0].From.Year() != 2020 {
+			t.Error("Expected the tables to be read", name, cfg.Pricing)
+		}
+		if cfg.Source("APIKeys") != SourceFile {
+			t.Error("Expected the keys to be set from the file", name)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown.toml": `Endpont = "http://example"`,
+		"unknown.yaml": `endpont: http://example`,
+		"nested.json":  `{"Pricing": {"BasPrice": 10}}`,
+		"invalid.json": `{"Endpoint": }`,
+	} {
+		if _, err := Load(nil, []string{Path + "=" + writeFile(t, name, content)}); err == nil {
+			t.Error("Expected the file to be refused", name)
+		}
+	}
+	if _, err := Load(nil, []string{Path + "=" + filepath.Join(t.TempDir(), "missing.toml")}); err == nil {
+		t.Error("Expected a missing file to be refused")
+	}
+
+	_, err := Load([]string{"-seat-hold-seconds", "soon"}, []string{"CINEMA_ENDPONT=x", "CINEMA_PRODUCTION=maybe"})
+	errs, ok := err.(ValidationError)
+	if !ok || len(errs) != 3 {
+		t.Fatal("Expected every bad setting to be reported", err)
+	}
+	if errs[0].Field != "CINEMA_ENDPONT" || errs[1].Field != "CINEMA_PRODUCTION" || errs[2].Field != "-seat-hold-seconds" {
+		t.Error("Expected the settings to be named", errs)
+	}
+}
+
+func TestNames(t *testing.T) {
+	for field, expected := range map[string]string{
+		"LBDAPIEndpoint":       "CINEMA_LBD_API_ENDPOINT",
+		"LINEAccessEndpoint":   "CINEMA_LINE_ACCESS_ENDPOINT",
+		"APIKeys":              "CINEMA_API_KEYS",
+		"NonFungibleTokenType": "CINEMA_NON_FUNGIBLE_TOKEN_TYPE",
+		"QuoteTTLSeconds":      "CINEMA_QUOTE_TTL_SECONDS",
+		"LocalDBPath":          "CINEMA_LOCAL_DB_PATH",
+		"SessionIdleMinutes":   "CINEMA_SESSION_IDLE_MINUTES",
+		"UserID":               "CINEMA_USER_ID",
+	} {
+		if name := EnvName(field); name != expected {
+			t.Error("Expected the variable to be named", expected, name)
+		}
+	}
+	if name := FlagName("LBDAPIEndpoint"); name != "lbd-api-endpoint" {
+		t.Error("Expected the flag to be named lbd-api-endpoint", name)
+	}
+
+	seen := make(map[string]string)
+	for _, f := range settings() {
+		if other, ok := seen[EnvName(f.Name)]; ok {
+			t.Error("Expected the fields to have their own variables", f.Name, other)
+		}
+		seen[EnvName(f.Name)] = f.Name
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretMasked(t *testing.T) {
+	cfg := APIConfig{
+		APISecret:     "leaked-api-secret",
+		WalletSecret:  "leaked-wallet-secret",
+		ChannelSecret: "leaked-channel-secret",
+		APIKeys:       []APIKey{{Name: "admin", Key: "leaked-admin-key", Role: "admin"}},
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shown := []string{string(data)}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		shown = append(shown, fmt.Sprintf(format, cfg), fmt.Sprintf(format, &cfg))
+	}
+	shown = append(shown, fmt.Errorf("bad config: %v", cfg.APISecret).Error())
+	for _, s := range shown {
+		if strings.Contains(s, "leaked") {
+			t.Error("Expected the secrets to be masked", s)
+		}
+	}
+	if !strings.Contains(string(data), `"walletSecret":"`+MaskedSecret+`"`) {
+		t.Error("Expected a set secret to show as masked", string(data))
+	}
+	if !strings.Contains(string(data), `"quoteSecret":""`) {
+		t.Error("Expected an unset secret to show as empty", string(data))
+	}
+	if cfg.APISecret.Reveal() != "leaked-api-secret" {
+		t.Error("Expected Reveal to return the secret", cfg.APISecret.Reveal())
+	}
+}
+
+// TestSecretFields keeps new secret fields from being added as plain strings.
+func TestSecretFields(t *testing.T) {
+	for _, typ := range []reflect.Type{reflect.TypeOf(APIConfig{}), reflect.TypeOf(APIKey{})} {
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			name := strings.ToLower(f.Name)
+			if (strings.Contains(name, "secret") || name == "key") && f.Type != secretType {
+				t.Errorf("Expected %s.%s to be a Secret", typ.Name(), f.Name)
+			}
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	cfg := &APIConfig{}
+	cfg.setSource("walletsecret", SourceFile)
+	cfg.setSource("endpoint", SourceFile)
+	cfg.WalletSecret = "leaked-wallet-secret"
+
+	fields := make(map[string]Field)
+	for _, f := range cfg.Describe() {
+		fields[f.Name] = f
+	}
+	if f := fields["WalletSecret"]; !f.Set || !f.Secret || f.Source != SourceFile {
+		t.Error("Expected the secret to be set from the file", f)
+	}
+	if f := fields["Endpoint"]; f.Set || f.Value != nil || f.Source != SourceFile {
+		t.Error("Expected an empty field set from the file not to be set", f)
+	}
+	if f := fields["LBDAPIEndpoint"]; f.Set || f.Source != SourceDefault {
+		t.Error("Expected an unset field to be left at its default", f)
+	}
+	if _, ok := fields["sources"]; ok {
+		t.Error("Expected unexported fields to be left out")
+	}
+
+	data, err := json.Marshal(cfg.Describe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "leaked") {
+		t.Error("Expected the secrets to be masked", string(data))
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var (
+	hexIDPattern         = regexp.MustCompile(`^[0-9a-f]{8}$`)
+	walletAddressPattern = regexp.MustCompile(`^t?link1[02-9ac-hj-np-z]{38}$`)
+)
+
+// FieldError is a problem with a config field, or with the variable or flag
+// setting it.
+type FieldError struct {
+	Field   string
+	Problem string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+// ValidationError lists every problem found in a config.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	lines := []string{"invalid config:"}
+	for _, fieldErr := range e {
+		lines = append(lines, "  "+fieldErr.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks that c has what the server needs to start: the endpoints,
+// keys and service wallet, and well-formed contract IDs and token types. It
+// returns a ValidationError listing every problem found.
+func (c *APIConfig) Validate() error {
+	errs := ValidationError{}
+	report := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	for _, endpoint := range []struct {
+		field    string
+		value    string
+		required bool
+	}{
+		{"LBDAPIEndpoint", c.LBDAPIEndpoint, true},
+		{"Endpoint", c.Endpoint, true},
+		{"LINEAPIEndpoint", c.LINEAPIEndpoint, false},
+		{"LINEAccessEndpoint", c.LINEAccessEndpoint, false},
+	} {
+		if endpoint.value == "" {
+			if endpoint.required {
+				report(endpoint.field, "required")
+			}
+			continue
+		}
+		if u, err := url.Parse(endpoint.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			report(endpoint.field, "%q is not an http or https URL", endpoint.value)
+		}
+	}
+
+	for _, required := range []struct {
+		field string
+		value string
+	}{
+		{"APIKey", c.APIKey},
+		{"APISecret", c.APISecret.Reveal()},
+		{"WalletSecret", c.WalletSecret.Reveal()},
+	} {
+		if required.value == "" {
+			report(required.field, "required")
+		}
+	}
+
+	if c.WalletAddress == "" {
+		report("WalletAddress", "required")
+	} else if !walletAddressPattern.MatchString(c.WalletAddress) {
+		report("WalletAddress", "%q is not a link1 or tlink1 address", c.WalletAddress)
+	}
+
+	for _, id := range []struct {
+		field  string
+		value  string
+		prefix string
+		kind   string
+	}{
+		{"ServiceContractID", c.ServiceContractID, "", "contract ID"},
+		{"ItemContractID", c.ItemContractID, "", "contract ID"},
+		{"FungibleTokenType", c.FungibleTokenType, "0", "fungible token type"},
+		{"NonFungibleTokenType", c.NonFungibleTokenType, "1", "non-fungible token type"},
+	} {
+		switch {
+		case id.value == "":
+			report(id.field, "required")
+		case !hexIDPattern.MatchString(id.value):
+			report(id.field, "%q is not 8 lowercase hex digits", id.value)
+		case !strings.HasPrefix(id.value, id.prefix):
+			report(id.field, "%q is not a %s, which starts with %s", id.value, id.kind, id.prefix)
+		}
+	}
+
+	switch c.LBDTransportMode {
+	case "":
+	case "record", "replay":
+		if c.LBDCassettePath == "" {
+			report("LBDCassettePath", "required to %s LBD traffic", c.LBDTransportMode)
+		}
+	default:
+		report("LBDTransportMode", "%q is not record or replay", c.LBDTransportMode)
+	}
+
+	v := reflect.ValueOf(*c)
+	for _, f := range settings() {
+		if value := v.FieldByName(f.Name); value.Kind() == reflect.Int && value.Int() < 0 {
+			report(f.Name, "%d is negative", value.Int())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
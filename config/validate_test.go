@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := APIConfig{
+		LBDAPIEndpoint:       "https://test-api.blockchain.line.me",
+		Endpoint:             "http://localhost:8080",
+		WalletAddress:        "tlink1fr9mpexk5yq3hu6jc0npajfsa0x7tl427fuveq",
+		WalletSecret:         "wallet-secret",
+		APIKey:               "api-key",
+		APISecret:            "api-secret",
+		ServiceContractID:    "9636a07e",
+		ItemContractID:       "61e14383",
+		FungibleTokenType:    "00000001",
+		NonFungibleTokenType: "10000001",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatal("Expected the config to be valid", err)
+	}
+
+	invalid := valid
+	invalid.LBDAPIEndpoint = ""
+	invalid.Endpoint = "localhost:8080"
+	invalid.WalletAddress = "tlink1servicewallet"
+	invalid.APISecret = ""
+	invalid.ItemContractID = "61E14383"
+	invalid.FungibleTokenType = "10000001"
+	invalid.LBDTransportMode = "record"
+	invalid.SeatHoldSeconds = -1
+	err := invalid.Validate()
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatal("Expected the config to be refused", err)
+	}
+	fields := make([]string, 0)
+	for _, fieldErr := range errs {
+		fields = append(fields, fieldErr.Field)
+	}
+	expected := "LBDAPIEndpoint Endpoint APISecret WalletAddress ItemContractID FungibleTokenType LBDCassettePath SeatHoldSeconds"
+	if strings.Join(fields, " ") != expected {
+		t.Error("Expected every problem to be reported", err)
+	}
+	if !strings.HasPrefix(err.Error(), "invalid config:\n  LBDAPIEndpoint: required\n") {
+		t.Error("Expected a report of the problems", err)
+	}
+}
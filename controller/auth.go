@@ -0,0 +1,106 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/api"
+	"link/cinema/auth"
+	"link/cinema/config"
+	"link/cinema/service"
+	"net/http"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	sessionLogin = "login"
+
+	userKey = "user"
+)
+
+// Authenticate resolves the user a request acts on, and their role, from
+// the X-API-Key header or the login session, and refuses the request when
+// neither names one. Without a LINE Login channel configured, requests
+// without an API key act on the configured UserID, unless in production.
+func (ctr *Controller) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.GetAPIConfig()
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			apiKey := auth.FindAPIKey(cfg, key)
+			if apiKey == nil {
+				c.String(http.StatusUnauthorized, "Invalid API key")
+				c.Abort()
+				return
+			}
+			c.Set(userKey, api.UserProfile{
+				DisplayName: apiKey.Name,
+				UserID:      apiKey.UserID,
+				Role:        apiKey.Role,
+			})
+			c.Next()
+			return
+		}
+
+		if !ctr.login.Enabled() && !cfg.Production {
+			c.Set(userKey, api.UserProfile{
+				UserID: cfg.UserID,
+				Role:   string(auth.UserRole(cfg, cfg.UserID)),
+			})
+			c.Next()
+			return
+		}
+
+		session := currentSession(c)
+		if session == nil || session.UserID == "" {
+			c.String(http.StatusUnauthorized, ErrInvalidAccessToken)
+			c.Abort()
+			return
+		}
+		if err := service.TouchSession(session); err != nil {
+			respondError(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(userKey, api.UserProfile{
+			DisplayName: session.DisplayName,
+			UserID:      session.UserID,
+			Role:        string(auth.UserRole(cfg, session.UserID)),
+		})
+		c.Next()
+	}
+}
+
+// RequireRole refuses requests of users without role. It goes after
+// Authenticate.
+func RequireRole(role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.Role(currentUser(c).Role).Includes(role) {
+			c.String(http.StatusForbidden, "Requires the %s role", role)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentUser returns the user resolved by Authenticate.
+func currentUser(c *gin.Context) api.UserProfile {
+	if profile, ok := c.Get(userKey); ok {
+		return profile.(api.UserProfile)
+	}
+	return api.UserProfile{}
+}
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"link/cinema/api"
+	"link/cinema/auth"
+	"link/cinema/config"
+	"link/cinema/linefake"
+	"link/cinema/service"
+	"link/cinema/store"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogin(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	service.SetStore(db)
+	defer service.SetStore(nil)
+
+	const userID = "U0000000000000000000000000000002"
+	fake := linefake.New(linefake.Config{
+		ChannelID:     "1234567890",
+		ChannelSecret: "channel-secret",
+		UserID:        userID,
+	})
+	lineServer := httptest.NewServer(fake)
+	defer lineServer.Close()
+	fake.SetEndpoint(lineServer.URL)
+
+	saved := config.GetAPIConfig()
+	defer config.SetAPIConfig(saved)
+	config.SetAPIConfig(&config.APIConfig{
+		LINEAccessEndpoint: lineServer.URL,
+		LINEAPIEndpoint:    lineServer.URL,
+		Endpoint:           "http://cinema.example",
+		ChannelID:          "1234567890",
+		ChannelSecret:      "channel-secret",
+		UserID:             "configured-user",
+		APIKeys: []config.APIKey{
+			{Name: "admin", Key: "admin-key-0123456789", Role: "admin"},
+		},
+	})
+
+	gin.SetMode(gin.TestMode)
+	ctr := NewController()
+	r := gin.New()
+	r.Use(Sessions())
+	r.GET("/api/v0/user/login", ctr.LINELogin)
+	r.GET("/api/v0/user/login/callback", ctr.LINELoginCallback)
+	r.POST("/api/v0/user/logout", ctr.Logout)
+	r.DELETE("/api/v0/admin/users/:userId/sessions", ctr.Authenticate(), ctr.RevokeSessions)
+	r.GET("/api/v0/user/profile", ctr.Authenticate(), ctr.GetProfile)
+
+	sendMethod := func(method, target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	send := func(target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		return sendMethod("GET", target, cookies)
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	// login returns the callback LINE redirects to and the session cookies.
+	login := func() (string, []*http.Cookie) {
+		w := send("/api/v0/user/login", nil)
+		authorizeURL := ""
+		if err := json.Unmarshal(w.Body.Bytes(), &authorizeURL); err != nil {
+			t.Fatal(w.Body.String(), err)
+		}
+		resp, err := noRedirect.Get(authorizeURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return strings.TrimPrefix(resp.Header.Get("Location"), "http://cinema.example"), w.Result().Cookies()
+	}
+
+	if w := send("/api/v0/user/profile", nil); w.Code != http.StatusUnauthorized {
+		t.Error("Expected a request without login to be refused", w.Code)
+	}
+
+	callback, cookies := login()
+	if w := send(callback, nil); w.Code != http.StatusBadRequest {
+		t.Error("Expected a callback without the login session to be refused", w.Code)
+	}
+	forged := strings.Replace(callback, "state=", "state=x", 1)
+	if w := send(forged, cookies); w.Code != http.StatusBadRequest {
+		t.Error("Expected a forged state to be refused", w.Code)
+	}
+
+	callback, anonymous := login()
+	w := send(callback, anonymous)
+	if w.Code != http.StatusFound {
+		t.Fatal("Expected the login to complete", w.Code, w.Body.String())
+	}
+	cookies = w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == anonymous[0].Value || !cookies[0].HttpOnly {
+		t.Fatal("Expected the session to get a new ID", cookies)
+	}
+	w = send("/api/v0/user/profile", cookies)
+	profile := api.UserProfile{}
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil || profile.UserID != userID {
+		t.Error("Expected the logged-in user", w.Body.String(), err)
+	}
+	if w := send("/api/v0/user/profile", anonymous); w.Code != http.StatusUnauthorized {
+		t.Error("Expected the session ID before the login not to be logged in", w.Code)
+	}
+	tampered := *cookies[0]
+	tampered.Value = strings.SplitN(tampered.Value, ".", 2)[0] + ".forged"
+	if w := send("/api/v0/user/profile", []*http.Cookie{&tampered}); w.Code != http.StatusUnauthorized {
+		t.Error("Expected a badly signed cookie to be ignored", w.Code)
+	}
+
+	if w := sendMethod("POST", "/api/v0/user/logout", cookies); w.Code != http.StatusNoContent {
+		t.Error("Expected a logout", w.Code)
+	}
+	if w := send("/api/v0/user/profile", cookies); w.Code != http.StatusUnauthorized {
+		t.Error("Expected the session to end at logout", w.Code)
+	}
+
+	// the user is logged in twice, and both sessions are revoked
+	sessions := make([][]*http.Cookie, 0)
+	for i := 0; i < 2; i++ {
+		callback, cookies := login()
+		sessions = append(sessions, send(callback, cookies).Result().Cookies())
+	}
+	if w := sendMethod("DELETE", "/api/v0/admin/users/other-user/sessions", sessions[0]); w.Code != http.StatusForbidden {
+		t.Error("Expected a customer not to revoke the sessions of another user", w.Code)
+	}
+	req := httptest.NewRequest("DELETE", "/api/v0/admin/users/"+userID+"/sessions", nil)
+	req.Header.Set(APIKeyHeader, "admin-key-0123456789")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	revocation := SessionRevocation{}
+	if err := json.Unmarshal(w.Body.Bytes(), &revocation); err != nil || revocation.Revoked != 2 {
+		t.Error("Expected two sessions to be revoked", w.Body.String(), err)
+	}
+	for _, cookies := range sessions {
+		if w := send("/api/v0/user/profile", cookies); w.Code != http.StatusUnauthorized {
+			t.Error("Expected a revoked session not to be logged in", w.Code)
+		}
+	}
+
+	callback, cookies = login()
+	query, _ := url.ParseQuery(strings.SplitN(callback, "?", 2)[1])
+	denied := "/api/v0/user/login/callback?error=access_denied&state=" + url.QueryEscape(query.Get("state"))
+	if w := send(denied, cookies); w.Code != http.StatusUnauthorized {
+		t.Error("Expected a denied login to be refused", w.Code)
+	}
+
+	// without a channel, requests act on the configured user
+	config.SetAPIConfig(&config.APIConfig{UserID: "configured-user"})
+	ctr = NewController()
+	r = gin.New()
+	r.Use(Sessions())
+	r.GET("/api/v0/user/profile", ctr.Authenticate(), ctr.GetProfile)
+	w = send("/api/v0/user/profile", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil || profile.UserID != "configured-user" {
+		t.Error("Expected the configured user", w.Body.String(), err)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	saved := config.GetAPIConfig()
+	defer config.SetAPIConfig(saved)
+	cfg := &config.APIConfig{
+		UserID: "configured-user",
+		APIKeys: []config.APIKey{
+			{Name: "scanner", Key: "scanner-key-0123456789", Role: "staff"},
+		},
+	}
+	config.SetAPIConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	ctr := NewController()
+	r := gin.New()
+	r.Use(Sessions())
+	r.GET("/customer", ctr.Authenticate(), ctr.GetProfile)
+	r.GET("/staff", ctr.Authenticate(), RequireRole(auth.RoleStaff), ctr.GetProfile)
+
+	send := func(target, key string) int {
+		req := httptest.NewRequest("GET", target, nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("/customer", ""); code != http.StatusOK {
+		t.Error("Expected the configured user to be a customer", code)
+	}
+	if code := send("/staff", ""); code != http.StatusForbidden {
+		t.Error("Expected a customer to be refused", code)
+	}
+	if code := send("/staff", "scanner-key-0123456789"); code != http.StatusOK {
+		t.Error("Expected the staff key to be accepted", code)
+	}
+	if code := send("/customer", "wrong-key-0123456789"); code != http.StatusUnauthorized {
+		t.Error("Expected a wrong key to be refused", code)
+	}
+
+	cfg.UserRoles = map[string]string{"configured-user": "admin"}
+	if code := send("/staff", ""); code != http.StatusOK {
+		t.Error("Expected an admin to be staff too", code)
+	}
+
+	// production servers do not fall back to the configured user
+	cfg.Production = true
+	if code := send("/customer", ""); code != http.StatusUnauthorized {
+		t.Error("Expected the configured user not to be used in production", code)
+	}
+	if code := send("/staff", "scanner-key-0123456789"); code != http.StatusOK {
+		t.Error("Expected the staff key to be accepted in production", code)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/service"
+)
+
+//@Summary List movies
+//@Description Retrieve the movies of the catalog
+//@Tags catalog
+//@Accept json
+//@Produce json
+//@Success 200 {array} service.Movie "Movies"
+//@Failure 500 {string} string "Internal server error"
+//@Router /movies [get]
+func (ctr *Controller) GetMovies(c *gin.Context) {
+	movies, err := service.ListMovies()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, movies)
+}
+
+//@Summary List showtimes of a movie
+//@Description Retrieve the showtimes of a movie, earliest first. A showtime ID is passed to GET /ticket to buy a ticket of it.
+//@Tags catalog
+//@Accept json
+//@Produce json
+//@Param id path string true "Movie ID"
+//@Success 200 {array} service.Showtime "Showtimes of the movie"
+//@Failure 404 {string} string "Movie not found"
+//@Failure 500 {string} string "Internal server error"
+//@Router /movies/{id}/showtimes [get]
+func (ctr *Controller) GetShowtimes(c *gin.Context) {
+	movie, err := service.GetMovie(c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if movie == nil {
+		c.String(404, "Movie not found")
+		return
+	}
+
+	showtimes, err := service.ListShowtimes(movie.ID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, showtimes)
+}
+
+//@Summary Get the seats of a showtime
+//@Description Retrieve the seats of a showtime, row by row, with whether each is available, held for a purchase or sold
+//@Tags catalog
+//@Accept json
+//@Produce json
+//@Param id path string true "Showtime ID"
+//@Success 200 {array} service.SeatStatus "Seats of the showtime"
+//@Failure 404 {string} string "Showtime not found"
+//@Failure 500 {string} string "Internal server error"
+//@Router /showtimes/{id}/seats [get]
+func (ctr *Controller) GetSeats(c *gin.Context) {
+	seats, err := service.SeatMap(c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, seats)
+}
+
+//@Summary List theaters
+//@Description Retrieve the theaters of the catalog with their screens
+//@Tags catalog
+//@Accept json
+//@Produce json
+//@Success 200 {array} service.Theater "Theaters"
+//@Failure 500 {string} string "Internal server error"
+//@Router /theaters [get]
+func (ctr *Controller) GetTheaters(c *gin.Context) {
+	theaters, err := service.ListTheaters()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, theaters)
+}
+
+//@Summary Put a movie
+//@Description Add a movie to the catalog or replace it
+//@Tags admin
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param id path string true "Movie ID"
+//@Param movie body service.Movie true "Movie"
+//@Success 200 {object} service.Movie "Movie put"
+//@Failure 400 {string} string "Invalid movie"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
+//@Failure 500 {string} string "Internal server error"
+//@Router /admin/movies/{id} [put]
+func (ctr *Controller) PutMovie(c *gin.Context) {
+	movie := &service.Movie{}
+	if err := c.ShouldBindJSON(movie); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	movie.ID = c.Param("id")
+
+	if err := service.PutMovie(movie); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, movie)
+}
+
+//@Summary Delete a movie
+//@Description Remove a movie no showtime is scheduled for from the catalog
+//@Tags admin
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param id path string true "Movie ID"
+//@Success 204 "Movie deleted"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
+//@Failure 404 {string} string "Movie not found"
+//@Failure 409 {string} string "Movie has showtimes"
+//@Failure 500 {string} string "Internal server error"
+//@Router /admin/movies/{id} [delete]
+func (ctr *Controller) DeleteMovie(c *gin.Context) {
+	if err := service.DeleteMovie(c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(204)
+}
+
+//@Summary Put a theater
+//@Description Add a theater with its screens to the catalog or replace it
+//@Tags admin
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param id path string true "Theater ID"
+//@Param theater body service.Theater true "Theater"
+//@Success 200 {object} service.Theater "Theater put"
+//@Failure 400 {string} string "Invalid theater"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
+//@Failure 409 {string} string "Dropped screen has showtimes"
+//@Failure 500 {string} string "Internal server error"
+//@Router /admin/theaters/{id} [put]
+func (ctr *Controller) PutTheater(c *gin.Context) {
+	theater := &service.Theater{}
+	if err := c.ShouldBindJSON(theater); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	theater.ID = c.Param("id")
+
+	if err := service.PutTheater(theater); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, theater)
+}
+
+//@Summary Delete a theater
+//@Description Remove a theater no showtime is scheduled in from the catalog
+//@Tags admin
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param id path string true "Theater ID"
+//@Success 204 "Theater deleted"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
+//@Failure 404 {string} string "Theater not found"
+//@Failure 409 {string} string "Theater has showtimes"
+//@Failure 500 {string} string "Internal server error"
+//@Router /admin/theaters/{id} [delete]
+func (ctr *Controller) DeleteTheater(c *gin.Context) {
+	if err := service.DeleteTheater(c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(204)
+}
+
+//@Summary Put a showtime
+//@Description Schedule a showtime of a movie on a screen of a theater, or replace it
+//@Tags admin
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param id path string true "Showtime ID"
+//@Param showtime body service.Showtime true "Showtime"
+//@Success 200 {object} service.Showtime "Showtime put"
+//@Failure 400 {string} string "Invalid showtime, or movie, theater or screen not in the catalog"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
+//@Failure 500 {string} string "Internal server error"
+//@Router /admin/showtimes/{id} [put]
+func (ctr *Controller) PutShowtime(c *gin.Context) {
+	showtime := &service.Showtime{}
+	if err := c.ShouldBindJSON(showtime); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	showtime.ID = c.Param("id")
+
+	if err := service.PutShowtime(showtime); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, showtime)
+}
+
+//@Summary Delete a showtime
+//@Description Remove a showtime with no seat sold or held from the catalog, with its seats
+//@Tags admin
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param id path string true "Showtime ID"
+//@Success 204 "Showtime deleted"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
+//@Failure 404 {string} string "Showtime not found"
+//@Failure 409 {string} string "Showtime has sold or held seats"
+//@Failure 500 {string} string "Internal server error"
+//@Router /admin/showtimes/{id} [delete]
+func (ctr *Controller) DeleteShowtime(c *gin.Context) {
+	if err := service.DeleteShowtime(c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(204)
+}
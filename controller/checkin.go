@@ -0,0 +1,87 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/service"
+)
+
+// CheckInRequest names the user showing a ticket at the gate.
+type CheckInRequest struct {
+	UserID string `json:"userId"`
+}
+
+//@Summary Check in a movie ticket
+//@Description Admit the holder of a movie ticket at the theater gate. The ticket must be owned by the user and its showtime open for check-in.
+//@Description The ticket is marked used in its metadata, and a second check-in is refused. The check-in is dropped when the transaction marking the ticket fails.
+//@Tags ticket
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param tokenId path string true "Token ID of the movie ticket"
+//@Param holder body CheckInRequest true "User showing the ticket"
+//@Success 200 {object} service.CheckIn "Check-in"
+//@Failure 400 {string} string "Missing user, or not a movie ticket"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the staff role, or ticket not owned by the user, or check-in not open"
+//@Failure 409 {string} string "Ticket already checked in, or transaction marking it used failed"
+//@Failure 500 {string} string "Internal server error"
+//@Failure 504 {string} string "Transaction marking the ticket used not included in time"
+//@Router /ticket/check-in/{tokenId} [post]
+func (ctr *Controller) CheckInTicket(c *gin.Context) {
+	ctx := c.Request.Context()
+	// the staff member checks in the ticket of someone else
+	req := CheckInRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" {
+		c.String(400, "Missing user ID")
+		return
+	}
+
+	checkIn, err := service.CheckInTicket(ctx, req.UserID, c.Param("tokenId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, checkIn)
+}
+
+//@Summary Get the check-in of a movie ticket
+//@Description Retrieve when and where a movie ticket was checked in
+//@Tags ticket
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Param tokenId path string true "Token ID of the movie ticket"
+//@Success 200 {object} service.CheckIn "Check-in"
+//@Failure 400 {string} string "Not a movie ticket"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the staff role"
+//@Failure 404 {string} string "Ticket not checked in"
+//@Failure 500 {string} string "Internal server error"
+//@Router /ticket/check-in/{tokenId} [get]
+func (ctr *Controller) GetCheckIn(c *gin.Context) {
+	checkIn, err := service.GetCheckIn(c.Request.Context(), c.Param("tokenId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if checkIn == nil {
+		c.String(404, "Ticket not checked in")
+		return
+	}
+	c.JSON(200, checkIn)
+}
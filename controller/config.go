@@ -0,0 +1,36 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/config"
+)
+
+//@Summary Describe the config
+//@Description List the config fields with whether each is set and where it was set: left at its default, or in the config file, an environment variable or a flag.
+//@Description Values of unset fields are left out and secrets are masked.
+//@Tags admin
+//@Accept json
+//@Produce json
+//@Security ApiKeyAuth
+//@Success 200 {array} config.Field "Config fields"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the admin role"
+//@Router /admin/config [get]
+func (ctr *Controller) DescribeConfig(c *gin.Context) {
+	c.JSON(200, config.GetAPIConfig().Describe())
+}
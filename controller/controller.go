@@ -15,11 +15,25 @@ under the License
 */
 package controller
 
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"link/cinema/api"
+	"link/cinema/auth"
+	"link/cinema/config"
+	"link/cinema/service"
+	"net/http"
+	"strconv"
+)
+
 type Controller struct {
+	login *auth.LINELogin
 }
 
 func NewController() *Controller {
-	return &Controller{}
+	return &Controller{
+		login: auth.NewLINELogin(config.GetAPIConfig(), nil, nil),
+	}
 }
 
 const (
@@ -27,4 +41,87 @@ const (
 	ErrInvalidAccessToken = "Invalid access token, please try login again"
 )
 
-type TransactionHashes []string
\ No newline at end of file
+type TransactionHashes []string
+
+// respondError writes err as plain text with a status matching its cause.
+func respondError(c *gin.Context, err error) {
+	c.String(errorStatus(err), err.Error())
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidParam), errors.Is(err, service.ErrInvalidCursor), errors.Is(err, service.ErrInvalidQuote),
+		errors.Is(err, service.ErrInvalidCatalog), errors.Is(err, service.ErrUnknownSeat),
+		errors.Is(err, service.ErrInvalidCart), errors.Is(err, auth.ErrInvalidState):
+		return http.StatusBadRequest
+	case errors.Is(err, api.ErrNotFound), errors.Is(err, service.ErrNotInCatalog), errors.Is(err, service.ErrPurchaseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrLoginDenied), errors.Is(err, auth.ErrInvalidIDToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrTokenExchange):
+		return http.StatusBadGateway
+	case errors.Is(err, service.ErrNotTicketOwner), errors.Is(err, service.ErrCheckInClosed):
+		return http.StatusForbidden
+	case errors.Is(err, api.ErrInsufficientBalance):
+		return http.StatusPaymentRequired
+	case errors.Is(err, api.ErrSessionTokenExpired), errors.Is(err, service.ErrQuoteExpired):
+		return http.StatusGone
+	case errors.Is(err, api.ErrInvalidSignature):
+		return http.StatusBadGateway
+	case errors.Is(err, api.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, service.ErrTxTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, service.ErrPurchaseInProgress):
+		return http.StatusAccepted
+	case errors.Is(err, service.ErrPurchaseFailed):
+		return http.StatusInternalServerError
+	case errors.Is(err, service.ErrIdempotencyConflict), errors.Is(err, service.ErrIdempotencyInProgress),
+		errors.Is(err, service.ErrCatalogInUse), errors.Is(err, service.ErrSeatTaken),
+		errors.Is(err, service.ErrAlreadyCheckedIn):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrNoStore):
+		return http.StatusServiceUnavailable
+	}
+
+	var txErr *service.TxFailedError
+	if errors.As(err, &txErr) {
+		return http.StatusConflict
+	}
+
+	if apiErr, ok := api.AsError(err); ok {
+		switch {
+		case apiErr.Retryable:
+			return http.StatusServiceUnavailable
+		case apiErr.HTTPStatus == http.StatusUnauthorized || apiErr.HTTPStatus == http.StatusForbidden:
+			return http.StatusBadGateway
+		case apiErr.HTTPStatus >= 400 && apiErr.HTTPStatus < 500:
+			return http.StatusBadRequest
+		}
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// waitRequested reports whether the request asked with ?wait=true to wait
+// until its transactions are included in a block.
+func waitRequested(c *gin.Context) (bool, error) {
+	wait := c.Query("wait")
+	if wait == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(wait)
+}
+
+// confirm waits for tx when wait is set. On failure it writes the error
+// and returns false.
+func confirm(c *gin.Context, wait bool, tx *service.TransactionAccepted) bool {
+	if !wait {
+		return true
+	}
+	if _, err := service.WaitForTx(c.Request.Context(), tx.TxHash, service.DefaultWaitTimeout); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
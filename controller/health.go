@@ -0,0 +1,59 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/api"
+	"net/http"
+)
+
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+)
+
+type HealthStatus struct {
+	Status   string                      `json:"status"`
+	Breakers map[string]api.BreakerState `json:"breakers"`
+}
+
+//@Summary Show health
+//@Description Show circuit breaker state of each LBD endpoint group
+//@Tags health
+//@Accept json
+//@Produce json
+//@Success 200 {object} HealthStatus "Every endpoint group is healthy"
+//@Failure 503 {object} HealthStatus "Some endpoint groups are failing fast"
+//@Router /health [get]
+func (ctr *Controller) Health(c *gin.Context) {
+	resp := HealthStatus{
+		Status:   healthOK,
+		Breakers: api.FromContext(c.Request.Context()).BreakerStates(),
+	}
+
+	for _, breaker := range resp.Breakers {
+		if breaker.State != api.BreakerClosed {
+			resp.Status = healthDegraded
+		}
+	}
+
+	if resp.Status != healthOK {
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
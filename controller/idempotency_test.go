@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/service"
+	"link/cinema/store"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIdempotent(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	service.SetStore(db)
+	defer service.SetStore(nil)
+
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	r := gin.New()
+	r.POST("/mutate", Idempotent(), func(c *gin.Context) {
+		calls++
+		c.String(200, strconv.Itoa(calls))
+	})
+	r.POST("/fail", Idempotent(), func(c *gin.Context) {
+		calls++
+		c.String(500, "failed")
+	})
+
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("/mutate", "key-1", "{}")
+	replay := send("/mutate", "key-1", "{}")
+	if first.Code != 200 || replay.Code != 200 || replay.Body.String() != first.Body.String() || calls != 1 {
+		t.Error("Expected the response to be replayed", first.Body.String(), replay.Body.String(), calls)
+	}
+	if replay.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("Expected the replay to be marked")
+	}
+
+	if w := send("/mutate", "key-1", `{"other":true}`); w.Code != http.StatusConflict {
+		t.Error("Expected a conflict", w.Code)
+	}
+	if w := send("/mutate", "", "{}"); w.Body.String() != "2" {
+		t.Error("Expected a request without a key to run", w.Body.String())
+	}
+
+	send("/fail", "key-2", "{}")
+	send("/fail", "key-2", "{}")
+	if calls != 4 {
+		t.Error("Expected failed requests to run again", calls)
+	}
+}
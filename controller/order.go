@@ -0,0 +1,85 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/service"
+	"strconv"
+)
+
+const (
+	maxOrderLimit = 100
+)
+
+//@Summary List orders
+//@Description Retrieve the ticket orders of the user, newest first
+//@Tags order
+//@Accept json
+//@Produce json
+//@Param limit query int false "Maximum number of orders"
+//@Param cursor query string false "Cursor returned as nextCursor by the previous request"
+//@Success 200 {object} service.OrderPage "Orders of the user"
+//@Failure 400 {string} string "Invalid limit or cursor"
+//@Failure 500 {string} string "Internal server error"
+//@Router /orders [get]
+func (ctr *Controller) GetOrders(c *gin.Context) {
+	userID := currentUser(c).UserID
+
+	limit := service.DefaultOrderPageSize
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxOrderLimit {
+			c.String(400, "Invalid limit: "+value)
+			return
+		}
+		limit = n
+	}
+
+	orders, err := service.ListOrders(userID, limit, c.Query("cursor"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(200, orders)
+}
+
+//@Summary Get an order
+//@Description Retrieve a ticket order with its transactions and status timeline
+//@Tags order
+//@Accept json
+//@Produce json
+//@Param id path string true "Order ID"
+//@Success 200 {object} service.Order "Order with the provided ID"
+//@Failure 404 {string} string "Order not found"
+//@Failure 500 {string} string "Internal server error"
+//@Router /orders/{id} [get]
+func (ctr *Controller) GetOrder(c *gin.Context) {
+	userID := currentUser(c).UserID
+
+	order, err := service.GetOrder(c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if order == nil || order.UserID != userID {
+		c.String(404, "Order not found")
+		return
+	}
+
+	c.JSON(200, order)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"link/cinema/auth"
+	"link/cinema/config"
+	"link/cinema/service"
+	"net/http"
+	"strings"
+)
+
+const (
+	SessionCookie = "session"
+
+	sessionKey = "session"
+)
+
+// Sessions loads the session named by the session cookie of a request.
+// Handlers get it with currentSession and keep changes with saveSession.
+func Sessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id, ok := readSessionCookie(c); ok {
+			session, err := service.GetSession(c.Request.Context(), id)
+			if err != nil && !errors.Is(err, service.ErrNoStore) {
+				respondError(c, err)
+				c.Abort()
+				return
+			}
+			if session != nil {
+				c.Set(sessionKey, session)
+			}
+		}
+		c.Next()
+	}
+}
+
+// currentSession returns the session of the request, or nil when it has
+// none.
+func currentSession(c *gin.Context) *service.Session {
+	if session, ok := c.Get(sessionKey); ok {
+		return session.(*service.Session)
+	}
+	return nil
+}
+
+// startSession returns the session of the request, or a new one.
+func startSession(c *gin.Context) (*service.Session, error) {
+	if session := currentSession(c); session != nil {
+		return session, nil
+	}
+	session, err := service.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	c.Set(sessionKey, session)
+	return session, nil
+}
+
+// saveSession saves session and sets its cookie.
+func saveSession(c *gin.Context, session *service.Session) error {
+	if err := service.SaveSession(session); err != nil {
+		return err
+	}
+	setSessionCookie(c, session)
+	return nil
+}
+
+// The cookie carries the session ID signed with the session key, so IDs
+// are checked before the store is looked up.
+func signSessionID(id string) string {
+	mac := hmac.New(sha256.New, auth.SessionKey(config.GetAPIConfig()))
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func readSessionCookie(c *gin.Context) (string, bool) {
+	value, err := c.Cookie(SessionCookie)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndex(value, ".")
+	if i < 0 || !hmac.Equal([]byte(signSessionID(value[:i])), []byte(value)) {
+		return "", false
+	}
+	return value[:i], true
+}
+
+func setSessionCookie(c *gin.Context, session *service.Session) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    signSessionID(session.ID),
+		Path:     "/",
+		Expires:  session.EndsAt(c.Request.Context()),
+		Secure:   strings.HasPrefix(config.GetAPIConfig().Endpoint, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSessionCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     SessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+//@Summary Log out
+//@Description End the session of the request. Nothing happens without one.
+//@Tags user
+//@Success 204 "Logged out"
+//@Failure 500 {string} string "Internal server error"
+//@Router /user/logout [post]
+func (ctr *Controller) Logout(c *gin.Context) {
+	if session := currentSession(c); session != nil {
+		if err := service.DeleteSession(session.ID); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	clearSessionCookie(c)
+	c.Status(204)
+}
+
+// SessionRevocation tells how many sessions of a user were ended.
+type SessionRevocation struct {
+	UserID  string `json:"userId"`
+	Revoked int    `json:"revoked"`
+}
+
+//@Summary Revoke the sessions of a user
+//@Description Log a user out of every session, e.g. when the account is compromised.
+//@Description Only admins may revoke the sessions of other users.
+//@Tags admin
+//@Produce json
+//@Security ApiKeyAuth
+//@Param userId path string true "User ID"
+//@Success 200 {object} SessionRevocation "Sessions revoked"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the admin role"
+//@Failure 500 {string} string "Internal server error"
+//@Router /admin/users/{userId}/sessions [delete]
+func (ctr *Controller) RevokeSessions(c *gin.Context) {
+	userID := c.Param("userId")
+	// checked here as well as on the route, so that no route can let anyone
+	// log any user out
+	if user := currentUser(c); !auth.Role(user.Role).Includes(auth.RoleAdmin) && (user.UserID == "" || user.UserID != userID) {
+		c.String(http.StatusForbidden, "Requires the %s role", auth.RoleAdmin)
+		return
+	}
+	revoked, err := service.RevokeUserSessions(userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, SessionRevocation{
+		UserID:  userID,
+		Revoked: revoked,
+	})
+}
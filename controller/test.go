@@ -27,50 +27,74 @@ import (
 //@Tags test
 //@Accept json
 //@Produce json
+//@Security ApiKeyAuth
 //@Param txhash query string true "Transaction hash used for searching"
 //@Success 200 {object} service.Transaction "Transaction with the provided hash"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
 //@Router /test/transaction [get]
 func (ctr *Controller) GetTransaction(c *gin.Context) {
+	ctx := c.Request.Context()
 	txHash := c.Query("txhash")
-	tx, _ := service.GetTransaction(txHash)
+	tx, _ := service.GetTransaction(ctx, txHash)
 
 	c.JSON(200, tx)
 }
 
 //@Summary Init asset for test user
-//@Description Transfer tokens to user
+//@Description Transfer tokens from the service wallet to the user, who must be an operator
 //@Tags test
 //@Accept json
 //@Produce json
+//@Security ApiKeyAuth
+//@Param Idempotency-Key header string false "Replays the original response to a request sent again with the same key"
+//@Param wait query bool false "Wait until the transactions are included in a block"
 //@Success 200 {array} string "transaction hashes has executed"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the operator role"
+//@Failure 409 {string} string "Transaction failed, or idempotency key used for a different request"
 //@Failure 500 {string} string "Internal server error"
+//@Failure 504 {string} string "Transaction not included in time"
 //@Router /test/init [get]
 func (ctr *Controller) InitUser(c *gin.Context) {
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
+	ctx := c.Request.Context()
+	wait, err := waitRequested(c)
+	if err != nil {
+		c.String(400, "Invalid wait param")
+		return
 	}
+	userProfile := currentUser(c)
 
 	txs := make([]string, 0)
 
-	cfg := config.GetAPIConfig()
+	cfg := api.FromContext(ctx).Config()
 
-	tx, err := service.TransferBaseCoin(userProfile.UserID, "100000000")
+	tx, err := service.TransferBaseCoin(ctx, userProfile.UserID, "100000000")
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
+	}
+	if !confirm(c, wait, tx) {
 		return
 	}
 	txs = append(txs, tx.TxHash)
 
-	tx, err = service.TransferServiceToken(userProfile.UserID, cfg.ServiceContractID, "10000000000")
+	tx, err = service.TransferServiceToken(ctx, userProfile.UserID, cfg.ServiceContractID, "10000000000")
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
+	}
+	if !confirm(c, wait, tx) {
 		return
 	}
 	txs = append(txs, tx.TxHash)
 
-	tx, err = service.MintFungible(userProfile.UserID, cfg.ItemContractID, cfg.FungibleTokenType, "10")
+	tx, err = service.MintFungible(ctx, userProfile.UserID, cfg.ItemContractID, cfg.FungibleTokenType, "10")
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
+	}
+	if !confirm(c, wait, tx) {
 		return
 	}
 	txs = append(txs, tx.TxHash)
@@ -79,11 +103,14 @@ func (ctr *Controller) InitUser(c *gin.Context) {
 }
 
 //@Summary Show a config
-//@Description Show a config
+//@Description Show a config, with its secrets masked
 //@Tags test
 //@Accept json
 //@Produce json
+//@Security ApiKeyAuth
 //@Success 200 {object} config.APIConfig "Server Configuration"
+//@Failure 401 {string} string "Not logged in"
+//@Failure 403 {string} string "Requires the admin role"
 //@Router /test/config [get]
 func (ctr *Controller) ShowConfig(c *gin.Context) {
 	c.JSON(200, config.GetAPIConfig())
@@ -16,14 +16,13 @@ under the License
 package controller
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"io/ioutil"
-	"link/cinema/api"
 	"link/cinema/config"
 	"link/cinema/service"
 	"math/big"
-	"strconv"
 	"time"
 )
 
@@ -32,213 +31,214 @@ var (
 	movieTokenNotUsed = "0"
 )
 
-func checkPrice(info service.PriceInfo) bool{
-	ticketPrice := service.DefaultTicket.Price
-
-	if info.SubTotal != ticketPrice {
-		return false
-	}
-
-	if info.UsedFungible < 0 || info.UsedFungible > 1 {
-		return false
-	}
-
-	if info.UsedServiceToken < 0 || info.UsedServiceToken > 1000 || info.UsedServiceToken % 1000 != 0{
-		return false
-	}
+type PurchaseRequest struct {
+	service.TransferRequestResult
+	OrderID string `json:"orderId"`
+}
 
-	discount := info.UsedServiceToken / 1000 + info.UsedFungible * 5
+// QuoteRequest names the quote issued by GET /ticket which a purchase is
+// made at.
+type QuoteRequest struct {
+	QuoteID string `json:"quoteId"`
+}
 
-	if -discount != info.Discount {
-		return false
+// bindQuote reads a QuoteRequest body and returns its quote, checked by
+// verify. On failure it writes the error and returns nil.
+func bindQuote(c *gin.Context, verify func(ctx context.Context, id, userID string) (*service.Quote, error)) *service.Quote {
+	req := QuoteRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.QuoteID == "" {
+		c.String(400, "Missing quote ID")
+		return nil
 	}
-
-	if ticketPrice - discount != info.GrandTotal {
-		return false
+	quote, err := verify(c.Request.Context(), req.QuoteID, currentUser(c).UserID)
+	if err != nil {
+		respondError(c, err)
+		return nil
 	}
-
-	return true
+	return quote
 }
 
 //@Summary Get a purchase info
-//@Description Retrieve a purchase info about given movie ticket
+//@Description Retrieve a purchase info about a ticket of the given showtime, priced for the user's balances.
+//@Description The quote ID signs the price and is sent back to purchase the ticket at that price before the quote expires.
 //@Tags ticket
 //@Accept json
 //@Produce json
-//@Success 200 {object} service.PurchaseInfo "Ticket info"
+//@Param showtimeId query string false "Showtime of the ticket, the earliest one by default"
+//@Param seat query []string false "Seats of the tickets, one ticket at the first available seat by default" collectionFormat(multi)
+//@Success 200 {object} service.Quote "Ticket info and price quote"
+//@Failure 400 {string} string "No such seat"
+//@Failure 404 {string} string "Showtime not found"
+//@Failure 409 {string} string "Seat taken"
 //@Failure 500 {string} string "Internal server error"
 //@Router /ticket [get]
 func (ctr *Controller) GetPurchaseInfo(c *gin.Context) {
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
-	}
+	ctx := c.Request.Context()
+	userProfile := currentUser(c)
 
-	serviceContractID := config.GetAPIConfig().ServiceContractID
-	itemContractID := config.GetAPIConfig().ItemContractID
-	tokenType := config.GetAPIConfig().FungibleTokenType
-
-	resp := service.PurchaseInfo{
-		MovieInfo:  service.DefaultMovie,
-		TicketInfo: service.DefaultTicket,
-		PriceInfo:  service.PriceInfo{},
+	tickets := make([]service.CartTicket, 0)
+	for _, seat := range c.QueryArray("seat") {
+		tickets = append(tickets, service.CartTicket{Sit: seat})
 	}
 
-	fungibleBalance, err := service.GetFungibleBalance(userProfile.UserID, itemContractID, tokenType)
-
-	discount := 0
-
+	quote, err := service.IssueQuote(ctx, userProfile.UserID, c.Query("showtimeId"), tickets)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
-	fungibleAmt, err := strconv.Atoi(fungibleBalance.Amount)
-
-	if err != nil {
-		c.String(500, err.Error())
-		return
-	}
+	c.JSON(200, quote)
+}
 
-	//TODO make fungible ratio dynamic
-	fungibleRatio := 5
+// CartRequest is a group purchase of tickets of one showtime.
+type CartRequest struct {
+	ShowtimeID string               `json:"showtimeId"`
+	Tickets    []service.CartTicket `json:"tickets"`
+}
 
-	if fungibleAmt > 1 {
-		fungibleAmt = 1
+//@Summary Get a purchase info for a group
+//@Description Retrieve a purchase info about tickets of the given showtime, with one combined price for the user's balances.
+//@Description Each ticket is minted to its recipient, or to the user when none is given. Tickets without a seat get the first available ones.
+//@Description The quote ID is sent to /ticket/purchase like the one of GET /ticket.
+//@Tags ticket
+//@Accept json
+//@Produce json
+//@Param cart body CartRequest true "Showtime and tickets"
+//@Success 200 {object} service.Quote "Ticket info and price quote"
+//@Failure 400 {string} string "Invalid cart or no such seat"
+//@Failure 404 {string} string "Showtime or recipient not found"
+//@Failure 409 {string} string "Seat taken"
+//@Failure 500 {string} string "Internal server error"
+//@Router /ticket/cart [post]
+func (ctr *Controller) GetCartPurchaseInfo(c *gin.Context) {
+	ctx := c.Request.Context()
+	cart := CartRequest{}
+	if err := c.ShouldBindJSON(&cart); err != nil {
+		c.String(400, err.Error())
+		return
 	}
-	discount -= fungibleAmt * fungibleRatio
-
-	serviceTokenBalance, err := service.GetServiceTokenBalance(userProfile.UserID, serviceContractID)
 
+	quote, err := service.IssueQuote(ctx, currentUser(c).UserID, cart.ShowtimeID, cart.Tickets)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
-	//TODO make service ratio dynamic
-	serviceRatio := big.NewInt(1000)
-
-	serviceAmt, ok := new(big.Int).SetString(serviceTokenBalance.Amount, 10)
-	if !ok {
-		c.String(500, "Invalid movie token amount")
-	}
-
-	for i := 0; i < serviceTokenBalance.Decimals; i++ {
-		serviceAmt.Div(serviceAmt, big.NewInt(10))
-	}
-
-	serviceAmt.Div(serviceAmt, serviceRatio)
-	if serviceAmt.Cmp(big.NewInt(1)) == 1 {
-		serviceAmt = big.NewInt(1)
-	}
-
-	discount -= int(serviceAmt.Int64())
-
-	resp.PriceInfo = service.PriceInfo{
-		UsedFungible:     fungibleAmt,
-		UsedServiceToken: int(serviceAmt.Mul(serviceAmt, serviceRatio).Int64()),
-		SubTotal:         resp.TicketInfo.Price,
-		Discount:         discount,
-		GrandTotal:       resp.TicketInfo.Price + discount,
-	}
 
-	c.JSON(200, resp)
+	c.JSON(200, quote)
 }
 
 //@Summary Request user to purchase
-//@Description Request user to transfer token at LBW
+//@Description Request user to transfer token at LBW. The seats of the quote are held for the purchase until it is committed, or until the holds expire.
 //@Tags ticket
 //@Accept json
 //@Produce json
-//@Param purchase_info body service.PurchaseInfo true "Purchase info"
-//@Success 200 {object} service.TransferRequestResult "Session token and redirect url to transfer token"
+//@Param Idempotency-Key header string false "Replays the original response to a request sent again with the same key"
+//@Param quote body QuoteRequest true "Quote issued by GET /ticket"
+//@Success 200 {object} PurchaseRequest "Session token and redirect url to transfer token, and the ID of the order placed"
+//@Failure 400 {string} string "Missing or invalid quote"
+//@Failure 409 {string} string "Seat taken, or idempotency key used for a different request"
+//@Failure 410 {string} string "Quote expired"
 //@Failure 500 {string} string "Internal server error"
 //@Router /ticket/purchase [post]
 func (ctr *Controller) RequestTicketPurchasing(c *gin.Context) {
-	reqBody, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(500, err.Error())
-		return
-	}
-	purchaseInfo := &service.PurchaseInfo{}
-
-	if err := json.Unmarshal(reqBody, purchaseInfo); err != nil {
-		c.String(500, err.Error())
-		return
-	}
-
-	if !checkPrice(purchaseInfo.PriceInfo) {
-		c.String(500, "Invalid price info")
+	ctx := c.Request.Context()
+	quote := bindQuote(c, service.VerifyQuote)
+	if quote == nil {
 		return
 	}
 
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
-	}
+	userProfile := currentUser(c)
 
-	if purchaseInfo.PriceInfo.UsedFungible > 0 {
-		isApproved, err := service.GetProxySetting(userProfile.UserID, config.GetAPIConfig().ItemContractID)
+	if quote.PriceInfo.UsedFungible > 0 {
+		isApproved, err := service.GetProxySetting(ctx, userProfile.UserID, config.GetAPIConfig().ItemContractID)
 		if err != nil {
-			c.String(500, err.Error())
+			respondError(c, err)
 			return
 		}
 		if !isApproved {
-			c.String(500, "Cannot transfer movie-discount token without proxy setting")
+			c.String(400, "Cannot transfer movie-discount token without proxy setting")
 			return
 		}
 	}
 
-	amt := big.NewInt(int64(purchaseInfo.PriceInfo.GrandTotal))
+	amt := big.NewInt(int64(quote.PriceInfo.GrandTotal))
 	amt.Mul(amt, big.NewInt(1000000))
 
-	reqResult, err := service.RequestBaseCoinTransfer(userProfile.UserID, amt.String())
+	reqResult, err := service.RequestBaseCoinTransfer(ctx, userProfile.UserID, amt.String())
+
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if _, err := service.HoldSeats(ctx, quote.PurchaseInfo, userProfile.UserID, reqResult.RequestSessionToken); err != nil {
+		respondError(c, err)
+		return
+	}
 
+	order, err := service.CreateOrder(quote, reqResult.RequestSessionToken)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(200, reqResult)
+	c.JSON(200, PurchaseRequest{
+		TransferRequestResult: *reqResult,
+		OrderID:               order.ID,
+	})
 	//c.Redirect(http.StatusMovedPermanently, resp.RedirectURI)
 }
 
 //@Summary Request user to purchase extra token
-//@Description Request user to transfer movie-token used for discounting ticket price
+//@Description Request user to transfer movie-token used for discounting ticket price.
+//@Description The purchase of the quote is requested first, and its order then has to be committed with the session returned.
 //@Tags ticket
 //@Accept json
 //@Produce json
-//@Param purchase_info body service.PurchaseInfo true "Purchase info"
+//@Param Idempotency-Key header string false "Replays the original response to a request sent again with the same key"
+//@Param quote body QuoteRequest true "Quote issued by GET /ticket"
 //@Success 200 {object} service.TransferRequestResult "Session token and redirect url to transfer a token"
+//@Failure 400 {string} string "Missing or invalid quote, or purchase of the quote not requested"
+//@Failure 409 {string} string "Order already committed, or idempotency key used for a different request"
+//@Failure 410 {string} string "Quote expired"
 //@Failure 500 {string} string "Internal server error"
 //@Router /ticket/purchase/extra [post]
 func (ctr *Controller) RequestExtraPurchase(c *gin.Context) {
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
-	}
-
-	reqBody, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(500, err.Error())
-	}
-
-	purchaseInfo := &service.PurchaseInfo{}
-
-	if err := json.Unmarshal(reqBody, purchaseInfo); err != nil {
-		c.String(500, err.Error())
-		return
-	}
+	ctx := c.Request.Context()
+	userProfile := currentUser(c)
 
-	if !checkPrice(purchaseInfo.PriceInfo) {
-		c.String(500, "Invalid price info")
+	quote := bindQuote(c, service.VerifyQuote)
+	if quote == nil {
 		return
 	}
 
-	if purchaseInfo.PriceInfo.UsedServiceToken > 0 {
+	if quote.PriceInfo.UsedServiceToken > 0 {
+		order, err := service.GetOrderByQuote(quote.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if order == nil {
+			c.String(400, "Request the purchase of the quote first")
+			return
+		}
+		if order.PurchaseID != "" {
+			c.String(409, "Order already committed")
+			return
+		}
 
-		amount := big.NewInt(int64(purchaseInfo.PriceInfo.UsedServiceToken))
+		amount := big.NewInt(int64(quote.PriceInfo.UsedServiceToken))
 		amount.Mul(amount, big.NewInt(1000000))
-		txReqResult, err := service.RequestServiceTransfer(userProfile.UserID, config.GetAPIConfig().ServiceContractID, amount.String())
+		txReqResult, err := service.RequestServiceTransfer(ctx, userProfile.UserID, config.GetAPIConfig().ServiceContractID, amount.String())
 
 		if err != nil {
-			c.String(500, err.Error())
+			respondError(c, err)
+			return
+		}
+
+		// the commit is checked against it, so the discount is paid for
+		if err := service.SetMovieTokenSession(order.ID, txReqResult.RequestSessionToken); err != nil {
+			respondError(c, err)
 			return
 		}
 
@@ -253,99 +253,106 @@ func (ctr *Controller) RequestExtraPurchase(c *gin.Context) {
 }
 
 //@Summary Commit a purchasing movie-ticket token
-//@Description Commit transactions to purchase movie-ticket token and mint a movie-ticket token to user wallet
+//@Description Commit transactions to purchase movie-ticket token and mint a movie-ticket token to user wallet.
+//@Description Each transaction is included in a block before the next is sent, and applied ones are compensated when a later one fails.
+//@Description Committing the same base coin transfer session again resumes or returns the same purchase.
+//@Description The quote must be the one the purchase was requested with, and is accepted after it expires.
+//@Description A quote redeeming movie tokens must be committed with the movie token transfer session of /ticket/purchase/extra.
 //@Tags ticket
 //@Accept json
 //@Produce json
-//@Param purchase_info body service.PurchaseInfo true "Purchase info"
+//@Param Idempotency-Key header string false "Replays the original response to a request sent again with the same key"
+//@Param quote body QuoteRequest true "Quote the purchase was requested with"
 //@Param baseCoinTransferToken path string true "Base coin transfer session Token"
 //@Param movieTokenTransferToken path string true "Base coin transfer session Token"
 //@Success 200 {array} string "Transaction hashes has executed"
+//@Failure 202 {string} string "Purchase still in progress, commit again to resume it"
+//@Failure 400 {string} string "Missing or invalid quote, no order for the session, transfer not authorized, or movie token transfer not matching the order"
+//@Failure 404 {string} string "Purchase not found, as it belongs to another user"
+//@Failure 409 {string} string "Seat taken, transaction failed and purchase rolled back, or idempotency key used for a different request"
 //@Failure 500 {string} string "Internal server error"
 //@Router /ticket/purchase/commit/{baseCoinTransferToken}/{:movieTokenTransferToken} [post]
 func (ctr *Controller) CommitPurchasingTicket(c *gin.Context) {
+	ctx := c.Request.Context()
 
-	resp := make([]string, 0)
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
-	}
-
-	serviceContractID := config.GetAPIConfig().ServiceContractID
-	itemContractID := config.GetAPIConfig().ItemContractID
-	fungibleTokenType := config.GetAPIConfig().FungibleTokenType
-	nonFungibleTokenType := config.GetAPIConfig().NonFungibleTokenType
+	userProfile := currentUser(c)
 
 	baseSessionToken := c.Param("baseCoinTransferToken")
 	serviceSessionToken := c.Param("movieTokenTransferToken")
+	if serviceSessionToken == movieTokenNotUsed {
+		serviceSessionToken = ""
+	}
 
-	reqBody, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(500, err.Error())
+	// the user may take a while to approve the transfers, so the quote is
+	// accepted past its expiry once the order is placed
+	quote := bindQuote(c, service.ParseQuote)
+	if quote == nil {
 		return
 	}
 
-	purchaseInfo := service.PurchaseInfo{}
-	if err := json.Unmarshal(reqBody, &purchaseInfo); err != nil {
-		c.String(500, err.Error())
+	// only the base coin transfer sessions requested for an order are
+	// indexed, so proxy and movie token sessions have no order
+	order, err := service.GetOrderBySession(baseSessionToken)
+	if err != nil && !errors.Is(err, service.ErrNoStore) {
+		respondError(c, err)
 		return
 	}
-
-	if !checkPrice(purchaseInfo.PriceInfo) {
-		c.String(500, "Invalid price info")
+	if order == nil && err == nil {
+		c.String(400, "Request the purchase of the quote first")
 		return
 	}
-
-	if fungibleAmt := purchaseInfo.PriceInfo.UsedFungible; fungibleAmt > 0 {
-		tx, err := service.BurnFungible(userProfile.UserID, itemContractID, fungibleTokenType, strconv.Itoa(fungibleAmt))
-		if err != nil {
-			c.String(500, err.Error())
-			return
-		}
-		resp = append(resp, tx.TxHash)
+	if order != nil && order.UserID != userProfile.UserID {
+		respondError(c, service.ErrPurchaseNotFound)
+		return
 	}
-
-	serviceAmt := new(big.Int).Mul(big.NewInt(int64(purchaseInfo.PriceInfo.GrandTotal)), big.NewInt(1000000))
-	serviceAmt.Div(serviceAmt, big.NewInt(10))
-	serviceAmt.Mul(serviceAmt, big.NewInt(1000))
-	serviceTx, err := service.TransferServiceToken(userProfile.UserID, serviceContractID, serviceAmt.String())
-	if err != nil {
-		c.String(500, err.Error())
+	if order != nil && order.QuoteID != quote.ID {
+		c.String(400, "Quote does not match the order")
+		return
+	}
+	if order == nil && time.Now().After(quote.ExpiresAt) {
+		respondError(c, service.ErrQuoteExpired)
+		return
+	}
+	// the discount of the quote is only given for the movie tokens
+	// transferred in the session requested for the order
+	if quote.PriceInfo.UsedServiceToken > 0 && (order == nil || serviceSessionToken == "" || serviceSessionToken != order.MovieTokenSession) {
+		c.String(400, "Movie token transfer does not match the order")
 		return
 	}
 
-	if serviceSessionToken != movieTokenNotUsed {
-		tx, err := service.CommitTransferRequest(serviceSessionToken)
+	// a started purchase is resumed whatever the session became
+	if order == nil || order.PurchaseID == "" {
+		authorized, err := sessionAuthorized(ctx, baseSessionToken)
 		if err != nil {
-			c.String(500, err.Error())
+			respondError(c, err)
+			return
+		}
+		if !authorized {
+			c.String(400, "Base coin transfer is not authorized")
 			return
 		}
-		resp = append(resp, tx.TxHash)
 	}
 
-	baseTx, err := service.CommitTransferRequest(baseSessionToken)
+	purchase, err := service.CommitPurchase(ctx, userProfile.UserID, quote.PurchaseInfo, baseSessionToken, serviceSessionToken)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
-	resp = append(resp, baseTx.TxHash)
-
-	meta := service.NonFungibleMetadata{
-		MovieInfo:  purchaseInfo.MovieInfo,
-		TicketInfo: purchaseInfo.TicketInfo,
-		PaymentInfo: service.PaymentInfo{
-			PaymentDate:        time.Now(),
-			PaymentTransaction: baseTx.TxHash,
-			PointTransaction:   serviceTx.TxHash,
-		},
-	}
 
-	tx, err := service.MintNonFungible(userProfile.UserID, itemContractID, nonFungibleTokenType, meta)
-	if err != nil {
-		c.String(500, err.Error())
-		return
-	}
-	resp = append(resp, tx.TxHash)
+	c.JSON(200, purchase.TxHashes())
 
-	c.JSON(200, resp)
+}
 
+// sessionAuthorized reports whether the user has authorized the transfer
+// requested with a session token.
+func sessionAuthorized(ctx context.Context, token string) (bool, error) {
+	apiResult, err := service.GetProxyStatus(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	status := make(map[string]string)
+	if err := json.Unmarshal(apiResult, &status); err != nil {
+		return false, err
+	}
+	return status["status"] == "Authorized", nil
 }
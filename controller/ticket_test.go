@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"link/cinema/api"
+	"link/cinema/config"
+	"link/cinema/lbdfake"
+	"link/cinema/service"
+	"link/cinema/store"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const ticketTestUserID = "U0000000000000000000000000000001"
+
+// ticketTest serves the ticket routes for ticketTestUserID against a fake
+// LBD.
+type ticketTest struct {
+	ctx    context.Context
+	cfg    *config.APIConfig
+	fake   *lbdfake.Server
+	router *gin.Engine
+}
+
+func newTicketTest(t *testing.T, configure func(cfg *lbdfake.Config)) (*ticketTest, func()) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.SetStore(db)
+
+	cfg := &config.APIConfig{
+		APIKey:               "api-key",
+		APISecret:            "api-secret",
+		WalletAddress:        "tlink1servicewallet",
+		WalletSecret:         "wallet-secret",
+		ServiceContractID:    "9636a07e",
+		ItemContractID:       "61e14383",
+		FungibleTokenType:    "00000001",
+		NonFungibleTokenType: "10000001",
+		UserID:               ticketTestUserID,
+	}
+	fakeConfig := lbdfake.ConfigFromAPIConfig(cfg)
+	fakeConfig.AutoCreateUsers = true
+	configure(&fakeConfig)
+	fake := lbdfake.New(fakeConfig)
+	lbd := httptest.NewServer(fake)
+	fake.SetEndpoint(lbd.URL)
+	cfg.LBDAPIEndpoint = lbd.URL
+
+	saved := config.GetAPIConfig()
+	config.SetAPIConfig(cfg)
+	api.SetClient(api.NewClient(cfg, nil, nil))
+	closeTest := func() {
+		api.SetClient(nil)
+		config.SetAPIConfig(saved)
+		lbd.Close()
+		service.SetStore(nil)
+		db.Close()
+	}
+
+	tt := &ticketTest{
+		ctx:  api.NewContext(context.Background(), api.GetClient()),
+		cfg:  cfg,
+		fake: fake,
+	}
+	if err := service.SeedCatalog(); err != nil {
+		closeTest()
+		t.Fatal(err)
+	}
+	if _, err := service.TransferBaseCoin(tt.ctx, ticketTestUserID, "100000000"); err != nil {
+		closeTest()
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	ctr := NewController()
+	tt.router = gin.New()
+	ticket := tt.router.Group("/ticket", ctr.Authenticate())
+	ticket.GET("/", ctr.GetPurchaseInfo)
+	ticket.POST("/purchase", ctr.RequestTicketPurchasing)
+	ticket.POST("/purchase/extra", ctr.RequestExtraPurchase)
+	ticket.POST("/purchase/commit/:baseCoinTransferToken/:movieTokenTransferToken", ctr.CommitPurchasingTicket)
+	return tt, closeTest
+}
+
+func (tt *ticketTest) send(t *testing.T, method, target string, body interface{}, result interface{}) int {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, target, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, req)
+	if result != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+			t.Fatal(w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestCommitDiscountedPurchase(t *testing.T) {
+	tt, closeTest := newTicketTest(t, func(cfg *lbdfake.Config) {
+		cfg.AutoAuthorize = true
+	})
+	defer closeTest()
+	if _, err := service.TransferServiceToken(tt.ctx, ticketTestUserID, tt.cfg.ServiceContractID, "1000000000"); err != nil {
+		t.Fatal(err)
+	}
+
+	quote := service.Quote{}
+	if code := tt.send(t, "GET", "/ticket/", nil, &quote); code != http.StatusOK || quote.PriceInfo.UsedServiceToken == 0 {
+		t.Fatal("Expected a quote redeeming movie tokens", code, quote.PriceInfo)
+	}
+	quoteReq := QuoteRequest{QuoteID: quote.ID}
+	if code := tt.send(t, "POST", "/ticket/purchase/extra", quoteReq, nil); code != http.StatusBadRequest {
+		t.Error("Expected the movie tokens to be requested after the purchase", code)
+	}
+	purchase := PurchaseRequest{}
+	if code := tt.send(t, "POST", "/ticket/purchase", quoteReq, &purchase); code != http.StatusOK {
+		t.Fatal("Expected the purchase to be requested", code)
+	}
+
+	commit := "/ticket/purchase/commit/" + purchase.RequestSessionToken + "/"
+	if code := tt.send(t, "POST", commit+movieTokenNotUsed, quoteReq, nil); code != http.StatusBadRequest {
+		t.Error("Expected a discounted purchase without movie tokens to be refused", code)
+	}
+
+	extra := service.TransferRequestResult{}
+	if code := tt.send(t, "POST", "/ticket/purchase/extra", quoteReq, &extra); code != http.StatusOK {
+		t.Fatal("Expected the movie tokens to be requested", code)
+	}
+	other := service.TransferRequestResult{}
+	tt.send(t, "POST", "/ticket/purchase/extra", quoteReq, &other)
+	if code := tt.send(t, "POST", commit+extra.RequestSessionToken, quoteReq, nil); code != http.StatusBadRequest {
+		t.Error("Expected a movie token transfer other than the order's to be refused", code)
+	}
+	if code := tt.send(t, "POST", "/ticket/purchase/commit/"+other.RequestSessionToken+"/"+other.RequestSessionToken, quoteReq, nil); code != http.StatusBadRequest {
+		t.Error("Expected a movie token transfer to be refused as the payment", code)
+	}
+	if code := tt.send(t, "POST", commit+other.RequestSessionToken, quoteReq, nil); code != http.StatusOK {
+		t.Error("Expected the purchase to be committed with the order's movie token transfer", code)
+	}
+}
+
+func TestCommitRefusesOtherSessions(t *testing.T) {
+	tt, closeTest := newTicketTest(t, func(*lbdfake.Config) {})
+	defer closeTest()
+
+	quote := service.Quote{}
+	if code := tt.send(t, "GET", "/ticket/", nil, &quote); code != http.StatusOK {
+		t.Fatal("Expected a quote", code)
+	}
+	quoteReq := QuoteRequest{QuoteID: quote.ID}
+	purchase := PurchaseRequest{}
+	if code := tt.send(t, "POST", "/ticket/purchase", quoteReq, &purchase); code != http.StatusOK {
+		t.Fatal("Expected the purchase to be requested", code)
+	}
+
+	proxy, err := service.RequestProxy(tt.ctx, ticketTestUserID, tt.cfg.ItemContractID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tt.fake.Authorize(proxy.RequestSessionToken); err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range []string{proxy.RequestSessionToken, "unknown-session"} {
+		if code := tt.send(t, "POST", "/ticket/purchase/commit/"+session+"/"+movieTokenNotUsed, quoteReq, nil); code != http.StatusBadRequest {
+			t.Error("Expected a session without an order to be refused", session, code)
+		}
+	}
+
+	commit := "/ticket/purchase/commit/" + purchase.RequestSessionToken + "/" + movieTokenNotUsed
+	if code := tt.send(t, "POST", commit, quoteReq, nil); code != http.StatusBadRequest {
+		t.Error("Expected an unauthorized transfer to be refused", code)
+	}
+	if err := tt.fake.Authorize(purchase.RequestSessionToken); err != nil {
+		t.Fatal(err)
+	}
+	if code := tt.send(t, "POST", commit, quoteReq, nil); code != http.StatusOK {
+		t.Error("Expected the authorized transfer to be committed", code)
+	}
+}
@@ -17,16 +17,20 @@ package controller
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
-	"link/cinema/api"
 	"link/cinema/config"
 	"link/cinema/service"
+	"strconv"
+	"time"
 )
 
 type MovieDiscountBalance struct {
-	UserInfo  *service.UserInfo        `json:"userInfo"`
-	TokenInfo *service.FungibleBalance `json:"tokenInfo"`
-	Txs       []*service.Transaction   `json:"transactions"`
+	UserInfo   *service.UserInfo        `json:"userInfo"`
+	TokenInfo  *service.FungibleBalance `json:"tokenInfo"`
+	Txs        []*service.Transaction   `json:"transactions"`
+	NextCursor string                   `json:"nextCursor,omitempty"`
+	Freshness  *service.Freshness       `json:"freshness,omitempty"`
 }
 
 //@Summary Get a movie-discount token balance
@@ -34,42 +38,52 @@ type MovieDiscountBalance struct {
 ////@Tags token
 //@Accept json
 //@Produce json
+//@Param limit query int false "Maximum number of transactions"
+//@Param cursor query string false "Cursor returned as nextCursor by the previous request"
+//@Param before query int false "Only transactions before this time, in milliseconds"
+//@Param after query int false "Only transactions after this time, in milliseconds"
 //@Failure 200 {array} MovieDiscountBalance "Movie-Discount token and summary by user"
 //@Failure 500 {string} string "Internal server error"
 //@Router /token/balance/movie-discount [get]
 func (ctr *Controller) GetMovieDiscountBalance(c *gin.Context) {
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
+	ctx := c.Request.Context()
+	query, err := historyQuery(c)
+	if err != nil {
+		c.String(400, err.Error())
+		return
 	}
+	userProfile := currentUser(c)
 
 	contractID := config.GetAPIConfig().ItemContractID
 	tokenType := config.GetAPIConfig().FungibleTokenType
 
-	userInfo, err := service.GetUserInfo(userProfile.UserID)
+	userInfo, err := service.GetUserInfo(ctx, userProfile.UserID)
 
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
-	fungibleBalance, err := service.GetFungibleBalance(userProfile.UserID, contractID, tokenType)
+	fungibleBalance, err := service.GetFungibleBalance(ctx, userProfile.UserID, contractID, tokenType)
 
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
-	txs, err := service.GetFungibleTransactionHistory(userProfile.UserID, contractID, tokenType)
+	txs, err := service.GetFungibleTransactionHistory(ctx, userProfile.UserID, contractID, tokenType, query)
 
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(200, MovieDiscountBalance{
-		UserInfo:  userInfo,
-		TokenInfo: fungibleBalance,
-		Txs:       txs,
+		UserInfo:   userInfo,
+		TokenInfo:  fungibleBalance,
+		Txs:        txs.Transactions,
+		NextCursor: txs.NextCursor,
+		Freshness:  txs.Freshness,
 	})
 }
 
@@ -96,16 +110,15 @@ type MovieTicketToken struct {
 //@Failure 500 {string} string "Internal server error"
 //@Router /token/balance/movie-ticket [get]
 func (ctr *Controller) SearchTicketBalance(c *gin.Context) {
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
-	}
+	ctx := c.Request.Context()
+	userProfile := currentUser(c)
 
 	contractID := config.GetAPIConfig().ItemContractID
 	tokenType := config.GetAPIConfig().NonFungibleTokenType
 
-	nonFungibleInfos, err := service.GetNonFungibleInfo(userProfile.UserID, contractID, tokenType)
+	nonFungibleInfos, err := service.GetNonFungibleInfo(ctx, userProfile.UserID, contractID, tokenType)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -116,13 +129,13 @@ func (ctr *Controller) SearchTicketBalance(c *gin.Context) {
 
 		meta := service.NonFungibleMetadata{}
 		if err := json.Unmarshal([]byte(nonFungibleInfo.Meta), &meta); err != nil {
-			c.String(500, err.Error())
+			respondError(c, err)
 			return
 		}
 
-		txs, err := service.GetNonFungibleTransactionHistory(userProfile.UserID, contractID, tokenType, tokenIndex)
+		txs, err := service.GetNonFungibleTransactionHistory(ctx, userProfile.UserID, contractID, tokenType, tokenIndex)
 		if err != nil {
-			c.String(500, err.Error())
+			respondError(c, err)
 			return
 		}
 
@@ -145,9 +158,11 @@ func (ctr *Controller) SearchTicketBalance(c *gin.Context) {
 }
 
 type MovieTokenBalance struct {
-	UserInfo  *service.UserInfo            `json:"userInfo"`
-	TokenInfo *service.ServiceTokenBalance `json:"tokenInfo"`
-	Txs       []*service.Transaction       `json:"transactions"`
+	UserInfo   *service.UserInfo            `json:"userInfo"`
+	TokenInfo  *service.ServiceTokenBalance `json:"tokenInfo"`
+	Txs        []*service.Transaction       `json:"transactions"`
+	NextCursor string                       `json:"nextCursor,omitempty"`
+	Freshness  *service.Freshness           `json:"freshness,omitempty"`
 }
 
 //@Summary Get a movie token balance
@@ -155,44 +170,59 @@ type MovieTokenBalance struct {
 //@Tags token
 //@Accept json
 //@Produce json
+//@Param limit query int false "Maximum number of transactions"
+//@Param cursor query string false "Cursor returned as nextCursor by the previous request"
+//@Param before query int false "Only transactions before this time, in milliseconds"
+//@Param after query int false "Only transactions after this time, in milliseconds"
 //@Success 200 {object} MovieTokenBalance "Movie token balance and summary by user"
 //@Failure 500 {string} string
 //@Router /token/balance/movie [get]
 func (ctr *Controller) GetMovieTokenBalance(c *gin.Context) {
-	contractID := config.GetAPIConfig().ServiceContractID
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
+	ctx := c.Request.Context()
+	query, err := historyQuery(c)
+	if err != nil {
+		c.String(400, err.Error())
+		return
 	}
+	contractID := config.GetAPIConfig().ServiceContractID
+	userProfile := currentUser(c)
 
-	userInfo, err := service.GetUserInfo(userProfile.UserID)
+	userInfo, err := service.GetUserInfo(ctx, userProfile.UserID)
 
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
 	}
 
-	serviceTokenBalance, err := service.GetServiceTokenBalance(userProfile.UserID, contractID)
+	serviceTokenBalance, err := service.GetServiceTokenBalance(ctx, userProfile.UserID, contractID)
 
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
 	}
 
-	txs, err := service.GetServiceTokenTransactionHistory(userProfile.UserID, contractID)
+	txs, err := service.GetServiceTokenTransactionHistory(ctx, userProfile.UserID, contractID, query)
 
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
 	}
 
 	c.JSON(200, MovieTokenBalance{
-		UserInfo:  userInfo,
-		TokenInfo: serviceTokenBalance,
-		Txs:       txs,
+		UserInfo:   userInfo,
+		TokenInfo:  serviceTokenBalance,
+		Txs:        txs.Transactions,
+		NextCursor: txs.NextCursor,
+		Freshness:  txs.Freshness,
 	})
 }
 
 type BaseCoinBalance struct {
-	UserInfo *service.UserInfo        `json:"userInfo"`
-	CoinInfo *service.BaseCoinBalance `json:"coinInfo"`
-	Txs      []*service.Transaction   `json:"transactions"`
+	UserInfo   *service.UserInfo        `json:"userInfo"`
+	CoinInfo   *service.BaseCoinBalance `json:"coinInfo"`
+	Txs        []*service.Transaction   `json:"transactions"`
+	NextCursor string                   `json:"nextCursor,omitempty"`
+	Freshness  *service.Freshness       `json:"freshness,omitempty"`
 }
 
 //@Summary Get a base coin balance
@@ -200,33 +230,81 @@ type BaseCoinBalance struct {
 //@Tags token
 //@Accept json
 //@Produce json
+//@Param limit query int false "Maximum number of transactions"
+//@Param cursor query string false "Cursor returned as nextCursor by the previous request"
+//@Param before query int false "Only transactions before this time, in milliseconds"
+//@Param after query int false "Only transactions after this time, in milliseconds"
 //@Success 200 {object} BaseCoinBalance "Base coin balance and summary by user"
 //@Failure 500 {string} string
 //@Router /token/balance/base-coin [get]
 func (ctr *Controller) GetBaseCoinBalance(c *gin.Context) {
-	userID := config.GetAPIConfig().UserID
-	userProfile := api.UserProfile{
-		UserID: userID,
+	ctx := c.Request.Context()
+	query, err := historyQuery(c)
+	if err != nil {
+		c.String(400, err.Error())
+		return
 	}
+	userID := currentUser(c).UserID
 
-	userInfo, err := service.GetUserInfo(userProfile.UserID)
+	userInfo, err := service.GetUserInfo(ctx, userID)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
 	}
 
-	baseCoinInfo, err := service.GetBaseCoinBalance(userID)
+	baseCoinInfo, err := service.GetBaseCoinBalance(ctx, userID)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
 	}
 
-	txs, err := service.GetBaseCoinTransactionHistory(userID)
+	txs, err := service.GetBaseCoinTransactionHistory(ctx, userID, query)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
+		return
 	}
 
 	c.JSON(200, BaseCoinBalance{
-		UserInfo: userInfo,
-		CoinInfo: baseCoinInfo,
-		Txs:      txs,
+		UserInfo:   userInfo,
+		CoinInfo:   baseCoinInfo,
+		Txs:        txs.Transactions,
+		NextCursor: txs.NextCursor,
+		Freshness:  txs.Freshness,
 	})
 }
+
+const (
+	maxHistoryLimit = 100
+)
+
+// historyQuery reads the limit, cursor, before and after params of a
+// balance endpoint.
+func historyQuery(c *gin.Context) (service.HistoryQuery, error) {
+	query := service.HistoryQuery{
+		Limit:    service.DefaultHistoryLimit,
+		MaxPages: service.DefaultHistoryMaxPages,
+		Cursor:   c.Query("cursor"),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return query, fmt.Errorf("invalid limit: %s", limit)
+		}
+		query.Limit = n
+	}
+
+	for key, bound := range map[string]*time.Time{"before": &query.Before, "after": &query.After} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s: %s", key, value)
+		}
+		*bound = time.Unix(0, millis*int64(time.Millisecond))
+	}
+
+	return query, nil
+}
@@ -18,17 +18,11 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"io/ioutil"
-	"link/cinema/api"
+	"link/cinema/auth"
 	"link/cinema/config"
 	"link/cinema/service"
-	"math/rand"
 	"net/http"
-	"net/url"
-	"strconv"
-	"strings"
 )
 
 //@Summary Request user to set proxy
@@ -36,18 +30,19 @@ import (
 //@Tags user
 //@Accept json
 //@Produce json
+//@Param Idempotency-Key header string false "Replays the original response to a request sent again with the same key"
 //@Success 200 {object} service.TransferRequestResult "Session token and redirect url to set proxy"
+//@Failure 409 {string} string "Idempotency key used for a different request"
 //@Failure 500 {string} string "Internal server error"
 //@Router /user/proxy [get]
 func (ctr *Controller) RequestProxy(c *gin.Context){
-	userProfile := api.UserProfile{
-		UserID: config.GetAPIConfig().UserID,
-	}
+	ctx := c.Request.Context()
+	userProfile := currentUser(c)
 
-	proxyReqResult, err := service.RequestProxy(userProfile.UserID, config.GetAPIConfig().ItemContractID)
+	proxyReqResult, err := service.RequestProxy(ctx, userProfile.UserID, config.GetAPIConfig().ItemContractID)
 
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -60,23 +55,26 @@ func (ctr *Controller) RequestProxy(c *gin.Context){
 //@Tags user
 //@Accept json
 //@Produce json
+//@Param Idempotency-Key header string false "Replays the original response to a request sent again with the same key"
 //@Param proxyToken path string true "Proxy session token"
 //@Success 200 {string} string "Transaction hash has executed"
+//@Failure 409 {string} string "Idempotency key used for a different request"
 //@Failure 500 {string} string "Internal server error"
 //@Router /user/proxy/commit/{proxyToken} [get]
 func (ctr *Controller) CommitRequestProxy(c *gin.Context) {
+	ctx := c.Request.Context()
 	token := c.Param("proxyToken")
 
-	apiResult, err := service.GetProxyStatus(token)
+	apiResult, err := service.GetProxyStatus(ctx, token)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
 	proxyStatus := make(map[string]string)
 
 	if err := json.Unmarshal(apiResult, &proxyStatus); err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -85,9 +83,9 @@ func (ctr *Controller) CommitRequestProxy(c *gin.Context) {
 		return
 	}
 
-	tx, err := service.CommitTransferRequest(token)
+	tx, err := service.CommitTransferRequest(ctx, token)
 	if err != nil {
-		c.String(500, err.Error())
+		respondError(c, err)
 		return
 	}
 
@@ -96,66 +94,121 @@ func (ctr *Controller) CommitRequestProxy(c *gin.Context) {
 
 
 //@Summary Login to LINE
-//@Description retrieve URL to login through LINE
+//@Description Retrieve the URL to log in through LINE. The login is bound to the session cookie set by this request, with a state and a PKCE code verifier checked by the callback.
 //@Tags user
 //@Accept json
 //@Produce json
 //@Success 200 {string} string "URL to redirect login page"
+//@Failure 404 {string} string "LINE Login not configured"
 //@Failure 500 {string} string "Internal server error"
 //@Router /user/login [get]
 func (ctr *Controller) LINELogin(c *gin.Context) {
-	url := fmt.Sprintf("%s/oauth2/v2.1/authorize", config.GetAPIConfig().LINEAccessEndpoint)
+	if !ctr.login.Enabled() {
+		c.String(404, "LINE Login is not configured")
+		return
+	}
+
+	req, err := auth.NewLoginRequest()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
 
-	query := map[string]string{
-		"response_type": "code",
-		"client_id":     config.GetAPIConfig().ChannelID,
-		"redirect_uri":  fmt.Sprintf("%s/api/v0/user/login/callback", config.GetAPIConfig().Endpoint),
-		"state":         strconv.FormatInt(rand.Int63(), 16),
-		"scope":         "profile%20openid",
+	session, err := startSession(c)
+	if err != nil {
+		respondError(c, err)
+		return
 	}
-	prefix := "?"
-	for k, v := range query {
-		url += fmt.Sprintf("%s%s=%s", prefix, k, v)
-		prefix = "&"
+	session.Values[sessionLogin] = string(data)
+	if err := saveSession(c, session); err != nil {
+		respondError(c, err)
+		return
 	}
 
-	c.JSON(200, url)
-	//c.Redirect(http.StatusMovedPermanently, url)
+	c.JSON(200, ctr.login.AuthorizeURL(req))
+	//c.Redirect(http.StatusFound, ctr.login.AuthorizeURL(req))
 }
 
+//@Summary Complete a login to LINE
+//@Description LINE redirects here after the user logs in. The user of the verified ID token is logged in to the session, and the browser is sent to the API reference.
+//@Tags user
+//@Param code query string false "Authorization code"
+//@Param state query string true "State sent to LINE"
+//@Param error query string false "Reason LINE did not log the user in"
+//@Success 302 {string} string "Logged in"
+//@Failure 400 {string} string "Missing or invalid state"
+//@Failure 401 {string} string "Login denied, or invalid ID token"
+//@Failure 502 {string} string "Token exchange failed"
+//@Failure 500 {string} string "Internal server error"
+//@Router /user/login/callback [get]
 func (ctr *Controller) LINELoginCallback(c *gin.Context) {
-	client := http.Client{}
-
-	code := c.Query("code")
-
-	data := url.Values{}
-	data.Set("grant_type", "authorization_code")
-	data.Add("code", code)
-	data.Add("redirect_uri", fmt.Sprintf("%s/api/v0/user/login/callback", config.GetAPIConfig().Endpoint))
-	data.Add("client_id", config.GetAPIConfig().ChannelID)
-	data.Add("client_secret", config.GetAPIConfig().ChannelSecret)
-
-	apiURL := fmt.Sprintf("%s/oauth2/v2.1/token", config.GetAPIConfig().LINEAPIEndpoint)
-
-	req, _ := http.NewRequest("POST", apiURL, strings.NewReader(data.Encode()))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	resp, _ := client.Do(req)
+	session := currentSession(c)
+	if session == nil {
+		respondError(c, auth.ErrInvalidState)
+		return
+	}
 
-	apiResult, _ := ioutil.ReadAll(resp.Body)
+	// a login request is used once, whatever the outcome
+	data := session.Values[sessionLogin]
+	delete(session.Values, sessionLogin)
+	idToken, err := ctr.completeLogin(c, data)
+	if err != nil {
+		if saveErr := service.SaveSession(session); saveErr != nil {
+			err = saveErr
+		}
+		respondError(c, err)
+		return
+	}
 
-	type tokenResult struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
+	// the session gets a new ID once the user is logged in, so an ID
+	// planted in the browser before the login is of no use
+	profile := idToken.Profile()
+	session.UserID = profile.UserID
+	session.DisplayName = profile.DisplayName
+	if err := service.RotateSession(session); err != nil {
+		respondError(c, err)
+		return
 	}
+	setSessionCookie(c, session)
 
-	token := tokenResult{}
+	if err := service.RegisterSyncUser(profile.UserID); err != nil {
+		respondError(c, err)
+		return
+	}
 
-	json.Unmarshal(apiResult, &token)
+	c.Redirect(http.StatusFound, "/swagger/index.html")
+}
 
-	session := sessions.Default(c)
-	session.Set("accessToken", token.AccessToken)
-	session.Set("tokenType", token.TokenType)
-	session.Save()
+// completeLogin checks the callback against the login request saved in the
+// session as data, and exchanges its code for a verified ID token.
+func (ctr *Controller) completeLogin(c *gin.Context, data string) (*auth.IDToken, error) {
+	req := &auth.LoginRequest{}
+	if data == "" || json.Unmarshal([]byte(data), req) != nil {
+		return nil, auth.ErrInvalidState
+	}
+	if err := req.CheckState(c.Query("state")); err != nil {
+		return nil, err
+	}
+	if reason := c.Query("error"); reason != "" {
+		return nil, fmt.Errorf("%w: %s: %s", auth.ErrLoginDenied, reason, c.Query("error_description"))
+	}
+	idToken, _, err := ctr.login.Login(c.Request.Context(), c.Query("code"), req)
+	return idToken, err
+}
 
-	c.Redirect(http.StatusMovedPermanently, "/swagger/index.html")
+//@Summary Get the logged-in user
+//@Description Retrieve the user the requests act on
+//@Tags user
+//@Accept json
+//@Produce json
+//@Success 200 {object} api.UserProfile "Logged-in user"
+//@Failure 401 {string} string "Not logged in"
+//@Router /user/profile [get]
+func (ctr *Controller) GetProfile(c *gin.Context) {
+	c.JSON(200, currentUser(c))
 }
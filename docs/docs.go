@@ -33,32 +33,14 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/test/config": {
+        "/admin/config": {
             "get": {
-                "description": "Show a config",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "test"
-                ],
-                "summary": "Show a config",
-                "responses": {
-                    "200": {
-                        "description": "Server Configuration",
-                        "schema": {
-                            "$ref": "#/definitions/config.APIConfig"
-                        }
+                "security": [
+                    {
+                        "ApiKeyAuth": []
                     }
-                }
-            }
-        },
-        "/test/init": {
-            "get": {
-                "description": "Transfer tokens to user",
+                ],
+                "description": "List the config fields with whether each is set and where it was set: left at its default, or in the config file, an environment variable or a flag.\nValues of unset fields are left out and secrets are masked.",
                 "consumes": [
                     "application/json"
                 ],
@@ -66,21 +48,27 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "test"
+                    "admin"
                 ],
-                "summary": "Init asset for test user",
+                "summary": "Describe the config",
                 "responses": {
                     "200": {
-                        "description": "transaction hashes has executed",
+                        "description": "Config fields",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "type": "string"
+                                "$ref": "#/definitions/config.Field"
                             }
                         }
                     },
-                    "500": {
-                        "description": "Internal server error",
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the admin role",
                         "schema": {
                             "type": "string"
                         }
@@ -88,9 +76,14 @@ var doc = `{
                 }
             }
         },
-        "/test/transaction": {
-            "get": {
-                "description": "Retrieve a Transaction using its hash",
+        "/admin/movies/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a movie to the catalog or replace it",
                 "consumes": [
                     "application/json"
                 ],
@@ -98,31 +91,67 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "test"
+                    "admin"
                 ],
-                "summary": "Get a transaction",
+                "summary": "Put a movie",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Transaction hash used for searching",
-                        "name": "txhash",
-                        "in": "query",
+                        "description": "Movie ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Movie",
+                        "name": "movie",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.Movie"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Transaction with the provided hash",
+                        "description": "Movie put",
                         "schema": {
-                            "$ref": "#/definitions/service.Transaction"
+                            "$ref": "#/definitions/service.Movie"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid movie",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
                         }
                     }
                 }
-            }
-        },
-        "/ticket": {
-            "get": {
-                "description": "Retrieve a purchase info about given movie ticket",
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove a movie no showtime is scheduled for from the catalog",
                 "consumes": [
                     "application/json"
                 ],
@@ -130,14 +159,44 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "ticket"
+                    "admin"
+                ],
+                "summary": "Delete a movie",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Movie ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get a purchase info",
                 "responses": {
-                    "200": {
-                        "description": "Ticket info",
+                    "204": {
+                        "description": "Movie deleted"
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Movie not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Movie has showtimes",
                         "schema": {
-                            "$ref": "#/definitions/service.PurchaseInfo"
+                            "type": "string"
                         }
                     },
                     "500": {
@@ -149,9 +208,14 @@ var doc = `{
                 }
             }
         },
-        "/ticket/purchase": {
-            "post": {
-                "description": "Request user to transfer token at LBW",
+        "/admin/showtimes/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Schedule a showtime of a movie on a screen of a theater, or replace it",
                 "consumes": [
                     "application/json"
                 ],
@@ -159,25 +223,50 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "ticket"
+                    "admin"
                 ],
-                "summary": "Request user to purchase",
+                "summary": "Put a showtime",
                 "parameters": [
                     {
-                        "description": "Purchase info",
-                        "name": "purchase_info",
+                        "type": "string",
+                        "description": "Showtime ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Showtime",
+                        "name": "showtime",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/service.PurchaseInfo"
+                            "$ref": "#/definitions/service.Showtime"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Session token and redirect url to transfer token",
+                        "description": "Showtime put",
                         "schema": {
-                            "$ref": "#/definitions/service.TransferRequestResult"
+                            "$ref": "#/definitions/service.Showtime"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid showtime, or movie, theater or screen not in the catalog",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
                         }
                     },
                     "500": {
@@ -187,11 +276,14 @@ var doc = `{
                         }
                     }
                 }
-            }
-        },
-        "/ticket/purchase/commit/{baseCoinTransferToken}/{:movieTokenTransferToken}": {
-            "post": {
-                "description": "Commit transactions to purchase movie-ticket token and mint a movie-ticket token to user wallet",
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove a showtime with no seat sold or held from the catalog, with its seats",
                 "consumes": [
                     "application/json"
                 ],
@@ -199,42 +291,44 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "ticket"
+                    "admin"
                 ],
-                "summary": "Commit a purchasing movie-ticket token",
+                "summary": "Delete a showtime",
                 "parameters": [
-                    {
-                        "description": "Purchase info",
-                        "name": "purchase_info",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/service.PurchaseInfo"
-                        }
-                    },
-                    {
-                        "type": "string",
-                        "description": "Base coin transfer session Token",
-                        "name": "baseCoinTransferToken",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "type": "string",
-                        "description": "Base coin transfer session Token",
-                        "name": "movieTokenTransferToken",
+                        "description": "Showtime ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Transaction hashes has executed",
+                    "204": {
+                        "description": "Showtime deleted"
+                    },
+                    "401": {
+                        "description": "Not logged in",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "string"
-                            }
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Showtime not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Showtime has sold or held seats",
+                        "schema": {
+                            "type": "string"
                         }
                     },
                     "500": {
@@ -246,9 +340,14 @@ var doc = `{
                 }
             }
         },
-        "/ticket/purchase/extra": {
-            "post": {
-                "description": "Request user to transfer movie-token used for discounting ticket price",
+        "/admin/theaters/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a theater with its screens to the catalog or replace it",
                 "consumes": [
                     "application/json"
                 ],
@@ -256,25 +355,56 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "ticket"
+                    "admin"
                 ],
-                "summary": "Request user to purchase extra token",
+                "summary": "Put a theater",
                 "parameters": [
                     {
-                        "description": "Purchase info",
-                        "name": "purchase_info",
+                        "type": "string",
+                        "description": "Theater ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Theater",
+                        "name": "theater",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/service.PurchaseInfo"
+                            "$ref": "#/definitions/service.Theater"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Session token and redirect url to transfer a token",
+                        "description": "Theater put",
                         "schema": {
-                            "$ref": "#/definitions/service.TransferRequestResult"
+                            "$ref": "#/definitions/service.Theater"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid theater",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Dropped screen has showtimes",
+                        "schema": {
+                            "type": "string"
                         }
                     },
                     "500": {
@@ -284,11 +414,14 @@ var doc = `{
                         }
                     }
                 }
-            }
-        },
-        "/token/balance/base-coin": {
-            "get": {
-                "description": "Retrieve a base coin balance and summary by user",
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove a theater no showtime is scheduled in from the catalog",
                 "consumes": [
                     "application/json"
                 ],
@@ -296,18 +429,48 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "token"
+                    "admin"
+                ],
+                "summary": "Delete a theater",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Theater ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get a base coin balance",
                 "responses": {
-                    "200": {
-                        "description": "Base coin balance and summary by user",
+                    "204": {
+                        "description": "Theater deleted"
+                    },
+                    "401": {
+                        "description": "Not logged in",
                         "schema": {
-                            "$ref": "#/definitions/controller.BaseCoinBalance"
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Theater not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Theater has showtimes",
+                        "schema": {
+                            "type": "string"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "Internal server error",
                         "schema": {
                             "type": "string"
                         }
@@ -315,24 +478,1086 @@ var doc = `{
                 }
             }
         },
-        "/token/balance/movie": {
-            "get": {
-                "description": "Retrieve a movie token balance and summary by user",
-                "consumes": [
-                    "application/json"
+        "/admin/users/{userId}/sessions": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
+                "description": "Log a user out of every session, e.g. when the account is compromised.\nOnly admins may revoke the sessions of other users.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "token"
+                    "admin"
+                ],
+                "summary": "Revoke the sessions of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get a movie token balance",
                 "responses": {
                     "200": {
-                        "description": "Movie token balance and summary by user",
+                        "description": "Sessions revoked",
                         "schema": {
-                            "$ref": "#/definitions/controller.MovieTokenBalance"
+                            "$ref": "#/definitions/controller.SessionRevocation"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the admin role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Show circuit breaker state of each LBD endpoint group",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Show health",
+                "responses": {
+                    "200": {
+                        "description": "Every endpoint group is healthy",
+                        "schema": {
+                            "$ref": "#/definitions/controller.HealthStatus"
+                        }
+                    },
+                    "503": {
+                        "description": "Some endpoint groups are failing fast",
+                        "schema": {
+                            "$ref": "#/definitions/controller.HealthStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/movies": {
+            "get": {
+                "description": "Retrieve the movies of the catalog",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "catalog"
+                ],
+                "summary": "List movies",
+                "responses": {
+                    "200": {
+                        "description": "Movies",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/service.Movie"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/movies/{id}/showtimes": {
+            "get": {
+                "description": "Retrieve the showtimes of a movie, earliest first. A showtime ID is passed to GET /ticket to buy a ticket of it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "catalog"
+                ],
+                "summary": "List showtimes of a movie",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Movie ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Showtimes of the movie",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/service.Showtime"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Movie not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "get": {
+                "description": "Retrieve the ticket orders of the user, newest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "List orders",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of orders",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as nextCursor by the previous request",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Orders of the user",
+                        "schema": {
+                            "$ref": "#/definitions/service.OrderPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid limit or cursor",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}": {
+            "get": {
+                "description": "Retrieve a ticket order with its transactions and status timeline",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Get an order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Order with the provided ID",
+                        "schema": {
+                            "$ref": "#/definitions/service.Order"
+                        }
+                    },
+                    "404": {
+                        "description": "Order not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/showtimes/{id}/seats": {
+            "get": {
+                "description": "Retrieve the seats of a showtime, row by row, with whether each is available, held for a purchase or sold",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "catalog"
+                ],
+                "summary": "Get the seats of a showtime",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Showtime ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Seats of the showtime",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/service.SeatStatus"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Showtime not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/test/config": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Show a config, with its secrets masked",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "test"
+                ],
+                "summary": "Show a config",
+                "responses": {
+                    "200": {
+                        "description": "Server Configuration",
+                        "schema": {
+                            "$ref": "#/definitions/config.APIConfig"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the admin role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/test/init": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Transfer tokens from the service wallet to the user, who must be an operator",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "test"
+                ],
+                "summary": "Init asset for test user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replays the original response to a request sent again with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Wait until the transactions are included in a block",
+                        "name": "wait",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "transaction hashes has executed",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Transaction failed, or idempotency key used for a different request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "504": {
+                        "description": "Transaction not included in time",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/test/transaction": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve a Transaction using its hash",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "test"
+                ],
+                "summary": "Get a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transaction hash used for searching",
+                        "name": "txhash",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transaction with the provided hash",
+                        "schema": {
+                            "$ref": "#/definitions/service.Transaction"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the operator role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/theaters": {
+            "get": {
+                "description": "Retrieve the theaters of the catalog with their screens",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "catalog"
+                ],
+                "summary": "List theaters",
+                "responses": {
+                    "200": {
+                        "description": "Theaters",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/service.Theater"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ticket": {
+            "get": {
+                "description": "Retrieve a purchase info about a ticket of the given showtime, priced for the user's balances.\nThe quote ID signs the price and is sent back to purchase the ticket at that price before the quote expires.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ticket"
+                ],
+                "summary": "Get a purchase info",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Showtime of the ticket, the earliest one by default",
+                        "name": "showtimeId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Seats of the tickets, one ticket at the first available seat by default",
+                        "name": "seat",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Ticket info and price quote",
+                        "schema": {
+                            "$ref": "#/definitions/service.Quote"
+                        }
+                    },
+                    "400": {
+                        "description": "No such seat",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Showtime not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Seat taken",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ticket/cart": {
+            "post": {
+                "description": "Retrieve a purchase info about tickets of the given showtime, with one combined price for the user's balances.\nEach ticket is minted to its recipient, or to the user when none is given. Tickets without a seat get the first available ones.\nThe quote ID is sent to /ticket/purchase like the one of GET /ticket.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ticket"
+                ],
+                "summary": "Get a purchase info for a group",
+                "parameters": [
+                    {
+                        "description": "Showtime and tickets",
+                        "name": "cart",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.CartRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Ticket info and price quote",
+                        "schema": {
+                            "$ref": "#/definitions/service.Quote"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid cart or no such seat",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Showtime or recipient not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Seat taken",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ticket/check-in/{tokenId}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve when and where a movie ticket was checked in",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ticket"
+                ],
+                "summary": "Get the check-in of a movie ticket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token ID of the movie ticket",
+                        "name": "tokenId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Check-in",
+                        "schema": {
+                            "$ref": "#/definitions/service.CheckIn"
+                        }
+                    },
+                    "400": {
+                        "description": "Not a movie ticket",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the staff role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Ticket not checked in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Admit the holder of a movie ticket at the theater gate. The ticket must be owned by the user and its showtime open for check-in.\nThe ticket is marked used in its metadata, and a second check-in is refused. The check-in is dropped when the transaction marking the ticket fails.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ticket"
+                ],
+                "summary": "Check in a movie ticket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token ID of the movie ticket",
+                        "name": "tokenId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User showing the ticket",
+                        "name": "holder",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.CheckInRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Check-in",
+                        "schema": {
+                            "$ref": "#/definitions/service.CheckIn"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing user, or not a movie ticket",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Requires the staff role, or ticket not owned by the user, or check-in not open",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Ticket already checked in, or transaction marking it used failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "504": {
+                        "description": "Transaction marking the ticket used not included in time",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ticket/purchase": {
+            "post": {
+                "description": "Request user to transfer token at LBW. The seats of the quote are held for the purchase until it is committed, or until the holds expire.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ticket"
+                ],
+                "summary": "Request user to purchase",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replays the original response to a request sent again with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Quote issued by GET /ticket",
+                        "name": "quote",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.QuoteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Session token and redirect url to transfer token, and the ID of the order placed",
+                        "schema": {
+                            "$ref": "#/definitions/controller.PurchaseRequest"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid quote",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Seat taken, or idempotency key used for a different request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "410": {
+                        "description": "Quote expired",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ticket/purchase/commit/{baseCoinTransferToken}/{:movieTokenTransferToken}": {
+            "post": {
+                "description": "Commit transactions to purchase movie-ticket token and mint a movie-ticket token to user wallet.\nEach transaction is included in a block before the next is sent, and applied ones are compensated when a later one fails.\nCommitting the same base coin transfer session again resumes or returns the same purchase.\nThe quote must be the one the purchase was requested with, and is accepted after it expires.\nA quote redeeming movie tokens must be committed with the movie token transfer session of /ticket/purchase/extra.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ticket"
+                ],
+                "summary": "Commit a purchasing movie-ticket token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replays the original response to a request sent again with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Quote the purchase was requested with",
+                        "name": "quote",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.QuoteRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base coin transfer session Token",
+                        "name": "baseCoinTransferToken",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base coin transfer session Token",
+                        "name": "movieTokenTransferToken",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transaction hashes has executed",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "202": {
+                        "description": "Purchase still in progress, commit again to resume it",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid quote, no order for the session, transfer not authorized, or movie token transfer not matching the order",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Purchase not found, as it belongs to another user",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Seat taken, transaction failed and purchase rolled back, or idempotency key used for a different request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ticket/purchase/extra": {
+            "post": {
+                "description": "Request user to transfer movie-token used for discounting ticket price.\nThe purchase of the quote is requested first, and its order then has to be committed with the session returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ticket"
+                ],
+                "summary": "Request user to purchase extra token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replays the original response to a request sent again with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Quote issued by GET /ticket",
+                        "name": "quote",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.QuoteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Session token and redirect url to transfer a token",
+                        "schema": {
+                            "$ref": "#/definitions/service.TransferRequestResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid quote, or purchase of the quote not requested",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Order already committed, or idempotency key used for a different request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "410": {
+                        "description": "Quote expired",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/token/balance/base-coin": {
+            "get": {
+                "description": "Retrieve a base coin balance and summary by user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "token"
+                ],
+                "summary": "Get a base coin balance",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of transactions",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as nextCursor by the previous request",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only transactions before this time, in milliseconds",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only transactions after this time, in milliseconds",
+                        "name": "after",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Base coin balance and summary by user",
+                        "schema": {
+                            "$ref": "#/definitions/controller.BaseCoinBalance"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/token/balance/movie": {
+            "get": {
+                "description": "Retrieve a movie token balance and summary by user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "token"
+                ],
+                "summary": "Get a movie token balance",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of transactions",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as nextCursor by the previous request",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only transactions before this time, in milliseconds",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only transactions after this time, in milliseconds",
+                        "name": "after",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Movie token balance and summary by user",
+                        "schema": {
+                            "$ref": "#/definitions/controller.MovieTokenBalance"
                         }
                     },
                     "500": {
@@ -357,6 +1582,32 @@ var doc = `{
                     "token"
                 ],
                 "summary": "Get a movie-discount token balance",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of transactions",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as nextCursor by the previous request",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only transactions before this time, in milliseconds",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only transactions after this time, in milliseconds",
+                        "name": "after",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "Movie-Discount token and summary by user",
@@ -407,7 +1658,7 @@ var doc = `{
         },
         "/user/login": {
             "get": {
-                "description": "retrieve URL to login through LINE",
+                "description": "Retrieve the URL to log in through LINE. The login is bound to the session cookie set by this request, with a state and a PKCE code verifier checked by the callback.",
                 "consumes": [
                     "application/json"
                 ],
@@ -425,6 +1676,94 @@ var doc = `{
                             "type": "string"
                         }
                     },
+                    "404": {
+                        "description": "LINE Login not configured",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/login/callback": {
+            "get": {
+                "description": "LINE redirects here after the user logs in. The user of the verified ID token is logged in to the session, and the browser is sent to the API reference.",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Complete a login to LINE",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Authorization code",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "State sent to LINE",
+                        "name": "state",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reason LINE did not log the user in",
+                        "name": "error",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid state",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Login denied, or invalid ID token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "502": {
+                        "description": "Token exchange failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/logout": {
+            "post": {
+                "description": "End the session of the request. Nothing happens without one.",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Log out",
+                "responses": {
+                    "204": {
+                        "description": "Logged out"
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -434,6 +1773,35 @@ var doc = `{
                 }
             }
         },
+        "/user/profile": {
+            "get": {
+                "description": "Retrieve the user the requests act on",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get the logged-in user",
+                "responses": {
+                    "200": {
+                        "description": "Logged-in user",
+                        "schema": {
+                            "$ref": "#/definitions/api.UserProfile"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/user/proxy": {
             "get": {
                 "description": "Request user to set proxy to delegate managing item tokens by service",
@@ -447,6 +1815,14 @@ var doc = `{
                     "user"
                 ],
                 "summary": "Request user to set proxy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replays the original response to a request sent again with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "Session token and redirect url to set proxy",
@@ -454,6 +1830,12 @@ var doc = `{
                             "$ref": "#/definitions/service.TransferRequestResult"
                         }
                     },
+                    "409": {
+                        "description": "Idempotency key used for a different request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -477,6 +1859,12 @@ var doc = `{
                 ],
                 "summary": "Commit a request of setting proxy",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replays the original response to a request sent again with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
                     {
                         "type": "string",
                         "description": "Proxy session token",
@@ -492,6 +1880,12 @@ var doc = `{
                             "type": "string"
                         }
                     },
+                    "409": {
+                        "description": "Idempotency key used for a different request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -503,48 +1897,149 @@ var doc = `{
         }
     },
     "definitions": {
+        "api.BreakerState": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "integer"
+                },
+                "openedAt": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.UserProfile": {
+            "type": "object",
+            "properties": {
+                "displayName": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
         "config.APIConfig": {
             "type": "object",
             "properties": {
                 "apiKey": {
                     "type": "string"
                 },
+                "apiKeys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/config.APIKey"
+                    }
+                },
                 "apiSecret": {
                     "type": "string"
                 },
+                "catalogPath": {
+                    "type": "string"
+                },
                 "channel-id": {
                     "type": "string"
                 },
                 "channelSecret": {
                     "type": "string"
                 },
+                "checkInClosesMinutes": {
+                    "type": "integer"
+                },
+                "checkInOpensMinutes": {
+                    "type": "integer"
+                },
                 "endpoint": {
                     "type": "string"
                 },
                 "fungibleTokenType": {
                     "type": "string"
                 },
+                "historySyncIntervalSeconds": {
+                    "type": "integer"
+                },
                 "itemContract-id": {
                     "type": "string"
                 },
                 "lbd-api-endpoint": {
                     "type": "string"
                 },
+                "lbdBreakerCooldownSeconds": {
+                    "type": "integer"
+                },
+                "lbdBreakerThreshold": {
+                    "type": "integer"
+                },
+                "lbdCassettePath": {
+                    "type": "string"
+                },
+                "lbdRetryBaseDelayMillis": {
+                    "type": "integer"
+                },
+                "lbdRetryMaxAttempts": {
+                    "type": "integer"
+                },
+                "lbdRetryMaxDelayMillis": {
+                    "type": "integer"
+                },
+                "lbdTransportMode": {
+                    "type": "string"
+                },
                 "line-api-endpoint": {
                     "type": "string"
                 },
                 "lineAccessEndpoint": {
                     "type": "string"
                 },
+                "localDbPath": {
+                    "type": "string"
+                },
                 "non-fungibleTokenType": {
                     "type": "string"
                 },
+                "pricing": {
+                    "type": "object",
+                    "$ref": "#/definitions/config.PricingConfig"
+                },
+                "production": {
+                    "type": "boolean"
+                },
+                "quoteSecret": {
+                    "type": "string"
+                },
+                "quoteTtlSeconds": {
+                    "type": "integer"
+                },
+                "seatHoldSeconds": {
+                    "type": "integer"
+                },
                 "serviceContract-id": {
                     "type": "string"
                 },
+                "sessionIdleMinutes": {
+                    "type": "integer"
+                },
+                "sessionMaxAgeHours": {
+                    "type": "integer"
+                },
+                "sessionSecret": {
+                    "type": "string"
+                },
                 "user-id": {
                     "type": "string"
                 },
+                "userRoles": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "walletAddress": {
                     "type": "string"
                 },
@@ -553,6 +2048,144 @@ var doc = `{
                 }
             }
         },
+        "config.APIKey": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "config.DiscountRule": {
+            "type": "object",
+            "properties": {
+                "exclusive": {
+                    "type": "boolean"
+                },
+                "maxTokens": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "ratio": {
+                    "type": "integer"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "integer"
+                }
+            }
+        },
+        "config.Field": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "boolean"
+                },
+                "set": {
+                    "type": "boolean"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "object"
+                }
+            }
+        },
+        "config.PricingConfig": {
+            "type": "object",
+            "properties": {
+                "basePrice": {
+                    "type": "integer"
+                },
+                "discounts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/config.DiscountRule"
+                    }
+                },
+                "promotions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/config.Promotion"
+                    }
+                },
+                "showtimePrices": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/config.ShowtimePrice"
+                    }
+                }
+            }
+        },
+        "config.Promotion": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "exclusive": {
+                    "type": "boolean"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "percent": {
+                    "type": "integer"
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "showtimeFromHour": {
+                    "type": "integer"
+                },
+                "showtimeUntilHour": {
+                    "type": "integer"
+                },
+                "until": {
+                    "type": "string"
+                }
+            }
+        },
+        "config.ShowtimePrice": {
+            "type": "object",
+            "properties": {
+                "price": {
+                    "type": "integer"
+                },
+                "showtime": {
+                    "type": "string"
+                },
+                "showtimeId": {
+                    "type": "string"
+                },
+                "theater": {
+                    "type": "string"
+                }
+            }
+        },
         "controller.BaseCoinBalance": {
             "type": "object",
             "properties": {
@@ -560,6 +2193,13 @@ var doc = `{
                     "type": "object",
                     "$ref": "#/definitions/service.BaseCoinBalance"
                 },
+                "freshness": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.Freshness"
+                },
+                "nextCursor": {
+                    "type": "string"
+                },
                 "transactions": {
                     "type": "array",
                     "items": {
@@ -572,9 +2212,52 @@ var doc = `{
                 }
             }
         },
+        "controller.CartRequest": {
+            "type": "object",
+            "properties": {
+                "showtimeId": {
+                    "type": "string"
+                },
+                "tickets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.CartTicket"
+                    }
+                }
+            }
+        },
+        "controller.CheckInRequest": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.HealthStatus": {
+            "type": "object",
+            "properties": {
+                "breakers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/api.BreakerState"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "controller.MovieDiscountBalance": {
             "type": "object",
             "properties": {
+                "freshness": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.Freshness"
+                },
+                "nextCursor": {
+                    "type": "string"
+                },
                 "tokenInfo": {
                     "type": "object",
                     "$ref": "#/definitions/service.FungibleBalance"
@@ -632,25 +2315,88 @@ var doc = `{
                 }
             }
         },
-        "controller.MovieTokenBalance": {
+        "controller.MovieTokenBalance": {
+            "type": "object",
+            "properties": {
+                "freshness": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.Freshness"
+                },
+                "nextCursor": {
+                    "type": "string"
+                },
+                "tokenInfo": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.ServiceTokenBalance"
+                },
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.Transaction"
+                    }
+                },
+                "userInfo": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.UserInfo"
+                }
+            }
+        },
+        "controller.PurchaseRequest": {
+            "type": "object",
+            "properties": {
+                "orderId": {
+                    "type": "string"
+                },
+                "redirectUri": {
+                    "type": "string"
+                },
+                "requestSessionToken": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.QuoteRequest": {
+            "type": "object",
+            "properties": {
+                "quoteId": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.SessionRevocation": {
+            "type": "object",
+            "properties": {
+                "revoked": {
+                    "type": "integer"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "pricing.Adjustment": {
             "type": "object",
             "properties": {
-                "tokenInfo": {
-                    "type": "object",
-                    "$ref": "#/definitions/service.ServiceTokenBalance"
+                "amount": {
+                    "type": "integer"
                 },
-                "transactions": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/service.Transaction"
-                    }
+                "rule": {
+                    "type": "string"
                 },
-                "userInfo": {
-                    "type": "object",
-                    "$ref": "#/definitions/service.UserInfo"
+                "token": {
+                    "type": "string"
+                },
+                "tokens": {
+                    "type": "integer"
                 }
             }
         },
+        "pricing.Balances": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "integer"
+            }
+        },
         "service.Amount": {
             "type": "object",
             "properties": {
@@ -687,6 +2433,43 @@ var doc = `{
                 }
             }
         },
+        "service.CartTicket": {
+            "type": "object",
+            "properties": {
+                "recipientId": {
+                    "type": "string"
+                },
+                "sit": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.CheckIn": {
+            "type": "object",
+            "properties": {
+                "checkedInAt": {
+                    "type": "string"
+                },
+                "showtimeId": {
+                    "type": "string"
+                },
+                "sit": {
+                    "type": "string"
+                },
+                "theater": {
+                    "type": "string"
+                },
+                "tokenId": {
+                    "type": "string"
+                },
+                "txHash": {
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
         "service.Event": {
             "type": "object",
             "properties": {
@@ -715,6 +2498,17 @@ var doc = `{
                 }
             }
         },
+        "service.Freshness": {
+            "type": "object",
+            "properties": {
+                "source": {
+                    "type": "string"
+                },
+                "syncedAt": {
+                    "type": "string"
+                }
+            }
+        },
         "service.FungibleBalance": {
             "type": "object",
             "properties": {
@@ -763,6 +2557,32 @@ var doc = `{
                 }
             }
         },
+        "service.Movie": {
+            "type": "object",
+            "properties": {
+                "country": {
+                    "type": "string"
+                },
+                "genre": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "runningTime": {
+                    "type": "integer"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "year": {
+                    "type": "integer"
+                }
+            }
+        },
         "service.MovieInfo": {
             "type": "object",
             "properties": {
@@ -803,6 +2623,99 @@ var doc = `{
                 }
             }
         },
+        "service.Order": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "movieInfo": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.MovieInfo"
+                },
+                "movieTokenSession": {
+                    "type": "string"
+                },
+                "paymentSession": {
+                    "type": "string"
+                },
+                "priceInfo": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.PriceInfo"
+                },
+                "purchaseId": {
+                    "type": "string"
+                },
+                "quoteId": {
+                    "type": "string"
+                },
+                "showtimeId": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "steps": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.PurchaseStep"
+                    }
+                },
+                "ticketInfo": {
+                    "type": "object",
+                    "$ref": "#/definitions/service.TicketInfo"
+                },
+                "tickets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.CartTicket"
+                    }
+                },
+                "timeline": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.OrderEvent"
+                    }
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.OrderEvent": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.OrderPage": {
+            "type": "object",
+            "properties": {
+                "nextCursor": {
+                    "type": "string"
+                },
+                "orders": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.Order"
+                    }
+                }
+            }
+        },
         "service.PaymentInfo": {
             "type": "object",
             "properties": {
@@ -848,9 +2761,48 @@ var doc = `{
                 }
             }
         },
-        "service.PurchaseInfo": {
+        "service.PurchaseStep": {
+            "type": "object",
+            "properties": {
+                "compensationTxHash": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "ticket": {
+                    "type": "integer"
+                },
+                "txHash": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.Quote": {
             "type": "object",
             "properties": {
+                "adjustments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pricing.Adjustment"
+                    }
+                },
+                "balances": {
+                    "type": "object",
+                    "$ref": "#/definitions/pricing.Balances"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "issuedAt": {
+                    "type": "string"
+                },
                 "movieInfo": {
                     "type": "object",
                     "$ref": "#/definitions/service.MovieInfo"
@@ -859,9 +2811,63 @@ var doc = `{
                     "type": "object",
                     "$ref": "#/definitions/service.PriceInfo"
                 },
+                "quoteId": {
+                    "type": "string"
+                },
+                "showtimeId": {
+                    "type": "string"
+                },
                 "ticketInfo": {
                     "type": "object",
                     "$ref": "#/definitions/service.TicketInfo"
+                },
+                "tickets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.CartTicket"
+                    }
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.Screen": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.SeatRow"
+                    }
+                }
+            }
+        },
+        "service.SeatRow": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "seats": {
+                    "type": "integer"
+                }
+            }
+        },
+        "service.SeatStatus": {
+            "type": "object",
+            "properties": {
+                "seat": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
                 }
             }
         },
@@ -888,6 +2894,29 @@ var doc = `{
                 }
             }
         },
+        "service.Showtime": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "movieId": {
+                    "type": "string"
+                },
+                "price": {
+                    "type": "integer"
+                },
+                "screenId": {
+                    "type": "string"
+                },
+                "startsAt": {
+                    "type": "string"
+                },
+                "theaterId": {
+                    "type": "string"
+                }
+            }
+        },
         "service.Signature": {
             "type": "object",
             "properties": {
@@ -900,6 +2929,23 @@ var doc = `{
                 }
             }
         },
+        "service.Theater": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "screens": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.Screen"
+                    }
+                }
+            }
+        },
         "service.TicketInfo": {
             "type": "object",
             "properties": {
@@ -909,6 +2955,9 @@ var doc = `{
                 "price": {
                     "type": "integer"
                 },
+                "showtimeId": {
+                    "type": "string"
+                },
                 "sit": {
                     "type": "string"
                 },
@@ -1006,11 +3055,21 @@ var doc = `{
         "service.UserInfo": {
             "type": "object",
             "properties": {
+                "userId": {
+                    "type": "string"
+                },
                 "walletAddress": {
                     "type": "string"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        }
     }
 }`
 
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package main
+
+import (
+	"flag"
+	"link/cinema/config"
+	"link/cinema/lbdfake"
+	"log"
+	"net/http"
+	"os"
+)
+
+// runFakeLBD serves an in-memory LBD API built from the configured service
+// wallet, contracts and token types, for development without LBD access.
+func runFakeLBD(args []string) {
+	flags := flag.NewFlagSet("fake-lbd", flag.ExitOnError)
+	addr := flags.String("addr", ":9090", "address to listen on")
+	autoAuthorize := flags.Bool("auto-authorize", false, "authorize user request sessions without visiting their redirect URI")
+	inclusionDelay := flags.Duration("inclusion-delay", 0, "time before a new transaction can be looked up by its hash")
+	flags.Parse(args)
+
+	apiConfig, err := config.Load(nil, os.Environ())
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.SetAPIConfig(apiConfig)
+
+	cfg := lbdfake.ConfigFromAPIConfig(config.GetAPIConfig())
+	cfg.AutoAuthorize = *autoAuthorize
+	cfg.AutoCreateUsers = true
+	cfg.InclusionDelay = *inclusionDelay
+
+	server := lbdfake.New(cfg)
+	if userID := config.GetAPIConfig().UserID; userID != "" {
+		server.AddUser(userID)
+	}
+
+	log.Printf("fake LBD API listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package main
+
+import (
+	"flag"
+	"link/cinema/config"
+	"link/cinema/linefake"
+	"log"
+	"net/http"
+	"os"
+)
+
+// runFakeLINE serves LINE Login endpoints for the configured channel which
+// log in without asking, for development without a LINE account.
+func runFakeLINE(args []string) {
+	flags := flag.NewFlagSet("fake-line", flag.ExitOnError)
+	addr := flags.String("addr", ":9091", "address to listen on")
+	endpoint := flags.String("endpoint", "", "URL the fake is reachable at and issues ID tokens as (default LINEAccessEndpoint)")
+	displayName := flags.String("name", "", "display name of the users logged in")
+	flags.Parse(args)
+
+	apiConfig, err := config.Load(nil, os.Environ())
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.SetAPIConfig(apiConfig)
+
+	cfg := linefake.ConfigFromAPIConfig(config.GetAPIConfig())
+	if *endpoint != "" {
+		cfg.Endpoint = *endpoint
+	}
+	cfg.DisplayName = *displayName
+
+	log.Printf("fake LINE Login listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, linefake.New(cfg)))
+}
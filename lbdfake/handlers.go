@@ -0,0 +1,554 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package lbdfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"link/cinema/api"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 50
+)
+
+type handlerFunc func(r *request) (int, interface{}, *apiError)
+
+func (s *Server) newRoutes() []route {
+	routes := make([]route, 0)
+	add := func(method, pattern string, signed bool, handler handlerFunc) {
+		routes = append(routes, route{
+			method:   method,
+			segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+			signed:   signed,
+			handler:  handler,
+		})
+	}
+
+	add("GET", "/v1/time", false, s.getTime)
+
+	add("GET", "/v1/users/:userId", true, s.getUser)
+	add("GET", "/v1/users/:userId/base-coin", true, s.getBaseCoinBalance)
+	add("GET", "/v1/users/:userId/service-tokens/:contractId", true, s.getServiceTokenBalance)
+	add("GET", "/v1/users/:userId/item-tokens/:contractId/fungibles/:tokenType", true, s.getFungibleBalance)
+	add("GET", "/v1/users/:userId/item-tokens/:contractId/non-fungibles/:tokenType", true, s.getNonFungibles)
+	add("GET", "/v1/users/:userId/item-tokens/:contractId/proxy", true, s.getProxy)
+	add("GET", "/v1/users/:userId/transactions", true, s.getTransactionHistory)
+	add("GET", "/v1/transactions/:txHash", true, s.getTransaction)
+
+	add("POST", "/v1/wallets/:walletAddress/base-coin/transfer", true, s.transferBaseCoin)
+	add("POST", "/v1/wallets/:walletAddress/service-tokens/:contractId/transfer", true, s.transferServiceToken)
+	add("POST", "/v1/service-tokens/:contractId/burn-from", true, s.burnServiceTokenFrom)
+	add("POST", "/v1/item-tokens/:contractId/fungibles/:tokenType/mint", true, s.mintFungible)
+	add("POST", "/v1/item-tokens/:contractId/fungibles/:tokenType/burn", true, s.burnFungible)
+	add("POST", "/v1/item-tokens/:contractId/non-fungibles/:tokenType/mint", true, s.mintNonFungible)
+	add("PUT", "/v1/item-tokens/:contractId/non-fungibles/:tokenType/:tokenIndex", true, s.updateNonFungible)
+
+	add("POST", "/v1/users/:userId/base-coin/request-transfer", true, s.requestBaseCoinTransfer)
+	add("POST", "/v1/users/:userId/service-tokens/:contractId/request-transfer", true, s.requestServiceTokenTransfer)
+	add("POST", "/v1/users/:userId/item-tokens/:contractId/request-proxy", true, s.requestProxy)
+	add("GET", "/v1/user-requests/:token", true, s.getUserRequest)
+	add("POST", "/v1/user-requests/:token/commit", true, s.commitUserRequest)
+
+	// stands in for the user approving a request in the wallet
+	add("GET", "/wallet/user-requests/:token/authorize", false, s.authorizeUserRequest)
+
+	return routes
+}
+
+func (s *Server) getTime(r *request) (int, interface{}, *apiError) {
+	return statusSuccess, nil, nil
+}
+
+func (s *Server) getUser(r *request) (int, interface{}, *apiError) {
+	address, err := s.ledger.userAddress(r.param("userId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return statusSuccess, map[string]string{
+		"userId":        r.param("userId"),
+		"walletAddress": address,
+	}, nil
+}
+
+func (s *Server) getBaseCoinBalance(r *request) (int, interface{}, *apiError) {
+	address, err := s.ledger.userAddress(r.param("userId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return statusSuccess, map[string]interface{}{
+		"symbol":   BaseCoinSymbol,
+		"amount":   s.ledger.balance(s.ledger.baseCoin, address).String(),
+		"decimals": BaseCoinDecimals,
+	}, nil
+}
+
+func (s *Server) getServiceTokenBalance(r *request) (int, interface{}, *apiError) {
+	address, err := s.ledger.userAddress(r.param("userId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	contractID := r.param("contractId")
+	if err := s.ledger.checkServiceContract(contractID); err != nil {
+		return 0, nil, err
+	}
+	return statusSuccess, map[string]interface{}{
+		"contractId": contractID,
+		"name":       ServiceTokenName,
+		"symbol":     ServiceTokenSymbol,
+		"imgUri":     "",
+		"amount":     s.ledger.balance(s.ledger.serviceTokenBalances(contractID), address).String(),
+		"decimals":   ServiceTokenDecimals,
+	}, nil
+}
+
+func (s *Server) getFungibleBalance(r *request) (int, interface{}, *apiError) {
+	address, err := s.ledger.userAddress(r.param("userId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	contractID, tokenType := r.param("contractId"), r.param("tokenType")
+	if err := s.ledger.checkItemToken(contractID, tokenType); err != nil {
+		return 0, nil, err
+	}
+	return statusSuccess, map[string]string{
+		"name":      "MovieDiscount",
+		"tokenType": tokenType,
+		"meta":      "",
+		"amount":    s.ledger.balance(s.ledger.fungibleBalances(contractID, tokenType), address).String(),
+	}, nil
+}
+
+func (s *Server) getNonFungibles(r *request) (int, interface{}, *apiError) {
+	address, err := s.ledger.userAddress(r.param("userId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	contractID, tokenType := r.param("contractId"), r.param("tokenType")
+	if err := s.ledger.checkItemToken(contractID, tokenType); err != nil {
+		return 0, nil, err
+	}
+	tokens := make([]map[string]string, 0)
+	for _, token := range s.ledger.nonFungibles {
+		if token.contractID == contractID && token.tokenType == tokenType && token.owner == address {
+			tokens = append(tokens, map[string]string{
+				"name":       token.name,
+				"tokenIndex": token.tokenIndex,
+				"meta":       token.meta,
+			})
+		}
+	}
+	return statusSuccess, tokens, nil
+}
+
+func (s *Server) getProxy(r *request) (int, interface{}, *apiError) {
+	userID := r.param("userId")
+	if _, err := s.ledger.userAddress(userID); err != nil {
+		return 0, nil, err
+	}
+	return statusSuccess, map[string]bool{
+		"isApproved": s.ledger.proxies[userID+"/"+r.param("contractId")],
+	}, nil
+}
+
+func (s *Server) getTransaction(r *request) (int, interface{}, *apiError) {
+	tx, ok := s.ledger.txByHash[r.param("txHash")]
+	if !ok || s.clock.Now().Before(tx.time.Add(s.config.InclusionDelay)) {
+		return 0, nil, newAPIError(http.StatusNotFound, api.StatusNotFound, "Transaction not found")
+	}
+	return statusSuccess, tx, nil
+}
+
+func parseMillis(value string) (time.Time, bool, *apiError) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, newAPIError(http.StatusBadRequest, statusBadRequest, fmt.Sprintf("Invalid time: %s", value))
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), true, nil
+}
+
+// getTransactionHistory pages through the transactions involving a user,
+// newest first unless orderBy is asc. before and after are exclusive
+// bounds in milliseconds.
+func (s *Server) getTransactionHistory(r *request) (int, interface{}, *apiError) {
+	address, err := s.ledger.userAddress(r.param("userId"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	before, hasBefore, err := parseMillis(r.queryValue("before"))
+	if err != nil {
+		return 0, nil, err
+	}
+	after, hasAfter, err := parseMillis(r.queryValue("after"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	limit, page := defaultPageLimit, 1
+	if value := r.queryValue("limit"); value != "" {
+		if limit, _ = strconv.Atoi(value); limit <= 0 || limit > maxPageLimit {
+			return 0, nil, newAPIError(http.StatusBadRequest, statusBadRequest, fmt.Sprintf("Invalid limit: %s", value))
+		}
+	}
+	if value := r.queryValue("page"); value != "" {
+		if page, _ = strconv.Atoi(value); page <= 0 {
+			return 0, nil, newAPIError(http.StatusBadRequest, statusBadRequest, fmt.Sprintf("Invalid page: %s", value))
+		}
+	}
+	msgType := r.queryValue("msgType")
+
+	matched := make([]*transaction, 0)
+	for _, tx := range s.ledger.txs {
+		if msgType != "" && tx.msgType != msgType {
+			continue
+		}
+		if hasBefore && !tx.time.Before(before) {
+			continue
+		}
+		if hasAfter && !tx.time.After(after) {
+			continue
+		}
+		for _, involved := range tx.addresses {
+			if involved == address {
+				matched = append(matched, tx)
+				break
+			}
+		}
+	}
+
+	if r.queryValue("orderBy") != "asc" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].Height > matched[j].Height
+		})
+	}
+
+	start := (page - 1) * limit
+	if start >= len(matched) {
+		return statusSuccess, []*transaction{}, nil
+	}
+	end := start + limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+	return statusSuccess, matched[start:end], nil
+}
+
+func (s *Server) transferBaseCoin(r *request) (int, interface{}, *apiError) {
+	from := r.param("walletAddress")
+	if err := s.ledger.checkWallet(from, r.bodyString("walletSecret")); err != nil {
+		return 0, nil, err
+	}
+	to, err := s.ledger.userAddress(r.bodyString("toUserId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	amount, err := parseAmount(r.bodyString("amount"))
+	if err != nil {
+		return 0, nil, err
+	}
+	tx, err := s.ledger.transferBaseCoin(from, to, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(tx)
+}
+
+func (s *Server) transferServiceToken(r *request) (int, interface{}, *apiError) {
+	from, contractID := r.param("walletAddress"), r.param("contractId")
+	if err := s.ledger.checkWallet(from, r.bodyString("walletSecret")); err != nil {
+		return 0, nil, err
+	}
+	if err := s.ledger.checkServiceContract(contractID); err != nil {
+		return 0, nil, err
+	}
+	to, err := s.ledger.userAddress(r.bodyString("toUserId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	amount, err := parseAmount(r.bodyString("amount"))
+	if err != nil {
+		return 0, nil, err
+	}
+	tx, err := s.ledger.transferServiceToken(contractID, from, to, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(tx)
+}
+
+func (s *Server) burnServiceTokenFrom(r *request) (int, interface{}, *apiError) {
+	contractID := r.param("contractId")
+	if err := s.ledger.checkWallet(r.bodyString("ownerAddress"), r.bodyString("ownerSecret")); err != nil {
+		return 0, nil, err
+	}
+	if err := s.ledger.checkServiceContract(contractID); err != nil {
+		return 0, nil, err
+	}
+	userID := r.bodyString("fromUserId")
+	from, err := s.ledger.userAddress(userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !s.ledger.proxies[userID+"/"+contractID] {
+		return 0, nil, newAPIError(http.StatusBadRequest, statusNotAuthorized, "Proxy not approved by user")
+	}
+	amount, err := parseAmount(r.bodyString("amount"))
+	if err != nil {
+		return 0, nil, err
+	}
+	tx, err := s.ledger.burnServiceTokenFrom(contractID, from, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(tx)
+}
+
+func (s *Server) mintFungible(r *request) (int, interface{}, *apiError) {
+	contractID, tokenType := r.param("contractId"), r.param("tokenType")
+	if err := s.ledger.checkWallet(r.bodyString("ownerAddress"), r.bodyString("ownerSecret")); err != nil {
+		return 0, nil, err
+	}
+	if err := s.ledger.checkItemToken(contractID, tokenType); err != nil {
+		return 0, nil, err
+	}
+	to, err := s.ledger.userAddress(r.bodyString("toUserId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	amount, err := parseAmount(r.bodyString("amount"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(s.ledger.mintFungible(contractID, tokenType, to, amount))
+}
+
+func (s *Server) burnFungible(r *request) (int, interface{}, *apiError) {
+	contractID, tokenType := r.param("contractId"), r.param("tokenType")
+	if err := s.ledger.checkWallet(r.bodyString("ownerAddress"), r.bodyString("ownerSecret")); err != nil {
+		return 0, nil, err
+	}
+	if err := s.ledger.checkItemToken(contractID, tokenType); err != nil {
+		return 0, nil, err
+	}
+	userID := r.bodyString("fromUserId")
+	from, err := s.ledger.userAddress(userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !s.ledger.proxies[userID+"/"+contractID] {
+		return 0, nil, newAPIError(http.StatusBadRequest, statusNotAuthorized, "Proxy not approved by user")
+	}
+	amount, err := parseAmount(r.bodyString("amount"))
+	if err != nil {
+		return 0, nil, err
+	}
+	tx, err := s.ledger.burnFungibleFrom(contractID, tokenType, from, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(tx)
+}
+
+func (s *Server) mintNonFungible(r *request) (int, interface{}, *apiError) {
+	contractID, tokenType := r.param("contractId"), r.param("tokenType")
+	if err := s.ledger.checkWallet(r.bodyString("ownerAddress"), r.bodyString("ownerSecret")); err != nil {
+		return 0, nil, err
+	}
+	if err := s.ledger.checkItemToken(contractID, tokenType); err != nil {
+		return 0, nil, err
+	}
+	to, err := s.ledger.userAddress(r.bodyString("toUserId"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(s.ledger.mintNonFungible(contractID, tokenType, to, r.bodyString("name"), r.bodyString("meta")))
+}
+
+func (s *Server) updateNonFungible(r *request) (int, interface{}, *apiError) {
+	contractID, tokenType := r.param("contractId"), r.param("tokenType")
+	if err := s.ledger.checkWallet(r.bodyString("ownerAddress"), r.bodyString("ownerSecret")); err != nil {
+		return 0, nil, err
+	}
+	if err := s.ledger.checkItemToken(contractID, tokenType); err != nil {
+		return 0, nil, err
+	}
+	tx, err := s.ledger.updateNonFungible(contractID, tokenType, r.param("tokenIndex"), r.bodyString("name"), r.bodyString("meta"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(tx)
+}
+
+func (s *Server) requestBaseCoinTransfer(r *request) (int, interface{}, *apiError) {
+	userID := r.param("userId")
+	if _, err := s.ledger.userAddress(userID); err != nil {
+		return 0, nil, err
+	}
+	amount, err := parseAmount(r.bodyString("amount"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return s.requestResult(s.ledger.newRequest(userID, requestBaseCoinTransfer, "", r.bodyString("toAddress"), amount))
+}
+
+func (s *Server) requestServiceTokenTransfer(r *request) (int, interface{}, *apiError) {
+	userID, contractID := r.param("userId"), r.param("contractId")
+	if _, err := s.ledger.userAddress(userID); err != nil {
+		return 0, nil, err
+	}
+	if err := s.ledger.checkServiceContract(contractID); err != nil {
+		return 0, nil, err
+	}
+	amount, err := parseAmount(r.bodyString("amount"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return s.requestResult(s.ledger.newRequest(userID, requestServiceTokenTransfer, contractID, r.bodyString("toAddress"), amount))
+}
+
+func (s *Server) requestProxy(r *request) (int, interface{}, *apiError) {
+	userID, contractID := r.param("userId"), r.param("contractId")
+	if _, err := s.ledger.userAddress(userID); err != nil {
+		return 0, nil, err
+	}
+	if contractID != s.config.ItemContractID {
+		return 0, nil, newAPIError(http.StatusNotFound, api.StatusNotFound, fmt.Sprintf("Item token not found: %s", contractID))
+	}
+	return s.requestResult(s.ledger.newRequest(userID, requestProxy, contractID, r.bodyString("ownerAddress"), nil))
+}
+
+func (s *Server) requestResult(req *userRequest) (int, interface{}, *apiError) {
+	redirectURI := fmt.Sprintf("%s/wallet/user-requests/%s/authorize", strings.TrimRight(s.config.Endpoint, "/"), url.PathEscape(req.token))
+	return statusSuccess, map[string]string{
+		"requestSessionToken": req.token,
+		"redirectUri":         redirectURI,
+	}, nil
+}
+
+func (s *Server) getUserRequest(r *request) (int, interface{}, *apiError) {
+	req, err := s.ledger.request(r.param("token"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return statusSuccess, map[string]string{
+		"status": req.status,
+	}, nil
+}
+
+func (s *Server) commitUserRequest(r *request) (int, interface{}, *apiError) {
+	tx, err := s.ledger.commit(r.param("token"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return accepted(tx)
+}
+
+func (s *Server) authorizeUserRequest(r *request) (int, interface{}, *apiError) {
+	if err := s.authorize(r.param("token")); err != nil {
+		return 0, nil, err
+	}
+	return statusSuccess, map[string]string{
+		"status": requestAuthorized,
+	}, nil
+}
+
+func (s *Server) authorize(token string) *apiError {
+	req, err := s.ledger.request(token)
+	if err != nil {
+		return err
+	}
+	if req.status == requestUnauthorized {
+		req.status = requestAuthorized
+	}
+	return nil
+}
+
+func accepted(tx *transaction) (int, interface{}, *apiError) {
+	return statusAccepted, map[string]string{
+		"txHash": tx.TxHash,
+	}, nil
+}
+
+// AddUser registers a LINE user ID with an empty wallet and returns its
+// wallet address.
+func (s *Server) AddUser(userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ledger.addUser(userID)
+}
+
+// Authorize approves a user request session as the user would in the wallet.
+func (s *Server) Authorize(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.authorize(token); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ApproveProxy lets the service wallet act on the tokens of a contract
+// held by a user, as if the user approved a proxy request in the wallet.
+func (s *Server) ApproveProxy(userID, contractID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	address, err := s.ledger.userAddress(userID)
+	if err != nil {
+		return err
+	}
+	s.ledger.approveProxy(userID, contractID, address)
+	return nil
+}
+
+// FailTransaction marks a recorded transaction as failed with a code and
+// message, as a chain would report it in the raw log. Balances are left as
+// they are.
+func (s *Server) FailTransaction(txHash string, code int, codespace, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.ledger.txByHash[txHash]
+	if !ok {
+		return fmt.Errorf("unknown transaction: %s", txHash)
+	}
+	rawLog, _ := json.Marshal(map[string]interface{}{
+		"codespace": codespace,
+		"code":      code,
+		"message":   message,
+	})
+	tx.Code = code
+	tx.RawLog = string(rawLog)
+	tx.Logs = nil
+	return nil
+}
+
+// BaseCoinBalance returns the base coin balance of a wallet address.
+func (s *Server) BaseCoinBalance(address string) *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return new(big.Int).Set(s.ledger.balance(s.ledger.baseCoin, address))
+}
@@ -0,0 +1,519 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package lbdfake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"link/cinema/api"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	BaseCoinSymbol   = "TC"
+	BaseCoinDenom    = "tcony"
+	BaseCoinDecimals = 6
+
+	ServiceTokenName     = "MovieToken"
+	ServiceTokenSymbol   = "MVT"
+	ServiceTokenDecimals = 6
+
+	fungibleTokenIndex = "00000000"
+)
+
+var (
+	// the service wallet starts with plenty of base coin and service tokens
+	initialWalletBalance, _ = new(big.Int).SetString("1000000000000000000", 10)
+)
+
+type nonFungible struct {
+	contractID string
+	tokenType  string
+	tokenIndex string
+	name       string
+	meta       string
+	owner      string
+}
+
+type userRequest struct {
+	token      string
+	userID     string
+	kind       string
+	contractID string
+	toAddress  string
+	amount     *big.Int
+	status     string
+	createdAt  time.Time
+}
+
+const (
+	requestBaseCoinTransfer     = "base-coin-transfer"
+	requestServiceTokenTransfer = "service-token-transfer"
+	requestProxy                = "proxy"
+
+	requestUnauthorized = "Unauthorized"
+	requestAuthorized   = "Authorized"
+	requestCommitted    = "Committed"
+)
+
+type attribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type event struct {
+	Type       string      `json:"type"`
+	Attributes []attribute `json:"attributes"`
+}
+
+type txLog struct {
+	MsgIndex int     `json:"msg_index"`
+	Success  bool    `json:"success"`
+	Log      string  `json:"log"`
+	Events   []event `json:"events"`
+}
+
+type message struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type coin struct {
+	Amount int64  `json:"amount"`
+	Denom  string `json:"denom"`
+}
+
+type txValue struct {
+	Message    []message     `json:"msg"`
+	Fee        fee           `json:"fee"`
+	Signatures []interface{} `json:"signatures"`
+	Memo       string        `json:"memo"`
+}
+
+type fee struct {
+	Amount []coin `json:"amount"`
+	Gas    int    `json:"gas"`
+}
+
+type stdTx struct {
+	Type  string  `json:"type"`
+	Value txValue `json:"value"`
+}
+
+type transaction struct {
+	Height    uint64  `json:"height"`
+	TxHash    string  `json:"txhash"`
+	Index     int     `json:"index"`
+	Code      int     `json:"code"`
+	RawLog    string  `json:"raw_log"`
+	Logs      []txLog `json:"logs"`
+	GasWanted uint64  `json:"gasWanted"`
+	GasUsed   uint64  `json:"gasUsed"`
+	Tx        stdTx   `json:"tx"`
+	Timestamp string  `json:"timestamp"`
+
+	time      time.Time
+	msgType   string
+	addresses []string
+}
+
+// ledger is the in-memory chain state of a Server. Callers hold Server.mu.
+type ledger struct {
+	config Config
+
+	users         map[string]string
+	baseCoin      map[string]*big.Int
+	serviceTokens map[string]map[string]*big.Int
+	fungibles     map[string]map[string]*big.Int
+	nonFungibles  []*nonFungible
+	nftIndexes    map[string]int
+	proxies       map[string]bool
+	requests      map[string]*userRequest
+
+	txs        []*transaction
+	txByHash   map[string]*transaction
+	height     uint64
+	requestSeq int
+}
+
+func newLedger(cfg Config) *ledger {
+	l := &ledger{
+		config:        cfg,
+		users:         make(map[string]string),
+		baseCoin:      make(map[string]*big.Int),
+		serviceTokens: make(map[string]map[string]*big.Int),
+		fungibles:     make(map[string]map[string]*big.Int),
+		nftIndexes:    make(map[string]int),
+		proxies:       make(map[string]bool),
+		requests:      make(map[string]*userRequest),
+		txByHash:      make(map[string]*transaction),
+	}
+	l.balance(l.baseCoin, cfg.WalletAddress).Set(initialWalletBalance)
+	l.balance(l.serviceTokenBalances(cfg.ServiceContractID), cfg.WalletAddress).Set(initialWalletBalance)
+	return l
+}
+
+func (l *ledger) now() time.Time {
+	return l.config.Clock.Now()
+}
+
+func (l *ledger) balance(balances map[string]*big.Int, address string) *big.Int {
+	amount, ok := balances[address]
+	if !ok {
+		amount = new(big.Int)
+		balances[address] = amount
+	}
+	return amount
+}
+
+func (l *ledger) serviceTokenBalances(contractID string) map[string]*big.Int {
+	balances, ok := l.serviceTokens[contractID]
+	if !ok {
+		balances = make(map[string]*big.Int)
+		l.serviceTokens[contractID] = balances
+	}
+	return balances
+}
+
+func (l *ledger) fungibleBalances(contractID, tokenType string) map[string]*big.Int {
+	key := contractID + tokenType
+	balances, ok := l.fungibles[key]
+	if !ok {
+		balances = make(map[string]*big.Int)
+		l.fungibles[key] = balances
+	}
+	return balances
+}
+
+func walletAddress(seed string) string {
+	hash := sha256.Sum256([]byte(seed))
+	return "tlink1" + hex.EncodeToString(hash[:])[:38]
+}
+
+func (l *ledger) addUser(userID string) string {
+	if address, ok := l.users[userID]; ok {
+		return address
+	}
+	address := walletAddress(userID)
+	l.users[userID] = address
+	return address
+}
+
+func (l *ledger) userAddress(userID string) (string, *apiError) {
+	if address, ok := l.users[userID]; ok {
+		return address, nil
+	}
+	if l.config.AutoCreateUsers {
+		return l.addUser(userID), nil
+	}
+	return "", newAPIError(http.StatusNotFound, api.StatusNotFound, fmt.Sprintf("User not found: %s", userID))
+}
+
+func (l *ledger) checkWallet(address, secret string) *apiError {
+	if address != l.config.WalletAddress {
+		return newAPIError(http.StatusNotFound, api.StatusNotFound, fmt.Sprintf("Wallet not found: %s", address))
+	}
+	if secret != l.config.WalletSecret {
+		return newAPIError(http.StatusUnauthorized, statusInvalidAPIKey, "Invalid wallet secret")
+	}
+	return nil
+}
+
+func (l *ledger) checkServiceContract(contractID string) *apiError {
+	if contractID != l.config.ServiceContractID {
+		return newAPIError(http.StatusNotFound, api.StatusNotFound, fmt.Sprintf("Service token not found: %s", contractID))
+	}
+	return nil
+}
+
+func (l *ledger) checkItemToken(contractID, tokenType string) *apiError {
+	if contractID != l.config.ItemContractID ||
+		(tokenType != l.config.FungibleTokenType && tokenType != l.config.NonFungibleTokenType) {
+		return newAPIError(http.StatusNotFound, api.StatusNotFound, fmt.Sprintf("Item token not found: %s%s", contractID, tokenType))
+	}
+	return nil
+}
+
+func parseAmount(amount string) (*big.Int, *apiError) {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok || value.Sign() <= 0 {
+		return nil, newAPIError(http.StatusBadRequest, statusBadRequest, fmt.Sprintf("Invalid amount: %s", amount))
+	}
+	return value, nil
+}
+
+func (l *ledger) move(balances map[string]*big.Int, from, to string, amount *big.Int) *apiError {
+	fromBalance := l.balance(balances, from)
+	if fromBalance.Cmp(amount) < 0 {
+		return newAPIError(http.StatusBadRequest, api.StatusInsufficientBalance, "Insufficient balance")
+	}
+	fromBalance.Sub(fromBalance, amount)
+	l.balance(balances, to).Add(l.balance(balances, to), amount)
+	return nil
+}
+
+func (l *ledger) transferBaseCoin(from, to string, amount *big.Int) (*transaction, *apiError) {
+	if err := l.move(l.baseCoin, from, to, amount); err != nil {
+		return nil, err
+	}
+	return l.record("link/MsgSend", map[string]interface{}{
+		"fromAddress": from,
+		"toAddress":   to,
+		"amount":      coin{Amount: amount.Int64(), Denom: BaseCoinDenom},
+	}, []event{
+		newEvent("message", "action", "send", "module", "bank", "sender", from),
+		newEvent("transfer", "recipient", to, "sender", from, "amount", amount.String()+BaseCoinDenom),
+	}, from, to), nil
+}
+
+func (l *ledger) transferServiceToken(contractID, from, to string, amount *big.Int) (*transaction, *apiError) {
+	if err := l.move(l.serviceTokenBalances(contractID), from, to, amount); err != nil {
+		return nil, err
+	}
+	return l.record("token/MsgTransfer", map[string]interface{}{
+		"from":       from,
+		"to":         to,
+		"contractId": contractID,
+		"amount":     json.Number(amount.String()),
+	}, []event{
+		newEvent("message", "action", "transfer_ft", "module", "token", "sender", from),
+		newEvent("transfer", "contract_id", contractID, "from", from, "to", to, "amount", amount.String()),
+	}, from, to), nil
+}
+
+func (l *ledger) burnServiceTokenFrom(contractID, from string, amount *big.Int) (*transaction, *apiError) {
+	balance := l.balance(l.serviceTokenBalances(contractID), from)
+	if balance.Cmp(amount) < 0 {
+		return nil, newAPIError(http.StatusBadRequest, api.StatusInsufficientBalance, "Insufficient balance")
+	}
+	balance.Sub(balance, amount)
+	return l.record("token/MsgBurnFrom", map[string]interface{}{
+		"proxy":      l.config.WalletAddress,
+		"from":       from,
+		"contractId": contractID,
+		"amount":     json.Number(amount.String()),
+	}, []event{
+		newEvent("message", "action", "burn_from", "module", "token", "sender", l.config.WalletAddress),
+		newEvent("burn_from", "contract_id", contractID, "proxy", l.config.WalletAddress, "from", from, "amount", amount.String()),
+	}, l.config.WalletAddress, from), nil
+}
+
+func (l *ledger) mintFungible(contractID, tokenType, to string, amount *big.Int) *transaction {
+	balance := l.balance(l.fungibleBalances(contractID, tokenType), to)
+	balance.Add(balance, amount)
+	tokenID := tokenType + fungibleTokenIndex
+	return l.record("collection/MsgMintFT", map[string]interface{}{
+		"from":       l.config.WalletAddress,
+		"to":         to,
+		"contractId": contractID,
+		"amount":     []map[string]interface{}{{"amount": json.Number(amount.String()), "tokenId": tokenID}},
+	}, []event{
+		newEvent("message", "action", "mint_ft", "module", "collection", "sender", l.config.WalletAddress),
+		newEvent("mint_ft", "contract_id", contractID, "from", l.config.WalletAddress, "to", to, "amount", amount.String()+":"+tokenID),
+	}, l.config.WalletAddress, to)
+}
+
+func (l *ledger) burnFungibleFrom(contractID, tokenType, from string, amount *big.Int) (*transaction, *apiError) {
+	balance := l.balance(l.fungibleBalances(contractID, tokenType), from)
+	if balance.Cmp(amount) < 0 {
+		return nil, newAPIError(http.StatusBadRequest, api.StatusInsufficientBalance, "Insufficient balance")
+	}
+	balance.Sub(balance, amount)
+	tokenID := tokenType + fungibleTokenIndex
+	return l.record("collection/MsgBurnFTFrom", map[string]interface{}{
+		"proxy":      l.config.WalletAddress,
+		"from":       from,
+		"contractId": contractID,
+		"amount":     []map[string]interface{}{{"amount": json.Number(amount.String()), "tokenId": tokenID}},
+	}, []event{
+		newEvent("message", "action", "burn_ft_from", "module", "collection", "sender", l.config.WalletAddress),
+		newEvent("burn_ft_from", "contract_id", contractID, "proxy", l.config.WalletAddress, "from", from, "amount", amount.String()+":"+tokenID),
+	}, l.config.WalletAddress, from), nil
+}
+
+func (l *ledger) mintNonFungible(contractID, tokenType, to, name, meta string) *transaction {
+	key := contractID + tokenType
+	l.nftIndexes[key]++
+	token := &nonFungible{
+		contractID: contractID,
+		tokenType:  tokenType,
+		tokenIndex: fmt.Sprintf("%08x", l.nftIndexes[key]),
+		name:       name,
+		meta:       meta,
+		owner:      to,
+	}
+	l.nonFungibles = append(l.nonFungibles, token)
+	tokenID := token.tokenType + token.tokenIndex
+	return l.record("collection/MsgMintNFT", map[string]interface{}{
+		"from":       l.config.WalletAddress,
+		"to":         to,
+		"contractId": contractID,
+		"name":       name,
+		"meta":       meta,
+		"tokenType":  tokenType,
+	}, []event{
+		newEvent("message", "action", "mint_nft", "module", "collection", "sender", l.config.WalletAddress),
+		newEvent("mint_nft", "contract_id", contractID, "from", l.config.WalletAddress, "to", to, "token_id", tokenID, "name", name),
+	}, l.config.WalletAddress, to)
+}
+
+// updateNonFungible sets the name and meta of a non-fungible token, keeping
+// the name when it is empty.
+func (l *ledger) updateNonFungible(contractID, tokenType, tokenIndex, name, meta string) (*transaction, *apiError) {
+	for _, token := range l.nonFungibles {
+		if token.contractID != contractID || token.tokenType != tokenType || token.tokenIndex != tokenIndex {
+			continue
+		}
+		if name != "" {
+			token.name = name
+		}
+		token.meta = meta
+		tokenID := token.tokenType + token.tokenIndex
+		return l.record("collection/MsgModify", map[string]interface{}{
+			"owner":      l.config.WalletAddress,
+			"contractId": contractID,
+			"tokenType":  tokenType,
+			"tokenIndex": tokenIndex,
+			"changes":    []map[string]interface{}{{"field": "meta", "value": meta}},
+		}, []event{
+			newEvent("message", "action", "modify_token", "module", "collection", "sender", l.config.WalletAddress),
+			newEvent("modify_token", "contract_id", contractID, "token_id", tokenID, "meta", meta),
+		}, l.config.WalletAddress, token.owner), nil
+	}
+	return nil, newAPIError(http.StatusNotFound, api.StatusNotFound, "Token not found")
+}
+
+func (l *ledger) approveProxy(userID, contractID, approver string) *transaction {
+	l.proxies[userID+"/"+contractID] = true
+	return l.record("collection/MsgApprove", map[string]interface{}{
+		"approver":   approver,
+		"proxy":      l.config.WalletAddress,
+		"contractId": contractID,
+	}, []event{
+		newEvent("message", "action", "approve_collection", "module", "collection", "sender", approver),
+		newEvent("approve_collection", "contract_id", contractID, "approver", approver, "proxy", l.config.WalletAddress),
+	}, approver, l.config.WalletAddress)
+}
+
+func newEvent(eventType string, keyValues ...string) event {
+	e := event{Type: eventType, Attributes: make([]attribute, 0, len(keyValues)/2)}
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		e.Attributes = append(e.Attributes, attribute{Key: keyValues[i], Value: keyValues[i+1]})
+	}
+	return e
+}
+
+// record appends a successful single-message transaction involving
+// addresses to the chain.
+func (l *ledger) record(msgType string, value interface{}, events []event, addresses ...string) *transaction {
+	l.height++
+	now := l.now().UTC()
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d/%d/%s", l.height, now.UnixNano(), msgType)))
+	logs := []txLog{{MsgIndex: 0, Success: true, Log: "", Events: events}}
+	rawLog, _ := json.Marshal(logs)
+
+	tx := &transaction{
+		Height:    l.height,
+		TxHash:    strings.ToUpper(hex.EncodeToString(hash[:])),
+		Index:     0,
+		Code:      0,
+		RawLog:    string(rawLog),
+		Logs:      logs,
+		GasWanted: 200000,
+		GasUsed:   uint64(50000 + 1000*len(events)),
+		Tx: stdTx{
+			Type: "cosmos-sdk/StdTx",
+			Value: txValue{
+				Message:    []message{{Type: msgType, Value: value}},
+				Fee:        fee{Amount: []coin{}, Gas: 200000},
+				Signatures: []interface{}{},
+				Memo:       "",
+			},
+		},
+		Timestamp: now.Format(time.RFC3339),
+		time:      now,
+		msgType:   msgType,
+		addresses: addresses,
+	}
+	l.txs = append(l.txs, tx)
+	l.txByHash[tx.TxHash] = tx
+	return tx
+}
+
+func (l *ledger) newRequest(userID, kind, contractID, toAddress string, amount *big.Int) *userRequest {
+	l.requestSeq++
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d/%d", userID, kind, l.requestSeq, l.now().UnixNano())))
+	req := &userRequest{
+		token:      hex.EncodeToString(hash[:])[:32],
+		userID:     userID,
+		kind:       kind,
+		contractID: contractID,
+		toAddress:  toAddress,
+		amount:     amount,
+		status:     requestUnauthorized,
+		createdAt:  l.now(),
+	}
+	if l.config.AutoAuthorize {
+		req.status = requestAuthorized
+	}
+	l.requests[req.token] = req
+	return req
+}
+
+func (l *ledger) request(token string) (*userRequest, *apiError) {
+	req, ok := l.requests[token]
+	if !ok {
+		return nil, newAPIError(http.StatusNotFound, api.StatusNotFound, "Request session not found")
+	}
+	if req.status != requestCommitted && l.now().Sub(req.createdAt) > l.config.SessionTTL {
+		return nil, newAPIError(http.StatusBadRequest, api.StatusSessionTokenExpired, "Session token expired")
+	}
+	return req, nil
+}
+
+func (l *ledger) commit(token string) (*transaction, *apiError) {
+	req, err := l.request(token)
+	if err != nil {
+		return nil, err
+	}
+	switch req.status {
+	case requestCommitted:
+		return nil, newAPIError(http.StatusBadRequest, statusAlreadyCommitted, "Request already committed")
+	case requestUnauthorized:
+		return nil, newAPIError(http.StatusBadRequest, statusNotAuthorized, "Request not authorized by user")
+	}
+
+	from := l.users[req.userID]
+	var tx *transaction
+	switch req.kind {
+	case requestBaseCoinTransfer:
+		tx, err = l.transferBaseCoin(from, req.toAddress, req.amount)
+	case requestServiceTokenTransfer:
+		tx, err = l.transferServiceToken(req.contractID, from, req.toAddress, req.amount)
+	case requestProxy:
+		tx = l.approveProxy(req.userID, req.contractID, from)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.status = requestCommitted
+	return tx, nil
+}
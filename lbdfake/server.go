@@ -0,0 +1,308 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+// Package lbdfake is an in-memory stand-in for LBD API, for offline
+// development and integration tests. It verifies request signatures the way
+// api.Client produces them and keeps balances, user request sessions and
+// transactions in memory.
+package lbdfake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"link/cinema/api"
+	"link/cinema/config"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	statusSuccess  = 1000
+	statusAccepted = 1002
+
+	statusBadRequest       = 4000
+	statusInvalidAPIKey    = 4010
+	statusInvalidNonce     = 4012
+	statusNotAuthorized    = 4045
+	statusAlreadyCommitted = 4049
+
+	timestampTolerance = 5 * time.Minute
+	DefaultSessionTTL  = 10 * time.Minute
+)
+
+type Config struct {
+	APIKey               string
+	APISecret            string
+	WalletAddress        string
+	WalletSecret         string
+	ServiceContractID    string
+	ItemContractID       string
+	FungibleTokenType    string
+	NonFungibleTokenType string
+
+	// Endpoint is where the fake is reachable, used to build redirect URIs
+	// of user request sessions.
+	Endpoint string
+	// AutoAuthorize authorizes user request sessions as soon as they are
+	// created, as if the user approved them in the wallet right away.
+	AutoAuthorize bool
+	// AutoCreateUsers creates a user with an empty wallet the first time an
+	// unknown user ID is referenced.
+	AutoCreateUsers bool
+	// InclusionDelay hides new transactions from transaction lookups for a
+	// while, as if they were waiting to be included in a block.
+	InclusionDelay time.Duration
+	SessionTTL     time.Duration
+	Clock          api.Clock
+}
+
+// ConfigFromAPIConfig returns a Config serving the contracts, tokens and
+// service wallet of cfg.
+func ConfigFromAPIConfig(cfg *config.APIConfig) Config {
+	return Config{
+		APIKey:               cfg.APIKey,
+		APISecret:            cfg.APISecret.Reveal(),
+		WalletAddress:        cfg.WalletAddress,
+		WalletSecret:         cfg.WalletSecret.Reveal(),
+		ServiceContractID:    cfg.ServiceContractID,
+		ItemContractID:       cfg.ItemContractID,
+		FungibleTokenType:    cfg.FungibleTokenType,
+		NonFungibleTokenType: cfg.NonFungibleTokenType,
+		Endpoint:             cfg.LBDAPIEndpoint,
+	}
+}
+
+// Server is a fake LBD API server. It is safe for concurrent use.
+type Server struct {
+	config Config
+	clock  api.Clock
+	routes []route
+
+	mu     sync.Mutex
+	ledger *ledger
+	nonces map[string]time.Time
+}
+
+func New(cfg Config) *Server {
+	if cfg.Clock == nil {
+		cfg.Clock = api.SystemClock
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = DefaultSessionTTL
+	}
+	s := &Server{
+		config: cfg,
+		clock:  cfg.Clock,
+		ledger: newLedger(cfg),
+		nonces: make(map[string]time.Time),
+	}
+	s.routes = s.newRoutes()
+	return s
+}
+
+// SetEndpoint changes the endpoint used in redirect URIs, e.g. once an
+// httptest.Server has picked its address.
+func (s *Server) SetEndpoint(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.Endpoint = endpoint
+}
+
+type route struct {
+	method   string
+	segments []string
+	signed   bool
+	handler  func(r *request) (int, interface{}, *apiError)
+}
+
+type request struct {
+	params map[string]string
+	query  map[string][]string
+	body   map[string]interface{}
+}
+
+func (r *request) param(key string) string {
+	return r.params[key]
+}
+
+func (r *request) queryValue(key string) string {
+	if values := r.query[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (r *request) bodyString(key string) string {
+	switch value := r.body[key].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
+
+type apiError struct {
+	httpStatus int
+	statusCode int
+	message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d: %s", e.statusCode, e.message)
+}
+
+func newAPIError(httpStatus, statusCode int, message string) *apiError {
+	return &apiError{httpStatus: httpStatus, statusCode: statusCode, message: message}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, newAPIError(http.StatusBadRequest, statusBadRequest, err.Error()))
+		return
+	}
+
+	rt, params, found := s.match(r.Method, r.URL.Path)
+	if !found {
+		s.writeError(w, newAPIError(http.StatusNotFound, api.StatusNotFound, "Not found"))
+		return
+	}
+
+	if rt.signed {
+		if apiErr := s.verify(r, body); apiErr != nil {
+			s.writeError(w, apiErr)
+			return
+		}
+	}
+
+	req := &request{
+		params: params,
+		query:  r.URL.Query(),
+		body:   make(map[string]interface{}),
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var decoded interface{}
+		if err := decoder.Decode(&decoded); err != nil {
+			s.writeError(w, newAPIError(http.StatusBadRequest, statusBadRequest, "Invalid request body"))
+			return
+		}
+		if mp, ok := decoded.(map[string]interface{}); ok {
+			req.body = mp
+		}
+	}
+
+	s.mu.Lock()
+	statusCode, data, apiErr := rt.handler(req)
+	s.mu.Unlock()
+
+	if apiErr != nil {
+		s.writeError(w, apiErr)
+		return
+	}
+	s.write(w, http.StatusOK, statusCode, "Success", data)
+}
+
+func (s *Server) match(method, path string) (route, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, rt := range s.routes {
+		if rt.method != method || len(rt.segments) != len(segments) {
+			continue
+		}
+		params := make(map[string]string)
+		matched := true
+		for i, segment := range rt.segments {
+			if strings.HasPrefix(segment, ":") {
+				params[segment[1:]] = segments[i]
+				continue
+			}
+			if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rt, params, true
+		}
+	}
+	return route{}, nil, false
+}
+
+// verify checks the headers of a signed request the way LBD does.
+func (s *Server) verify(r *http.Request, body []byte) *apiError {
+	if r.Header.Get("service-api-key") != s.config.APIKey {
+		return newAPIError(http.StatusUnauthorized, statusInvalidAPIKey, "Invalid service-api-key")
+	}
+
+	millis, err := strconv.ParseInt(r.Header.Get("timestamp"), 10, 64)
+	if err != nil {
+		return newAPIError(http.StatusUnauthorized, api.StatusInvalidTimestamp, "Invalid timestamp")
+	}
+	timestamp := time.Unix(0, millis*int64(time.Millisecond))
+	if diff := s.clock.Now().Sub(timestamp); diff > timestampTolerance || diff < -timestampTolerance {
+		return newAPIError(http.StatusUnauthorized, api.StatusInvalidTimestamp, "Invalid timestamp")
+	}
+
+	query := ""
+	if r.URL.RawQuery != "" {
+		query = "?" + r.URL.RawQuery
+	}
+	if r.Method != "POST" && r.Method != "PUT" {
+		body = nil
+	}
+	nonce := r.Header.Get("nonce")
+	expected, err := api.Signature(s.config.APISecret, nonce, r.Header.Get("timestamp"), r.Method, r.URL.Path, query, body)
+	if err != nil || expected != r.Header.Get("signature") {
+		return newAPIError(http.StatusUnauthorized, api.StatusInvalidSignature, "Invalid signature")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for seen, at := range s.nonces {
+		if s.clock.Now().Sub(at) > 2*timestampTolerance {
+			delete(s.nonces, seen)
+		}
+	}
+	if _, seen := s.nonces[nonce]; seen {
+		return newAPIError(http.StatusUnauthorized, statusInvalidNonce, "Nonce already used")
+	}
+	s.nonces[nonce] = s.clock.Now()
+	return nil
+}
+
+func (s *Server) write(w http.ResponseWriter, httpStatus, statusCode int, message string, data interface{}) {
+	resp := map[string]interface{}{
+		"responseTime":  s.clock.Now().UnixNano() / int64(time.Millisecond),
+		"statusCode":    statusCode,
+		"statusMessage": message,
+	}
+	if data != nil {
+		resp["responseData"] = data
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err *apiError) {
+	s.write(w, err.httpStatus, err.statusCode, err.message, nil)
+}
@@ -0,0 +1,57 @@
+package lbdfake
+
+import (
+	"encoding/json"
+	"link/cinema/api"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, secret, path string, timestamp time.Time, nonce string) *http.Request {
+	millis := strconv.FormatInt(timestamp.UnixNano()/int64(time.Millisecond), 10)
+	sig, err := api.Signature(secret, nonce, millis, "GET", path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("service-api-key", "key")
+	req.Header.Set("timestamp", millis)
+	req.Header.Set("nonce", nonce)
+	req.Header.Set("signature", sig)
+	return req
+}
+
+func TestServerVerifiesRequests(t *testing.T) {
+	server := New(Config{APIKey: "key", APISecret: "secret"})
+	server.AddUser("U1")
+	now := time.Now()
+
+	testdata := []struct {
+		req        *http.Request
+		statusCode int
+	}{
+		{signedRequest(t, "secret", "/v1/users/U1", now, "nonce001"), statusSuccess},
+		{signedRequest(t, "secret", "/v1/users/U1", now, "nonce001"), statusInvalidNonce},
+		{signedRequest(t, "wrong", "/v1/users/U1", now, "nonce002"), api.StatusInvalidSignature},
+		{signedRequest(t, "secret", "/v1/users/U1", now.Add(-time.Hour), "nonce003"), api.StatusInvalidTimestamp},
+		{signedRequest(t, "secret", "/v1/users/U2", now, "nonce004"), api.StatusNotFound},
+	}
+
+	for _, data := range testdata {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, data.req)
+
+		resp := struct {
+			StatusCode int `json:"statusCode"`
+		}{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != data.statusCode {
+			t.Error("Unexpected status code", data.req.URL.Path, resp.StatusCode, data.statusCode)
+		}
+	}
+}
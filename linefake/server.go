@@ -0,0 +1,243 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+// Package linefake is an in-memory stand-in for the LINE Login endpoints,
+// for offline development and tests. Its authorize endpoint logs the user in
+// right away and redirects back with a code, and its token endpoint checks
+// the client secret and PKCE code verifier before issuing an ID token
+// signed with the channel secret.
+package linefake
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"link/cinema/api"
+	"link/cinema/auth"
+	"link/cinema/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCodeTTL    = 10 * time.Minute
+	DefaultIDTokenTTL = time.Hour
+)
+
+type Config struct {
+	ChannelID     string
+	ChannelSecret string
+
+	// Endpoint is where the fake is reachable. It is the issuer of the ID
+	// tokens, as https://access.line.me is for LINE.
+	Endpoint string
+	// UserID is who logs in when the authorize request names no user with
+	// the user query param.
+	UserID      string
+	DisplayName string
+	CodeTTL     time.Duration
+	IDTokenTTL  time.Duration
+	Clock       api.Clock
+}
+
+// ConfigFromAPIConfig returns a Config for the LINE Login channel of cfg,
+// logging in as its UserID.
+func ConfigFromAPIConfig(cfg *config.APIConfig) Config {
+	return Config{
+		ChannelID:     cfg.ChannelID,
+		ChannelSecret: cfg.ChannelSecret.Reveal(),
+		Endpoint:      cfg.LINEAccessEndpoint,
+		UserID:        cfg.UserID,
+	}
+}
+
+// grant is an authorization code waiting to be exchanged.
+type grant struct {
+	userID        string
+	displayName   string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// Server is a fake LINE Login server. It is safe for concurrent use.
+type Server struct {
+	config Config
+
+	mu     sync.Mutex
+	grants map[string]*grant
+}
+
+func New(cfg Config) *Server {
+	if cfg.Clock == nil {
+		cfg.Clock = api.SystemClock
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = DefaultCodeTTL
+	}
+	if cfg.IDTokenTTL <= 0 {
+		cfg.IDTokenTTL = DefaultIDTokenTTL
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &Server{
+		config: cfg,
+		grants: make(map[string]*grant),
+	}
+}
+
+// SetEndpoint changes the issuer of the ID tokens, e.g. once an
+// httptest.Server has picked its URL.
+func (s *Server) SetEndpoint(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.Endpoint = strings.TrimSuffix(endpoint, "/")
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/oauth2/v2.1/authorize":
+		s.authorize(w, r)
+	case r.Method == "POST" && r.URL.Path == "/oauth2/v2.1/token":
+		s.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != s.config.ChannelID || redirectURI == "" {
+		http.Error(w, "invalid client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	back := url.Values{}
+	back.Set("state", query.Get("state"))
+	userID := query.Get("user")
+	if userID == "" {
+		userID = s.config.UserID
+	}
+	switch {
+	case query.Get("response_type") != "code":
+		back.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge") != "" && query.Get("code_challenge_method") != "S256":
+		back.Set("error", "invalid_request")
+		back.Set("error_description", "code_challenge_method must be S256")
+	case userID == "":
+		back.Set("error", "access_denied")
+		back.Set("error_description", "no user to log in")
+	default:
+		code := randomString()
+		s.mu.Lock()
+		s.grants[code] = &grant{
+			userID:        userID,
+			displayName:   s.config.DisplayName,
+			redirectURI:   redirectURI,
+			nonce:         query.Get("nonce"),
+			codeChallenge: query.Get("code_challenge"),
+			expiresAt:     s.config.Clock.Now().Add(s.config.CodeTTL),
+		}
+		s.mu.Unlock()
+		back.Set("code", code)
+	}
+
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, redirectURI+separator+back.Encode(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	form := r.PostForm
+	if form.Get("grant_type") != "authorization_code" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", form.Get("grant_type"))
+		return
+	}
+	if form.Get("client_id") != s.config.ChannelID || form.Get("client_secret") != s.config.ChannelSecret {
+		writeError(w, http.StatusBadRequest, "invalid_client", "invalid client_id or client_secret")
+		return
+	}
+
+	s.mu.Lock()
+	code := form.Get("code")
+	granted, found := s.grants[code]
+	delete(s.grants, code)
+	issuer := s.config.Endpoint
+	s.mu.Unlock()
+
+	now := s.config.Clock.Now()
+	switch {
+	case !found || now.After(granted.expiresAt):
+		writeError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+		return
+	case form.Get("redirect_uri") != granted.redirectURI:
+		writeError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+		return
+	case granted.codeChallenge != "" && auth.CodeChallenge(form.Get("code_verifier")) != granted.codeChallenge:
+		writeError(w, http.StatusBadRequest, "invalid_grant", "code_verifier mismatch")
+		return
+	}
+
+	idToken := s.IDToken(auth.IDToken{
+		Issuer:    issuer,
+		Subject:   granted.userID,
+		Audience:  s.config.ChannelID,
+		ExpiresAt: now.Add(s.config.IDTokenTTL).Unix(),
+		IssuedAt:  now.Unix(),
+		Nonce:     granted.nonce,
+		Name:      granted.displayName,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auth.Token{
+		AccessToken: randomString(),
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.config.IDTokenTTL / time.Second),
+		Scope:       "profile openid",
+		IDToken:     idToken,
+	})
+}
+
+// IDToken signs claims with the channel secret.
+func (s *Server) IDToken(claims auth.IDToken) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(auth.SignHS256(s.config.ChannelSecret, signed))
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func randomString() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
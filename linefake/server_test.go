@@ -0,0 +1,138 @@
+package linefake
+
+import (
+	"context"
+	"errors"
+	"link/cinema/auth"
+	"link/cinema/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func newFakeLINE(t *testing.T, clock *fixedClock) (*auth.LINELogin, *Server, func()) {
+	fake := New(Config{
+		ChannelID:     "1234567890",
+		ChannelSecret: "channel-secret",
+		UserID:        "U0000000000000000000000000000001",
+		DisplayName:   "Tester",
+	})
+	server := httptest.NewServer(fake)
+	fake.SetEndpoint(server.URL)
+
+	cfg := &config.APIConfig{
+		LINEAccessEndpoint: server.URL,
+		LINEAPIEndpoint:    server.URL,
+		Endpoint:           "http://cinema.example",
+		ChannelID:          "1234567890",
+		ChannelSecret:      "channel-secret",
+	}
+	return auth.NewLINELogin(cfg, nil, clock), fake, server.Close
+}
+
+// authorize follows the authorize URL and returns the query of the
+// redirect back to the callback.
+func authorize(t *testing.T, login *auth.LINELogin, req *auth.LoginRequest) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(login.AuthorizeURL(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), "http://cinema.example"+auth.CallbackPath) {
+		t.Fatal("Unexpected redirect", location)
+	}
+	return location.Query()
+}
+
+func TestLogin(t *testing.T) {
+	clock := &fixedClock{now: time.Now()}
+	login, fake, closeServer := newFakeLINE(t, clock)
+	defer closeServer()
+	ctx := context.Background()
+
+	req, err := auth.NewLoginRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := authorize(t, login, req)
+	if err := req.CheckState(back.Get("state")); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.CheckState("forged"); !errors.Is(err, auth.ErrInvalidState) {
+		t.Error("Expected a forged state to be refused", err)
+	}
+
+	idToken, token, err := login.Login(ctx, back.Get("code"), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile := idToken.Profile(); profile.UserID != "U0000000000000000000000000000001" || profile.DisplayName != "Tester" || token.AccessToken == "" {
+		t.Error("Unexpected login", profile, token)
+	}
+	if _, _, err := login.Login(ctx, back.Get("code"), req); !errors.Is(err, auth.ErrTokenExchange) {
+		t.Error("Expected a code to be exchanged once", err)
+	}
+
+	// the code verifier of another login
+	other, _ := auth.NewLoginRequest()
+	back = authorize(t, login, req)
+	if _, _, err := login.Login(ctx, back.Get("code"), other); !errors.Is(err, auth.ErrTokenExchange) {
+		t.Error("Expected a wrong code verifier to be refused", err)
+	}
+
+	claims := auth.IDToken{
+		Issuer:    fake.config.Endpoint,
+		Subject:   "U0000000000000000000000000000001",
+		Audience:  "1234567890",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Nonce:     req.Nonce,
+	}
+	if _, err := login.VerifyIDToken(fake.IDToken(claims), req.Nonce); err != nil {
+		t.Error("Expected a valid ID token", err)
+	}
+
+	tests := map[string]func(claims *auth.IDToken){
+		"issuer":   func(claims *auth.IDToken) { claims.Issuer = "https://evil.example" },
+		"audience": func(claims *auth.IDToken) { claims.Audience = "other-channel" },
+		"expiry":   func(claims *auth.IDToken) { claims.ExpiresAt = time.Now().Add(-time.Minute).Unix() },
+		"nonce":    func(claims *auth.IDToken) { claims.Nonce = other.Nonce },
+	}
+	for name, change := range tests {
+		changed := claims
+		change(&changed)
+		if _, err := login.VerifyIDToken(fake.IDToken(changed), req.Nonce); !errors.Is(err, auth.ErrInvalidIDToken) {
+			t.Error("Expected an ID token with a wrong", name, "to be refused", err)
+		}
+	}
+
+	parts := strings.Split(fake.IDToken(claims), ".")
+	forged := New(Config{ChannelSecret: "other-secret"}).IDToken(claims)
+	for _, idToken := range []string{parts[0] + "." + parts[1] + ".", forged, "not-a-token"} {
+		if _, err := login.VerifyIDToken(idToken, req.Nonce); !errors.Is(err, auth.ErrInvalidIDToken) {
+			t.Error("Expected a badly signed ID token to be refused", err)
+		}
+	}
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	if _, err := login.VerifyIDToken(fake.IDToken(claims), req.Nonce); !errors.Is(err, auth.ErrInvalidIDToken) {
+		t.Error("Expected an expired ID token to be refused", err)
+	}
+}
@@ -16,17 +16,24 @@ under the License
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
+	"link/cinema/api"
+	"link/cinema/auth"
 	"link/cinema/config"
 	"link/cinema/controller"
 	"link/cinema/docs"
+	"link/cinema/pricing"
+	"link/cinema/service"
+	"link/cinema/store"
+	"log"
 	"os"
 	"strings"
+	"time"
 )
 
 // @title Link Cinema API
@@ -42,14 +49,82 @@ import (
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 
 // @BasePath /api/v0
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
-	r := gin.Default()
-	store := cookie.NewStore([]byte("secret"))
-	r.Use(sessions.Sessions("session", store))
+	if len(os.Args) > 1 && os.Args[1] == "fake-lbd" {
+		runFakeLBD(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fake-line" {
+		runFakeLINE(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:], os.Environ())
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	config.SetAPIConfig(cfg)
 
-	if configPath := os.Getenv(config.Path); configPath != "" {
-		config.LoadAPIConfig(configPath)
+	if _, err := pricing.New(config.GetAPIConfig().Pricing); err != nil {
+		log.Fatal(err)
+	}
+	if err := auth.CheckConfig(config.GetAPIConfig()); err != nil {
+		log.Fatal(err)
+	}
+	transport, err := api.TransportFromConfig(config.GetAPIConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := api.NewClient(config.GetAPIConfig(), transport, api.SystemClock)
+	api.SetClient(client)
+	go client.TimeSync().Run(context.Background())
+
+	db, err := store.Open(config.GetAPIConfig().LocalDBPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	service.SetStore(db)
+	if catalogPath := config.GetAPIConfig().CatalogPath; catalogPath != "" {
+		catalog, err := service.ReadCatalog(catalogPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := service.ImportCatalog(catalog); err != nil {
+			log.Fatal(err)
+		}
 	}
+	if err := service.SeedCatalog(); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.RegisterSyncUser(config.GetAPIConfig().UserID); err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		if err := service.ResumePurchases(context.Background()); err != nil {
+			log.Println("resuming purchases failed:", err)
+		}
+	}()
+	syncInterval := time.Duration(config.GetAPIConfig().HistorySyncIntervalSeconds) * time.Second
+	go service.NewSyncer(syncInterval).Run(context.Background())
+	go func() {
+		for range time.Tick(time.Hour) {
+			if _, err := service.PruneSessions(context.Background()); err != nil {
+				log.Println("pruning sessions failed:", err)
+			}
+		}
+	}()
+
 	host := config.GetAPIConfig().Endpoint
 	if strings.HasPrefix(host, "http://") {
 		host = host[7:]
@@ -59,44 +134,87 @@ func main() {
 	}
 	docs.SwaggerInfo.Host = host
 
-	ctr := controller.NewController()
+	r := newRouter(controller.NewController())
+	r.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+}
+
+// newRouter routes the API of ctr and its swagger docs.
+func newRouter(ctr *controller.Controller) *gin.Engine {
+	r := gin.Default()
+	r.Use(controller.Sessions())
 
 	v0 := r.Group("/api/v0")
 	{
+		v0.GET("/health", ctr.Health)
+
+		authenticated := ctr.Authenticate()
+		staffOnly := controller.RequireRole(auth.RoleStaff)
+		operatorOnly := controller.RequireRole(auth.RoleOperator)
+		adminOnly := controller.RequireRole(auth.RoleAdmin)
+
 		user := v0.Group("/user")
 		{
-			//user.GET("/login", ctr.LINELogin)
-			//user.GET("/login/callback", ctr.LINELoginCallback)
-			user.GET("/proxy", ctr.RequestProxy)
-			user.GET("/proxy/commit/:proxyToken", ctr.CommitRequestProxy)
+			user.GET("/login", ctr.LINELogin)
+			user.GET("/login/callback", ctr.LINELoginCallback)
+			user.POST("/logout", ctr.Logout)
+			user.GET("/profile", authenticated, ctr.GetProfile)
+			user.GET("/proxy", authenticated, controller.Idempotent(), ctr.RequestProxy)
+			user.GET("/proxy/commit/:proxyToken", authenticated, controller.Idempotent(), ctr.CommitRequestProxy)
 		}
 
-		ticket := v0.Group("/ticket")
+		ticket := v0.Group("/ticket", authenticated)
 		{
 			ticket.GET("/", ctr.GetPurchaseInfo)
-			ticket.POST("/purchase", ctr.RequestTicketPurchasing)
-			ticket.POST("/purchase/extra", ctr.RequestExtraPurchase)
-			ticket.POST("/purchase/commit/:baseCoinTransferToken/:movieTokenTransferToken", ctr.CommitPurchasingTicket)
+			ticket.POST("/cart", ctr.GetCartPurchaseInfo)
+			ticket.POST("/purchase", controller.Idempotent(), ctr.RequestTicketPurchasing)
+			ticket.POST("/purchase/extra", controller.Idempotent(), ctr.RequestExtraPurchase)
+			ticket.POST("/purchase/commit/:baseCoinTransferToken/:movieTokenTransferToken", controller.Idempotent(), ctr.CommitPurchasingTicket)
+			ticket.POST("/check-in/:tokenId", staffOnly, controller.Idempotent(), ctr.CheckInTicket)
+			ticket.GET("/check-in/:tokenId", staffOnly, ctr.GetCheckIn)
 		}
 
-		token := v0.Group("/token")
+		v0.GET("/movies", ctr.GetMovies)
+		v0.GET("/movies/:id/showtimes", ctr.GetShowtimes)
+		v0.GET("/showtimes/:id/seats", ctr.GetSeats)
+		v0.GET("/theaters", ctr.GetTheaters)
+
+		v0.GET("/orders", authenticated, ctr.GetOrders)
+		v0.GET("/orders/:id", authenticated, ctr.GetOrder)
+
+		token := v0.Group("/token", authenticated)
 		{
 			token.GET("/balance/base-coin", ctr.GetBaseCoinBalance)
 			token.GET("/balance/movie-discount", ctr.GetMovieDiscountBalance)
 			token.GET("/balance/movie-ticket", ctr.SearchTicketBalance)
 			token.GET("/balance/movie", ctr.GetMovieTokenBalance)
 		}
-		test := v0.Group("/test")
+		admin := v0.Group("/admin", authenticated, operatorOnly)
 		{
-			test.GET("/init", ctr.InitUser)
+			admin.PUT("/movies/:id", ctr.PutMovie)
+			admin.DELETE("/movies/:id", ctr.DeleteMovie)
+			admin.PUT("/theaters/:id", ctr.PutTheater)
+			admin.DELETE("/theaters/:id", ctr.DeleteTheater)
+			admin.PUT("/showtimes/:id", ctr.PutShowtime)
+			admin.DELETE("/showtimes/:id", ctr.DeleteShowtime)
+			admin.DELETE("/users/:userId/sessions", adminOnly, ctr.RevokeSessions)
+			admin.GET("/config", adminOnly, ctr.DescribeConfig)
+		}
+
+		// the test endpoints hand out tokens from the service wallet, so
+		// production servers do not serve them
+		if !config.GetAPIConfig().Production {
+			test := v0.Group("/test", authenticated)
+			{
+				test.GET("/init", operatorOnly, controller.Idempotent(), ctr.InitUser)
 
-			test.GET("/transaction", ctr.GetTransaction)
-			test.GET("/config", ctr.ShowConfig)
+				test.GET("/transaction", operatorOnly, ctr.GetTransaction)
+				test.GET("/config", adminOnly, ctr.ShowConfig)
+			}
 		}
 	}
 
 	url := ginSwagger.URL(fmt.Sprintf("%s/swagger/doc.json", config.GetAPIConfig().Endpoint)) // The url pointing to API definition
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
 
-	r.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
-}
\ No newline at end of file
+	return r
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"link/cinema/api"
+	"link/cinema/config"
+	"link/cinema/controller"
+	"link/cinema/lbdfake"
+	"link/cinema/service"
+	"link/cinema/store"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestNoSecretInResponses calls every route as an admin and checks that no
+// response carries a secret of the config.
+func TestNoSecretInResponses(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	service.SetStore(db)
+	defer service.SetStore(nil)
+
+	const userID = "U0000000000000000000000000000001"
+	cfg := &config.APIConfig{
+		APIKey:               "api-key",
+		APISecret:            "leaked-api-secret",
+		WalletAddress:        "tlink1servicewallet",
+		WalletSecret:         "leaked-wallet-secret",
+		ServiceContractID:    "9636a07e",
+		ItemContractID:       "61e14383",
+		FungibleTokenType:    "00000001",
+		NonFungibleTokenType: "10000001",
+		ChannelID:            "1234567890",
+		ChannelSecret:        "leaked-channel-secret",
+		QuoteSecret:          "leaked-quote-secret",
+		SessionSecret:        "leaked-session-secret",
+		Endpoint:             "http://cinema.example",
+		UserID:               userID,
+		APIKeys: []config.APIKey{
+			{Name: "admin", Key: "leaked-admin-api-key", Role: "admin", UserID: userID},
+		},
+	}
+	secrets := []config.Secret{cfg.APISecret, cfg.WalletSecret, cfg.ChannelSecret, cfg.QuoteSecret, cfg.SessionSecret, cfg.APIKeys[0].Key}
+
+	fakeConfig := lbdfake.ConfigFromAPIConfig(cfg)
+	fakeConfig.AutoAuthorize = true
+	fakeConfig.AutoCreateUsers = true
+	fake := lbdfake.New(fakeConfig)
+	lbd := httptest.NewServer(fake)
+	defer lbd.Close()
+	fake.SetEndpoint(lbd.URL)
+	cfg.LBDAPIEndpoint = lbd.URL
+
+	saved := config.GetAPIConfig()
+	defer config.SetAPIConfig(saved)
+	config.SetAPIConfig(cfg)
+	api.SetClient(api.NewClient(cfg, nil, nil))
+	defer api.SetClient(nil)
+	if err := service.SeedCatalog(); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := newRouter(controller.NewController())
+
+	param := regexp.MustCompile(`[:*][^/]+`)
+	for _, route := range r.Routes() {
+		path := param.ReplaceAllString(route.Path, "1")
+		req := httptest.NewRequest(route.Method, path, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.APIKeyHeader, cfg.APIKeys[0].Key.Reveal())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		body := w.Body.String()
+		for _, secret := range secrets {
+			if strings.Contains(body, secret.Reveal()) {
+				t.Errorf("Expected %s %s not to show a secret: %s", route.Method, path, body)
+			}
+		}
+		for _, header := range w.Header() {
+			for _, secret := range secrets {
+				if strings.Contains(strings.Join(header, " "), secret.Reveal()) {
+					t.Errorf("Expected %s %s not to show a secret in its headers", route.Method, path)
+				}
+			}
+		}
+	}
+
+	for _, path := range []string{"/api/v0/admin/config", "/api/v0/test/config"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(controller.APIKeyHeader, cfg.APIKeys[0].Key.Reveal())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != 200 || !strings.Contains(w.Body.String(), config.MaskedSecret) {
+			t.Error("Expected the config with masked secrets", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestAdminRoutesNeedOperator checks that the catalog, prices and sessions
+// under /admin cannot be changed without the operator role.
+func TestAdminRoutesNeedOperator(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	service.SetStore(db)
+	defer service.SetStore(nil)
+
+	saved := config.GetAPIConfig()
+	defer config.SetAPIConfig(saved)
+	gin.SetMode(gin.TestMode)
+
+	for _, production := range []bool{false, true} {
+		// without a channel, development servers act on UserID, a customer
+		cfg := &config.APIConfig{
+			UserID:     "U0000000000000000000000000000001",
+			Production: production,
+			APIKeys: []config.APIKey{
+				{Name: "kiosk", Key: "customer-api-key-0123", Role: "customer"},
+				{Name: "gate", Key: "staff-api-key-012345", Role: "staff"},
+			},
+		}
+		config.SetAPIConfig(cfg)
+		r := newRouter(controller.NewController())
+
+		for _, route := range r.Routes() {
+			if !strings.HasPrefix(route.Path, "/api/v0/admin/") {
+				continue
+			}
+			path := regexp.MustCompile(`:[^/]+`).ReplaceAllString(route.Path, "1")
+			for _, key := range []string{"", "customer-api-key-0123", "staff-api-key-012345"} {
+				req := httptest.NewRequest(route.Method, path, strings.NewReader(`{"price":0}`))
+				req.Header.Set("Content-Type", "application/json")
+				if key != "" {
+					req.Header.Set(controller.APIKeyHeader, key)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != 401 && w.Code != 403 {
+					t.Errorf("Expected %s %s to be refused (production %v, key %q): %d", route.Method, path, production, key, w.Code)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckInRoutesNeedStaff(t *testing.T) {
+	saved := config.GetAPIConfig()
+	defer config.SetAPIConfig(saved)
+	gin.SetMode(gin.TestMode)
+
+	config.SetAPIConfig(&config.APIConfig{
+		UserID: "U0000000000000000000000000000001",
+		APIKeys: []config.APIKey{
+			{Name: "kiosk", Key: "customer-api-key-0123", Role: "customer"},
+			{Name: "gate", Key: "staff-api-key-012345", Role: "staff"},
+		},
+	})
+	r := newRouter(controller.NewController())
+
+	for _, method := range []string{"POST", "GET"} {
+		for key, refused := range map[string]bool{"customer-api-key-0123": true, "staff-api-key-012345": false} {
+			req := httptest.NewRequest(method, "/api/v0/ticket/check-in/100000010000000a", strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(controller.APIKeyHeader, key)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if (w.Code == 403) != refused || w.Code == 404 {
+				t.Errorf("Unexpected %s check-in with key %q: %d", method, key, w.Code)
+			}
+		}
+	}
+}
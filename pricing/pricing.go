@@ -0,0 +1,256 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package pricing
+
+import (
+	"fmt"
+	"link/cinema/config"
+	"sort"
+	"time"
+)
+
+const (
+	// TokenMovieDiscount is the fungible item token redeemed as a coupon.
+	TokenMovieDiscount = "movie-discount"
+	// TokenMovie is the service token redeemed as membership points.
+	TokenMovie = "movie"
+)
+
+var (
+	// DefaultDiscounts apply when no discount rules are configured: one
+	// movie-discount token takes 5 off, and every 1000 movie tokens take 1 off,
+	// up to 1000 tokens.
+	DefaultDiscounts = []config.DiscountRule{
+		{Name: "movie-discount coupon", Token: TokenMovieDiscount, Ratio: 1, Value: 5, MaxTokens: 1},
+		{Name: "movie token redemption", Token: TokenMovie, Ratio: 1000, Value: 1, MaxTokens: 1000},
+	}
+)
+
+// Balances are token amounts by token kind, in whole tokens.
+type Balances map[string]int
+
+// Request is what tickets are priced for: the showtime, the number of
+// tickets, the time of the purchase and the tokens the user holds.
+type Request struct {
+	ShowtimeID string
+	Showtime   time.Time
+	Theater    string
+	ListPrice  int
+	Quantity   int
+	At         time.Time
+	Balances   Balances
+}
+
+func (req Request) quantity() int {
+	if req.Quantity < 1 {
+		return 1
+	}
+	return req.Quantity
+}
+
+// Price is a priced ticket. Discount is negative, as in the purchase info.
+type Price struct {
+	SubTotal    int
+	Discount    int
+	GrandTotal  int
+	Used        Balances
+	Adjustments []Adjustment
+}
+
+// Adjustment is one rule applied to a price.
+type Adjustment struct {
+	Rule   string `json:"rule"`
+	Token  string `json:"token,omitempty"`
+	Tokens int    `json:"tokens,omitempty"`
+	Amount int    `json:"amount"`
+}
+
+type rule struct {
+	name      string
+	priority  int
+	exclusive bool
+	apply     func(req Request, subTotal, remaining int, used Balances) (Adjustment, bool)
+}
+
+// Engine prices tickets by a PricingConfig. The quote and its validation
+// share one engine so they cannot disagree.
+type Engine struct {
+	cfg   config.PricingConfig
+	rules []rule
+}
+
+// New checks the rules of cfg and returns an engine applying them.
+func New(cfg config.PricingConfig) (*Engine, error) {
+	if cfg.BasePrice < 0 {
+		return nil, fmt.Errorf("negative base price: %d", cfg.BasePrice)
+	}
+	for _, showtime := range cfg.ShowtimePrices {
+		if showtime.Price < 0 {
+			return nil, fmt.Errorf("negative price of showtime %s", showtime.Showtime)
+		}
+	}
+
+	discounts := cfg.Discounts
+	if len(discounts) == 0 {
+		discounts = DefaultDiscounts
+	}
+
+	e := &Engine{cfg: cfg}
+	for _, discount := range discounts {
+		r, err := discountRule(discount)
+		if err != nil {
+			return nil, err
+		}
+		e.rules = append(e.rules, r)
+	}
+	for _, promotion := range cfg.Promotions {
+		r, err := promotionRule(promotion)
+		if err != nil {
+			return nil, err
+		}
+		e.rules = append(e.rules, r)
+	}
+	sort.SliceStable(e.rules, func(i, j int) bool {
+		return e.rules[i].priority < e.rules[j].priority
+	})
+	return e, nil
+}
+
+func discountRule(d config.DiscountRule) (rule, error) {
+	if d.Token != TokenMovieDiscount && d.Token != TokenMovie {
+		return rule{}, fmt.Errorf("discount rule %q: unknown token %q", d.Name, d.Token)
+	}
+	if d.Ratio < 0 || d.Value <= 0 || d.MaxTokens < 0 {
+		return rule{}, fmt.Errorf("discount rule %q: ratio, value and max tokens must be positive", d.Name)
+	}
+	ratio := d.Ratio
+	if ratio == 0 {
+		ratio = 1
+	}
+
+	return rule{
+		name:      d.Name,
+		priority:  d.Priority,
+		exclusive: d.Exclusive,
+		apply: func(req Request, subTotal, remaining int, used Balances) (Adjustment, bool) {
+			units := (req.Balances[d.Token] - used[d.Token]) / ratio
+			if maxUnits := d.MaxTokens / ratio * req.quantity(); d.MaxTokens > 0 && units > maxUnits {
+				units = maxUnits
+			}
+			// never take more off than is left to pay
+			if units > remaining/d.Value {
+				units = remaining / d.Value
+			}
+			if units <= 0 {
+				return Adjustment{}, false
+			}
+			return Adjustment{
+				Rule:   d.Name,
+				Token:  d.Token,
+				Tokens: units * ratio,
+				Amount: units * d.Value,
+			}, true
+		},
+	}, nil
+}
+
+func promotionRule(p config.Promotion) (rule, error) {
+	if p.Amount < 0 || p.Percent < 0 || p.Percent > 100 {
+		return rule{}, fmt.Errorf("promotion %q: amount must be positive and percent between 0 and 100", p.Name)
+	}
+	if p.ShowtimeFromHour < 0 || p.ShowtimeFromHour > 23 || p.ShowtimeUntilHour < 0 || p.ShowtimeUntilHour > 24 {
+		return rule{}, fmt.Errorf("promotion %q: invalid showtime hours", p.Name)
+	}
+
+	return rule{
+		name:      p.Name,
+		priority:  p.Priority,
+		exclusive: p.Exclusive,
+		apply: func(req Request, subTotal, remaining int, used Balances) (Adjustment, bool) {
+			if !p.From.IsZero() && req.At.Before(p.From) {
+				return Adjustment{}, false
+			}
+			if !p.Until.IsZero() && !req.At.Before(p.Until) {
+				return Adjustment{}, false
+			}
+			hour := req.Showtime.Hour()
+			if hour < p.ShowtimeFromHour || (p.ShowtimeUntilHour > 0 && hour >= p.ShowtimeUntilHour) {
+				return Adjustment{}, false
+			}
+
+			amount := p.Amount*req.quantity() + subTotal*p.Percent/100
+			if amount > remaining {
+				amount = remaining
+			}
+			if amount <= 0 {
+				return Adjustment{}, false
+			}
+			return Adjustment{Rule: p.Name, Amount: amount}, true
+		},
+	}, nil
+}
+
+// BasePrice returns the price of a ticket before discounts: the price of its
+// showtime, else the configured base price, else its list price.
+func (e *Engine) BasePrice(req Request) int {
+	for _, showtime := range e.cfg.ShowtimePrices {
+		if showtime.ShowtimeID != "" && showtime.ShowtimeID == req.ShowtimeID {
+			return showtime.Price
+		}
+		if showtime.ShowtimeID == "" && showtime.Showtime.Equal(req.Showtime) && (showtime.Theater == "" || showtime.Theater == req.Theater) {
+			return showtime.Price
+		}
+	}
+	if e.cfg.BasePrice > 0 {
+		return e.cfg.BasePrice
+	}
+	return req.ListPrice
+}
+
+// Price applies the rules to Quantity tickets in order of priority. Token
+// limits and promotion amounts are per ticket. Rules stack, except that an
+// exclusive rule applies only when no rule has yet, and stops the rules
+// after it.
+func (e *Engine) Price(req Request) Price {
+	subTotal := e.BasePrice(req) * req.quantity()
+	price := Price{
+		SubTotal: subTotal,
+		Used:     Balances{},
+	}
+
+	remaining := subTotal
+	for _, r := range e.rules {
+		if r.exclusive && len(price.Adjustments) > 0 {
+			continue
+		}
+		adjustment, ok := r.apply(req, subTotal, remaining, price.Used)
+		if !ok {
+			continue
+		}
+		remaining -= adjustment.Amount
+		if adjustment.Token != "" {
+			price.Used[adjustment.Token] += adjustment.Tokens
+		}
+		price.Adjustments = append(price.Adjustments, adjustment)
+		if r.exclusive {
+			break
+		}
+	}
+
+	price.GrandTotal = remaining
+	price.Discount = remaining - subTotal
+	return price
+}
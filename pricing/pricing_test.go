@@ -0,0 +1,120 @@
+package pricing
+
+import (
+	"link/cinema/config"
+	"testing"
+	"time"
+)
+
+var (
+	showtime = time.Date(2020, 2, 1, 11, 30, 0, 0, time.UTC)
+)
+
+func TestDefaultDiscounts(t *testing.T) {
+	engine, err := New(config.PricingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price := engine.Price(Request{
+		Showtime:  showtime,
+		ListPrice: 20,
+		Balances:  Balances{TokenMovieDiscount: 3, TokenMovie: 2500},
+	})
+	if price.SubTotal != 20 || price.Discount != -6 || price.GrandTotal != 14 {
+		t.Error("Unexpected price", price)
+	}
+	if price.Used[TokenMovieDiscount] != 1 || price.Used[TokenMovie] != 1000 {
+		t.Error("Unexpected tokens used", price.Used)
+	}
+
+	price = engine.Price(Request{Showtime: showtime, ListPrice: 20, Balances: Balances{TokenMovie: 999}})
+	if price.GrandTotal != 20 || len(price.Adjustments) != 0 || price.Used[TokenMovie] != 0 {
+		t.Error("Expected no discount", price)
+	}
+}
+
+func TestRules(t *testing.T) {
+	engine, err := New(config.PricingConfig{
+		BasePrice: 12,
+		ShowtimePrices: []config.ShowtimePrice{
+			{Showtime: showtime.Add(8 * time.Hour), Price: 18},
+		},
+		Discounts: []config.DiscountRule{
+			{Name: "coupon", Token: TokenMovieDiscount, Value: 4, MaxTokens: 2, Priority: 2},
+			{Name: "points", Token: TokenMovie, Ratio: 100, Value: 1, Priority: 3},
+		},
+		Promotions: []config.Promotion{
+			{Name: "matinee", ShowtimeUntilHour: 12, Percent: 50, Priority: 1, Exclusive: true},
+			{Name: "launch", From: showtime.Add(-time.Hour), Until: showtime, Amount: 1, Priority: 4},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	balances := Balances{TokenMovieDiscount: 5, TokenMovie: 5000}
+
+	// the exclusive matinee promotion applies first and stops the others
+	price := engine.Price(Request{Showtime: showtime, At: showtime.Add(-time.Minute), Balances: balances})
+	if price.GrandTotal != 6 || len(price.Adjustments) != 1 || price.Adjustments[0].Rule != "matinee" || len(price.Used) != 0 {
+		t.Error("Unexpected matinee price", price)
+	}
+
+	// in the evening the token discounts stack, taking no more than the price
+	evening := showtime.Add(8 * time.Hour)
+	price = engine.Price(Request{Showtime: evening, At: showtime.Add(-time.Minute), Balances: balances})
+	if price.SubTotal != 18 || price.GrandTotal != 0 || price.Discount != -18 {
+		t.Error("Unexpected evening price", price)
+	}
+	if price.Used[TokenMovieDiscount] != 2 || price.Used[TokenMovie] != 1000 || len(price.Adjustments) != 2 {
+		t.Error("Unexpected evening discounts", price.Used, price.Adjustments)
+	}
+
+	// the launch promotion is over, and the evening base price is the default
+	price = engine.Price(Request{Showtime: evening.Add(time.Hour), At: showtime, Balances: Balances{TokenMovie: 250}})
+	if price.SubTotal != 12 || price.GrandTotal != 10 || price.Used[TokenMovie] != 200 {
+		t.Error("Unexpected price after the launch", price)
+	}
+	price = engine.Price(Request{Showtime: evening.Add(time.Hour), At: showtime.Add(-time.Minute), Balances: Balances{TokenMovie: 250}})
+	if price.GrandTotal != 9 {
+		t.Error("Unexpected launch price", price)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, cfg := range []config.PricingConfig{
+		{BasePrice: -1},
+		{Discounts: []config.DiscountRule{{Name: "unknown", Token: "gold", Value: 1}}},
+		{Discounts: []config.DiscountRule{{Name: "free", Token: TokenMovie}}},
+		{Promotions: []config.Promotion{{Name: "generous", Percent: 120}}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Error("Expected rules to be refused", cfg)
+		}
+	}
+}
+
+func TestQuantity(t *testing.T) {
+	engine, err := New(config.PricingConfig{
+		Promotions: []config.Promotion{
+			{Name: "group", Amount: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price := engine.Price(Request{
+		Showtime:  showtime,
+		ListPrice: 20,
+		Quantity:  3,
+		Balances:  Balances{TokenMovieDiscount: 2, TokenMovie: 5000},
+	})
+	// 2 coupons take 10 off, 3000 movie tokens 3 and the promotion 3
+	if price.SubTotal != 60 || price.Discount != -16 || price.GrandTotal != 44 {
+		t.Error("Unexpected price", price)
+	}
+	if price.Used[TokenMovieDiscount] != 2 || price.Used[TokenMovie] != 3000 {
+		t.Error("Unexpected tokens used", price.Used)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	MaxCartTickets = 10
+)
+
+var (
+	ErrInvalidCart = errors.New("invalid cart")
+)
+
+// CartTicket is one ticket of a group purchase: its seat and the user it is
+// minted to, the buyer when RecipientID is empty.
+type CartTicket struct {
+	Sit         string `json:"sit"`
+	RecipientID string `json:"recipientId,omitempty"`
+}
+
+// Cart returns the tickets bought with info, one for the seat of its ticket
+// info when it has no cart.
+func (info PurchaseInfo) Cart() []CartTicket {
+	if len(info.Tickets) == 0 {
+		return []CartTicket{{Sit: info.TicketInfo.Sit}}
+	}
+	return info.Tickets
+}
+
+// ticketInfo returns the ticket info of a ticket of the cart.
+func (info PurchaseInfo) ticketInfo(ticket CartTicket) TicketInfo {
+	ticketInfo := info.TicketInfo
+	ticketInfo.Sit = ticket.Sit
+	return ticketInfo
+}
+
+func (t CartTicket) recipient(buyerID string) string {
+	if t.RecipientID == "" {
+		return buyerID
+	}
+	return t.RecipientID
+}
+
+// fillCart checks the tickets of a cart for a showtime, and picks the first
+// available seats for tickets without one.
+func fillCart(showtimeID string, tickets []CartTicket) ([]CartTicket, error) {
+	if len(tickets) == 0 {
+		tickets = []CartTicket{{}}
+	}
+	if len(tickets) > MaxCartTickets {
+		return nil, fmt.Errorf("%w: more than %d tickets", ErrInvalidCart, MaxCartTickets)
+	}
+
+	filled := make([]CartTicket, len(tickets))
+	taken := make(map[string]bool)
+	for i, ticket := range tickets {
+		if ticket.Sit == "" {
+			continue
+		}
+		if taken[ticket.Sit] {
+			return nil, fmt.Errorf("%w: seat %s is in the cart twice", ErrInvalidCart, ticket.Sit)
+		}
+		if err := checkSeat(showtimeID, ticket.Sit); err != nil {
+			return nil, err
+		}
+		taken[ticket.Sit] = true
+		filled[i] = ticket
+	}
+
+	var seats []SeatStatus
+	for i, ticket := range tickets {
+		if ticket.Sit != "" {
+			continue
+		}
+		if seats == nil {
+			var err error
+			if seats, err = SeatMap(showtimeID); err != nil {
+				return nil, err
+			}
+		}
+		for _, seat := range seats {
+			if seat.Status == SeatAvailable && !taken[seat.Seat] {
+				ticket.Sit = seat.Seat
+				break
+			}
+		}
+		if ticket.Sit == "" {
+			return nil, fmt.Errorf("%w: showtime %s has too few seats left", ErrSeatTaken, showtimeID)
+		}
+		taken[ticket.Sit] = true
+		filled[i] = ticket
+	}
+	return filled, nil
+}
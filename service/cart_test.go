@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGroupPurchase(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+	if err := SeedCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	fake.AddUser("friend")
+
+	if _, err := TransferBaseCoin(ctx, testUserID, "100000000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MintFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.ApproveProxy(testUserID, testConfig.ItemContractID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := IssueQuote(ctx, testUserID, DefaultShowtimeID, []CartTicket{{Sit: "A1"}, {Sit: "A1"}}); !errors.Is(err, ErrInvalidCart) {
+		t.Error("Expected a seat in the cart twice to be refused", err)
+	}
+	quote, err := IssueQuote(ctx, testUserID, DefaultShowtimeID, []CartTicket{{Sit: "B2"}, {RecipientID: "friend"}, {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quote.Tickets) != 3 || quote.Tickets[1].Sit != "A1" || quote.Tickets[2].Sit != "A2" || quote.TicketInfo.Sit != "B2" {
+		t.Fatal("Unexpected tickets", quote.Tickets)
+	}
+	// both coupons take 5 off each
+	if quote.PriceInfo.SubTotal != 3*DefaultTicket.Price || quote.PriceInfo.UsedFungible != 2 || quote.PriceInfo.GrandTotal != 3*DefaultTicket.Price-10 {
+		t.Error("Unexpected price", quote.PriceInfo)
+	}
+
+	paymentReq, err := RequestBaseCoinTransfer(ctx, testUserID, microUnits(quote.PriceInfo.GrandTotal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HoldSeats(ctx, quote.PurchaseInfo, testUserID, paymentReq.RequestSessionToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Authorize(paymentReq.RequestSessionToken); err != nil {
+		t.Fatal(err)
+	}
+	p, err := CommitPurchase(ctx, testUserID, quote.PurchaseInfo, paymentReq.RequestSessionToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the burn, the payment and three mints
+	if p.Status != PurchaseCompleted || len(p.TxHashes()) != 5 {
+		t.Error("Unexpected purchase", p.Status, p.TxHashes())
+	}
+
+	for userID, count := range map[string]int{testUserID: 2, "friend": 1} {
+		tickets, err := GetNonFungibleInfo(ctx, userID, testConfig.ItemContractID, testConfig.NonFungibleTokenType)
+		if err != nil || len(tickets) != count {
+			t.Error("Unexpected tickets", userID, len(tickets), err)
+		}
+	}
+	for _, seat := range []string{"A1", "A2", "B2"} {
+		if err := checkSeat(DefaultShowtimeID, seat); !errors.Is(err, ErrSeatTaken) {
+			t.Error("Expected the seat to be sold", seat, err)
+		}
+	}
+}
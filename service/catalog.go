@@ -0,0 +1,468 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"link/cinema/store"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultShowtimeID is the showtime of the catalog seeded from
+	// DefaultMovie and DefaultTicket.
+	DefaultShowtimeID = "default"
+
+	moviesBucket    = "catalog-movies"
+	theatersBucket  = "catalog-theaters"
+	showtimesBucket = "catalog-showtimes"
+)
+
+var (
+	ErrNotInCatalog   = errors.New("not found in catalog")
+	ErrCatalogInUse   = errors.New("catalog entry is in use")
+	ErrInvalidCatalog = errors.New("invalid catalog entry")
+)
+
+type Movie struct {
+	ID string `json:"id"`
+	MovieInfo
+}
+
+type Theater struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Screens []Screen `json:"screens"`
+}
+
+type Screen struct {
+	ID   string    `json:"id"`
+	Name string    `json:"name"`
+	Rows []SeatRow `json:"rows"`
+}
+
+// Showtime is a screening of a movie, sold at Price unless the pricing
+// rules set another base price.
+type Showtime struct {
+	ID        string    `json:"id"`
+	MovieID   string    `json:"movieId"`
+	TheaterID string    `json:"theaterId"`
+	ScreenID  string    `json:"screenId"`
+	StartsAt  time.Time `json:"startsAt"`
+	Price     int       `json:"price"`
+}
+
+// Catalog is a set of catalog entries, as read from a catalog file.
+type Catalog struct {
+	Movies    []*Movie    `json:"movies"`
+	Theaters  []*Theater  `json:"theaters"`
+	Showtimes []*Showtime `json:"showtimes"`
+}
+
+// DefaultCatalog sells DefaultMovie at DefaultTicket, as the service did
+// before it had a catalog.
+func DefaultCatalog() *Catalog {
+	return &Catalog{
+		Movies: []*Movie{
+			{ID: "the-link-movie", MovieInfo: DefaultMovie},
+		},
+		Theaters: []*Theater{
+			{ID: "world-tower", Name: "Seoul, World Tower", Screens: []Screen{{ID: "1", Name: "Theater 1", Rows: defaultRows()}}},
+		},
+		Showtimes: []*Showtime{
+			{
+				ID:        DefaultShowtimeID,
+				MovieID:   "the-link-movie",
+				TheaterID: "world-tower",
+				ScreenID:  "1",
+				StartsAt:  DefaultTicket.Date,
+				Price:     DefaultTicket.Price,
+			},
+		},
+	}
+}
+
+// defaultRows are rows A to M of 20 seats.
+func defaultRows() []SeatRow {
+	rows := make([]SeatRow, 0)
+	for name := 'A'; name <= 'M'; name++ {
+		rows = append(rows, SeatRow{Name: string(name), Seats: 20})
+	}
+	return rows
+}
+
+// ReadCatalog reads a catalog file, in JSON when its name ends with .json and
+// in TOML otherwise.
+func ReadCatalog(path string) (*Catalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, catalog)
+	} else {
+		_, err = toml.Decode(string(data), catalog)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading catalog %s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// ImportCatalog puts the entries of catalog into the local store, replacing
+// entries with the same IDs.
+func ImportCatalog(catalog *Catalog) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Update(func(tx *store.Tx) error {
+		for _, movie := range catalog.Movies {
+			if err := putMovie(tx, movie); err != nil {
+				return err
+			}
+		}
+		for _, theater := range catalog.Theaters {
+			if err := putTheater(tx, theater); err != nil {
+				return err
+			}
+		}
+		for _, showtime := range catalog.Showtimes {
+			if err := putShowtime(tx, showtime); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedCatalog imports DefaultCatalog when the catalog has no showtimes.
+func SeedCatalog() error {
+	showtimes, err := ListShowtimes("")
+	if err != nil || len(showtimes) > 0 {
+		return err
+	}
+	return ImportCatalog(DefaultCatalog())
+}
+
+func ListMovies() ([]*Movie, error) {
+	movies := make([]*Movie, 0)
+	err := listCatalog(moviesBucket, func(value []byte) error {
+		movie := &Movie{}
+		movies = append(movies, movie)
+		return json.Unmarshal(value, movie)
+	})
+	return movies, err
+}
+
+// GetMovie returns the movie with id, or nil when there is none.
+func GetMovie(id string) (*Movie, error) {
+	movie := &Movie{}
+	if found, err := getCatalog(moviesBucket, id, movie); err != nil || !found {
+		return nil, err
+	}
+	return movie, nil
+}
+
+func PutMovie(movie *Movie) error {
+	return updateCatalog(func(tx *store.Tx) error {
+		return putMovie(tx, movie)
+	})
+}
+
+// DeleteMovie removes a movie no showtime is scheduled for.
+func DeleteMovie(id string) error {
+	return updateCatalog(func(tx *store.Tx) error {
+		return deleteCatalog(tx, moviesBucket, id, func(showtime *Showtime) bool {
+			return showtime.MovieID == id
+		})
+	})
+}
+
+func ListTheaters() ([]*Theater, error) {
+	theaters := make([]*Theater, 0)
+	err := listCatalog(theatersBucket, func(value []byte) error {
+		theater := &Theater{}
+		theaters = append(theaters, theater)
+		return json.Unmarshal(value, theater)
+	})
+	return theaters, err
+}
+
+// GetTheater returns the theater with id, or nil when there is none.
+func GetTheater(id string) (*Theater, error) {
+	theater := &Theater{}
+	if found, err := getCatalog(theatersBucket, id, theater); err != nil || !found {
+		return nil, err
+	}
+	return theater, nil
+}
+
+func PutTheater(theater *Theater) error {
+	return updateCatalog(func(tx *store.Tx) error {
+		return putTheater(tx, theater)
+	})
+}
+
+// DeleteTheater removes a theater no showtime is scheduled in.
+func DeleteTheater(id string) error {
+	return updateCatalog(func(tx *store.Tx) error {
+		return deleteCatalog(tx, theatersBucket, id, func(showtime *Showtime) bool {
+			return showtime.TheaterID == id
+		})
+	})
+}
+
+// ListShowtimes returns the showtimes of a movie, or of every movie when
+// movieID is empty, earliest first.
+func ListShowtimes(movieID string) ([]*Showtime, error) {
+	showtimes := make([]*Showtime, 0)
+	err := listCatalog(showtimesBucket, func(value []byte) error {
+		showtime := &Showtime{}
+		if err := json.Unmarshal(value, showtime); err != nil {
+			return err
+		}
+		if movieID == "" || showtime.MovieID == movieID {
+			showtimes = append(showtimes, showtime)
+		}
+		return nil
+	})
+	sort.SliceStable(showtimes, func(i, j int) bool {
+		return showtimes[i].StartsAt.Before(showtimes[j].StartsAt)
+	})
+	return showtimes, err
+}
+
+// GetShowtime returns the showtime with id, or nil when there is none.
+func GetShowtime(id string) (*Showtime, error) {
+	showtime := &Showtime{}
+	if found, err := getCatalog(showtimesBucket, id, showtime); err != nil || !found {
+		return nil, err
+	}
+	return showtime, nil
+}
+
+func PutShowtime(showtime *Showtime) error {
+	return updateCatalog(func(tx *store.Tx) error {
+		return putShowtime(tx, showtime)
+	})
+}
+
+// DeleteShowtime removes a showtime with no seat sold or held, and its
+// seats.
+func DeleteShowtime(id string) error {
+	return updateCatalog(func(tx *store.Tx) error {
+		now := time.Now()
+		err := tx.ForEach(seatsPrefix+id, func(key string, value []byte) error {
+			hold := &SeatHold{}
+			if err := json.Unmarshal(value, hold); err != nil {
+				return err
+			}
+			if hold.active(now) {
+				return fmt.Errorf("%w: seat %s of showtime %s", ErrCatalogInUse, hold.Seat, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := deleteCatalog(tx, showtimesBucket, id, nil); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(seatsPrefix + id)
+	})
+}
+
+// PurchaseInfo returns the movie and the ticket for seat of a showtime,
+// unpriced.
+func (s *Showtime) PurchaseInfo(seat string) (PurchaseInfo, error) {
+	movie, err := GetMovie(s.MovieID)
+	if err != nil {
+		return PurchaseInfo{}, err
+	}
+	theater, err := GetTheater(s.TheaterID)
+	if err != nil {
+		return PurchaseInfo{}, err
+	}
+	if movie == nil || theater == nil {
+		return PurchaseInfo{}, fmt.Errorf("%w: movie or theater of showtime %s", ErrNotInCatalog, s.ID)
+	}
+	screen, ok := theater.screen(s.ScreenID)
+	if !ok {
+		return PurchaseInfo{}, fmt.Errorf("%w: screen of showtime %s", ErrNotInCatalog, s.ID)
+	}
+
+	return PurchaseInfo{
+		MovieInfo: movie.MovieInfo,
+		TicketInfo: TicketInfo{
+			ShowtimeID: s.ID,
+			Date:       s.StartsAt,
+			Theater:    theater.Name + ", " + screen.Name,
+			Sit:        seat,
+			Price:      s.Price,
+		},
+	}, nil
+}
+
+func (t *Theater) screen(id string) (Screen, bool) {
+	for _, screen := range t.Screens {
+		if screen.ID == id {
+			return screen, true
+		}
+	}
+	return Screen{}, false
+}
+
+func putMovie(tx *store.Tx, movie *Movie) error {
+	if movie.ID == "" || movie.Title == "" {
+		return fmt.Errorf("%w: movie needs an ID and a title", ErrInvalidCatalog)
+	}
+	return tx.Put(moviesBucket, movie.ID, movie)
+}
+
+func putTheater(tx *store.Tx, theater *Theater) error {
+	if theater.ID == "" || theater.Name == "" || len(theater.Screens) == 0 {
+		return fmt.Errorf("%w: theater needs an ID, a name and screens", ErrInvalidCatalog)
+	}
+	seen := make(map[string]bool)
+	for _, screen := range theater.Screens {
+		if screen.ID == "" || seen[screen.ID] {
+			return fmt.Errorf("%w: screens of theater %s need distinct IDs", ErrInvalidCatalog, theater.ID)
+		}
+		seen[screen.ID] = true
+		if err := checkRows(screen.Rows); err != nil {
+			return fmt.Errorf("%w: screen %s of theater %s: %v", ErrInvalidCatalog, screen.ID, theater.ID, err)
+		}
+	}
+	// a screen showtimes are scheduled on cannot be dropped
+	err := tx.ForEach(showtimesBucket, func(key string, value []byte) error {
+		showtime := &Showtime{}
+		if err := json.Unmarshal(value, showtime); err != nil {
+			return err
+		}
+		if showtime.TheaterID == theater.ID && !seen[showtime.ScreenID] {
+			return fmt.Errorf("%w: screen %s of showtime %s", ErrCatalogInUse, showtime.ScreenID, showtime.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Put(theatersBucket, theater.ID, theater)
+}
+
+// checkRows fails unless rows have seats and distinct names of letters, so
+// every seat name reads as one row and number.
+func checkRows(rows []SeatRow) error {
+	if len(rows) == 0 {
+		return errors.New("no seat rows")
+	}
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		if row.Name == "" || strings.TrimLeft(row.Name, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz") != "" {
+			return fmt.Errorf("row name %q is not letters", row.Name)
+		}
+		if seen[row.Name] || row.Seats <= 0 {
+			return fmt.Errorf("row %s is repeated or has no seats", row.Name)
+		}
+		seen[row.Name] = true
+	}
+	return nil
+}
+
+// putShowtime checks that the movie, theater and screen of a showtime are
+// in the catalog before putting it.
+func putShowtime(tx *store.Tx, showtime *Showtime) error {
+	if showtime.ID == "" || showtime.StartsAt.IsZero() || showtime.Price < 0 {
+		return fmt.Errorf("%w: showtime needs an ID, a start time and a price", ErrInvalidCatalog)
+	}
+	if found, err := tx.Get(moviesBucket, showtime.MovieID, &Movie{}); err != nil || !found {
+		if err == nil {
+			err = fmt.Errorf("%w: movie %s of showtime %s", ErrInvalidCatalog, showtime.MovieID, showtime.ID)
+		}
+		return err
+	}
+	theater := &Theater{}
+	found, err := tx.Get(theatersBucket, showtime.TheaterID, theater)
+	if err != nil {
+		return err
+	}
+	if _, ok := theater.screen(showtime.ScreenID); !found || !ok {
+		return fmt.Errorf("%w: theater %s or screen %s of showtime %s", ErrInvalidCatalog, showtime.TheaterID, showtime.ScreenID, showtime.ID)
+	}
+	return tx.Put(showtimesBucket, showtime.ID, showtime)
+}
+
+// deleteCatalog removes an entry, unless a showtime matched by inUse refers
+// to it.
+func deleteCatalog(tx *store.Tx, bucket, id string, inUse func(showtime *Showtime) bool) error {
+	if found, err := tx.Get(bucket, id, &json.RawMessage{}); err != nil || !found {
+		if err == nil {
+			err = ErrNotInCatalog
+		}
+		return err
+	}
+	if inUse != nil {
+		err := tx.ForEach(showtimesBucket, func(key string, value []byte) error {
+			showtime := &Showtime{}
+			if err := json.Unmarshal(value, showtime); err != nil {
+				return err
+			}
+			if inUse(showtime) {
+				return fmt.Errorf("%w: showtime %s", ErrCatalogInUse, showtime.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Delete(bucket, id)
+}
+
+func updateCatalog(fn func(tx *store.Tx) error) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Update(fn)
+}
+
+func getCatalog(bucket, id string, value interface{}) (bool, error) {
+	db := GetStore()
+	if db == nil {
+		return false, ErrNoStore
+	}
+	return db.Get(bucket, id, value)
+}
+
+func listCatalog(bucket string, fn func(value []byte) error) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.ForEach(bucket, func(key string, value []byte) error {
+		return fn(value)
+	})
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testCatalog = `
+[[Movies]]
+ID = "night"
+Title = "The Night Block"
+Year = 2021
+
+[[Theaters]]
+ID = "harbor"
+Name = "Busan, Harbor"
+Screens = [
+  { ID = "a", Name = "Screen A", Rows = [{ Name = "A", Seats = 10 }] },
+  { ID = "b", Name = "Screen B", Rows = [{ Name = "A", Seats = 8 }, { Name = "B", Seats = 8 }] },
+]
+
+[[Showtimes]]
+ID = "night-late"
+MovieID = "night"
+TheaterID = "harbor"
+ScreenID = "b"
+StartsAt = 2021-03-01T22:00:00Z
+Price = 14
+
+[[Showtimes]]
+ID = "night-early"
+MovieID = "night"
+TheaterID = "harbor"
+ScreenID = "a"
+StartsAt = 2021-03-01T18:00:00Z
+Price = 12
+`
+)
+
+func TestCatalog(t *testing.T) {
+	ctx, _, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	path := filepath.Join(t.TempDir(), "catalog.toml")
+	if err := ioutil.WriteFile(path, []byte(testCatalog), 0600); err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := ReadCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportCatalog(catalog); err != nil {
+		t.Fatal(err)
+	}
+	// the catalog has showtimes, so the default one is not seeded
+	if err := SeedCatalog(); err != nil {
+		t.Fatal(err)
+	}
+
+	showtimes, err := ListShowtimes("night")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(showtimes) != 2 || showtimes[0].ID != "night-early" || showtimes[1].ID != "night-late" {
+		t.Fatal("Unexpected showtimes", showtimes)
+	}
+	if showtime, err := GetShowtime(DefaultShowtimeID); err != nil || showtime != nil {
+		t.Error("Expected no default showtime", showtime, err)
+	}
+
+	quote, err := IssueQuote(ctx, testUserID, "night-late", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.MovieInfo.Title != "The Night Block" || quote.TicketInfo.Theater != "Busan, Harbor, Screen B" || quote.TicketInfo.Sit != "A1" || !quote.TicketInfo.Date.Equal(showtimes[1].StartsAt) {
+		t.Error("Unexpected ticket", quote.PurchaseInfo)
+	}
+	if quote.PriceInfo.SubTotal != 14 || quote.TicketInfo.Price != 14 {
+		t.Error("Unexpected price", quote.PriceInfo)
+	}
+
+	showtimes[1].Price = 16
+	if err := PutShowtime(showtimes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyQuote(ctx, quote.ID, testUserID); !errors.Is(err, ErrInvalidQuote) {
+		t.Error("Expected a quote of a repriced showtime to be refused", err)
+	}
+
+	if err := PutShowtime(&Showtime{ID: "lost", MovieID: "night", TheaterID: "harbor", ScreenID: "c", StartsAt: showtimes[0].StartsAt}); !errors.Is(err, ErrInvalidCatalog) {
+		t.Error("Expected a showtime on an unknown screen to be refused", err)
+	}
+	if err := DeleteMovie("night"); !errors.Is(err, ErrCatalogInUse) {
+		t.Error("Expected a scheduled movie to stay", err)
+	}
+	harbor, err := GetTheater("harbor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unscheduled := *harbor
+	unscheduled.Screens = harbor.Screens[1:]
+	if err := PutTheater(&unscheduled); !errors.Is(err, ErrCatalogInUse) {
+		t.Error("Expected a scheduled screen to stay", err)
+	}
+
+	sold := &SeatHold{Seat: "A2", UserID: testUserID, Session: "sold-session", Status: SeatSold}
+	if err := putSeatHolds(showtimes[0].ID, []*SeatHold{sold}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteShowtime(showtimes[0].ID); !errors.Is(err, ErrCatalogInUse) {
+		t.Error("Expected a showtime with sold seats to stay", err)
+	}
+	sold.Status, sold.ExpiresAt = SeatHeld, time.Now().Add(-time.Minute)
+	if err := GetStore().Put(seatsPrefix+showtimes[0].ID, sold.Seat, sold); err != nil {
+		t.Fatal(err)
+	}
+	for _, showtime := range showtimes {
+		if err := DeleteShowtime(showtime.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if found, err := GetStore().Get(seatsPrefix+showtimes[0].ID, sold.Seat, &SeatHold{}); err != nil || found {
+		t.Error("Expected the seats of a deleted showtime to be gone", err)
+	}
+	if err := DeleteMovie("night"); err != nil {
+		t.Error(err)
+	}
+	if err := DeleteMovie("night"); !errors.Is(err, ErrNotInCatalog) {
+		t.Error("Expected a deleted movie to be gone", err)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"link/cinema/api"
+	"link/cinema/store"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCheckInOpensBefore = time.Hour
+	DefaultCheckInClosesAfter = 30 * time.Minute
+
+	checkInsBucket = "check-ins"
+)
+
+var (
+	ErrNotTicketOwner   = errors.New("ticket is not owned by the user")
+	ErrAlreadyCheckedIn = errors.New("ticket was already checked in")
+	ErrCheckInClosed    = errors.New("check-in is not open for the showtime")
+
+	checkInWaitTimeout = DefaultWaitTimeout
+)
+
+// CheckIn is the record of a ticket shown at the theater gate. TxHash is the
+// transaction marking the ticket used on chain.
+type CheckIn struct {
+	TokenID     string    `json:"tokenId"`
+	UserID      string    `json:"userId"`
+	ShowtimeID  string    `json:"showtimeId,omitempty"`
+	Theater     string    `json:"theater"`
+	Sit         string    `json:"sit"`
+	CheckedInAt time.Time `json:"checkedInAt"`
+	TxHash      string    `json:"txHash,omitempty"`
+}
+
+// checkInWindow returns when check-in for a showtime starting at start
+// opens and closes.
+func checkInWindow(ctx context.Context, start time.Time) (time.Time, time.Time) {
+	cfg := api.FromContext(ctx).Config()
+	opensBefore, closesAfter := DefaultCheckInOpensBefore, DefaultCheckInClosesAfter
+	if cfg.CheckInOpensMinutes > 0 {
+		opensBefore = time.Duration(cfg.CheckInOpensMinutes) * time.Minute
+	}
+	if cfg.CheckInClosesMinutes > 0 {
+		closesAfter = time.Duration(cfg.CheckInClosesMinutes) * time.Minute
+	}
+	return start.Add(-opensBefore), start.Add(closesAfter)
+}
+
+// parseTicketID splits the ID of a movie ticket, with or without the item
+// contract ID in front, into its token type and index.
+func parseTicketID(ctx context.Context, tokenID string) (string, string, error) {
+	cfg := api.FromContext(ctx).Config()
+	tokenID = strings.TrimPrefix(tokenID, cfg.ItemContractID)
+	tokenType := cfg.NonFungibleTokenType
+	if !strings.HasPrefix(tokenID, tokenType) || len(tokenID) == len(tokenType) || !checkUrlParam(tokenID) {
+		return "", "", fmt.Errorf("%w: not a movie ticket: %s", ErrInvalidParam, tokenID)
+	}
+	return tokenType, strings.TrimPrefix(tokenID, tokenType), nil
+}
+
+// CheckInTicket admits the holder of a movie ticket: it checks that userID
+// owns the ticket and that its showtime is open for check-in, records the
+// check-in, and marks the ticket used in its metadata so it is refused the
+// next time. The check-in is dropped again when the transaction marking the
+// ticket fails, now or when the ticket is shown again.
+func CheckInTicket(ctx context.Context, userID, tokenID string) (*CheckIn, error) {
+	cfg := api.FromContext(ctx).Config()
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	tokenType, tokenIndex, err := parseTicketID(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	tokenID = tokenType + tokenIndex
+	key := cfg.ItemContractID + tokenID
+
+	claimed := &CheckIn{}
+	found, err := db.Get(checkInsBucket, key, claimed)
+	if err != nil {
+		return nil, err
+	}
+	if found && claimed.TxHash != "" {
+		// the ticket may be checked in again if marking it failed
+		err := settleCheckIn(ctx, db, key, claimed)
+		var txErr *TxFailedError
+		if err == nil {
+			return nil, ErrAlreadyCheckedIn
+		}
+		if !errors.As(err, &txErr) {
+			return nil, err
+		}
+	}
+
+	tickets, err := GetNonFungibleInfo(ctx, userID, cfg.ItemContractID, tokenType)
+	if err != nil {
+		return nil, err
+	}
+	var ticket *NonFungibleInfo
+	for _, info := range tickets {
+		if info.TokenIndex == tokenIndex {
+			ticket = info
+		}
+	}
+	if ticket == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotTicketOwner, tokenID)
+	}
+
+	meta := NonFungibleMetadata{}
+	if err := json.Unmarshal([]byte(ticket.Meta), &meta); err != nil {
+		return nil, err
+	}
+	if meta.CheckedInAt != nil {
+		return nil, fmt.Errorf("%w: at %s", ErrAlreadyCheckedIn, meta.CheckedInAt.Format(time.RFC3339))
+	}
+	now := time.Now()
+	opens, closes := checkInWindow(ctx, meta.TicketInfo.Date)
+	if now.Before(opens) || now.After(closes) {
+		return nil, fmt.Errorf("%w: open from %s to %s", ErrCheckInClosed, opens.Format(time.RFC3339), closes.Format(time.RFC3339))
+	}
+
+	checkIn := &CheckIn{
+		TokenID:     tokenID,
+		UserID:      userID,
+		ShowtimeID:  meta.TicketInfo.ShowtimeID,
+		Theater:     meta.TicketInfo.Theater,
+		Sit:         meta.TicketInfo.Sit,
+		CheckedInAt: now,
+	}
+	// the record is claimed before the ticket is marked, so a ticket shown
+	// at two gates at once gets in once
+	err = db.Update(func(tx *store.Tx) error {
+		if found, err := tx.Get(checkInsBucket, key, &CheckIn{}); err != nil || found {
+			if err == nil {
+				err = ErrAlreadyCheckedIn
+			}
+			return err
+		}
+		return tx.Put(checkInsBucket, key, checkIn)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	meta.CheckedInAt = &now
+	accepted, err := UpdateNonFungible(ctx, userID, cfg.ItemContractID, tokenType, tokenIndex, meta)
+	if err != nil {
+		if deleteErr := db.Delete(checkInsBucket, key); deleteErr != nil {
+			return nil, deleteErr
+		}
+		return nil, err
+	}
+	checkIn.TxHash = accepted.TxHash
+	if err := db.Put(checkInsBucket, key, checkIn); err != nil {
+		return nil, err
+	}
+	if err := settleCheckIn(ctx, db, key, checkIn); err != nil {
+		return nil, err
+	}
+	return checkIn, nil
+}
+
+// settleCheckIn waits for the transaction marking a checked in ticket used,
+// and drops the check-in when it failed. A check-in whose transaction is
+// not included in time is kept, as the ticket may still be marked.
+func settleCheckIn(ctx context.Context, db *store.DB, key string, checkIn *CheckIn) error {
+	_, err := WaitForTx(ctx, checkIn.TxHash, checkInWaitTimeout)
+	var txErr *TxFailedError
+	if errors.As(err, &txErr) {
+		if deleteErr := db.Delete(checkInsBucket, key); deleteErr != nil {
+			return deleteErr
+		}
+	}
+	return err
+}
+
+// GetCheckIn returns the check-in of a movie ticket, or nil when it has not
+// been checked in.
+func GetCheckIn(ctx context.Context, tokenID string) (*CheckIn, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	tokenType, tokenIndex, err := parseTicketID(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	checkIn := &CheckIn{}
+	found, err := db.Get(checkInsBucket, api.FromContext(ctx).Config().ItemContractID+tokenType+tokenIndex, checkIn)
+	if err != nil || !found {
+		return nil, err
+	}
+	return checkIn, nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"link/cinema/lbdfake"
+	"testing"
+	"time"
+)
+
+func TestCheckInTicket(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+	fake.AddUser("other-user")
+
+	// one ticket for a showtime starting now, one for a showtime tomorrow
+	for _, date := range []time.Time{time.Now(), time.Now().Add(24 * time.Hour)} {
+		meta := NonFungibleMetadata{MovieInfo: DefaultMovie, TicketInfo: DefaultTicket}
+		meta.TicketInfo.Date = date
+		if _, err := MintNonFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tickets, err := GetNonFungibleInfo(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType)
+	if err != nil || len(tickets) != 2 {
+		t.Fatal("Expected two tickets", len(tickets), err)
+	}
+	tonight := testConfig.ItemContractID + testConfig.NonFungibleTokenType + tickets[0].TokenIndex
+	tomorrow := testConfig.NonFungibleTokenType + tickets[1].TokenIndex
+
+	if _, err := CheckInTicket(ctx, "other-user", tonight); !errors.Is(err, ErrNotTicketOwner) {
+		t.Error("Expected a ticket of another user to be refused", err)
+	}
+	if _, err := CheckInTicket(ctx, testUserID, tomorrow); !errors.Is(err, ErrCheckInClosed) {
+		t.Error("Expected a ticket of tomorrow to be refused", err)
+	}
+	if _, err := CheckInTicket(ctx, testUserID, "20000001"+tickets[0].TokenIndex); !errors.Is(err, ErrInvalidParam) {
+		t.Error("Expected a token of another type to be refused", err)
+	}
+
+	checkIn, err := CheckInTicket(ctx, testUserID, tonight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkIn.TxHash == "" || checkIn.Sit != DefaultTicket.Sit {
+		t.Error("Unexpected check-in", checkIn)
+	}
+	if _, err := CheckInTicket(ctx, testUserID, tonight); !errors.Is(err, ErrAlreadyCheckedIn) {
+		t.Error("Expected a ticket to be checked in once", err)
+	}
+
+	stored, err := GetCheckIn(ctx, tonight)
+	if err != nil || stored == nil || stored.TxHash != checkIn.TxHash {
+		t.Error("Expected the check-in to be stored", stored, err)
+	}
+	if stored, err := GetCheckIn(ctx, tomorrow); err != nil || stored != nil {
+		t.Error("Expected no check-in of tomorrow's ticket", stored, err)
+	}
+
+	tickets, err = GetNonFungibleInfo(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := NonFungibleMetadata{}
+	if err := json.Unmarshal([]byte(tickets[0].Meta), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.CheckedInAt == nil || meta.TicketInfo.Sit != DefaultTicket.Sit {
+		t.Error("Expected the ticket to be marked used", tickets[0].Meta)
+	}
+}
+
+func TestCheckInTransactionFails(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBDWith(t, func(cfg *lbdfake.Config) {
+		cfg.InclusionDelay = 200 * time.Millisecond
+	})
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	meta := NonFungibleMetadata{MovieInfo: DefaultMovie, TicketInfo: DefaultTicket}
+	meta.TicketInfo.Date = time.Now()
+	if _, err := MintNonFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType, meta); err != nil {
+		t.Fatal(err)
+	}
+	tickets, err := GetNonFungibleInfo(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType)
+	if err != nil || len(tickets) != 1 {
+		t.Fatal("Expected a ticket", len(tickets), err)
+	}
+	tokenID := testConfig.NonFungibleTokenType + tickets[0].TokenIndex
+
+	checkInWaitTimeout = 10 * time.Millisecond
+	_, err = CheckInTicket(ctx, testUserID, tokenID)
+	checkInWaitTimeout = DefaultWaitTimeout
+	if !errors.Is(err, ErrTxTimeout) {
+		t.Fatal("Expected the check-in to wait for its transaction", err)
+	}
+	claimed, err := GetCheckIn(ctx, tokenID)
+	if err != nil || claimed == nil || claimed.TxHash == "" {
+		t.Fatal("Expected a check-in not included in time to be kept", claimed, err)
+	}
+
+	if err := fake.FailTransaction(claimed.TxHash, 5, "collection", "failed"); err != nil {
+		t.Fatal(err)
+	}
+	// the fake keeps the metadata of a failed transaction, so the ticket
+	// still reads as checked in
+	if _, err := CheckInTicket(ctx, testUserID, tokenID); !errors.Is(err, ErrAlreadyCheckedIn) {
+		t.Error("Unexpected check-in", err)
+	}
+	if checkIn, err := GetCheckIn(ctx, tokenID); err != nil || checkIn != nil {
+		t.Error("Expected the check-in of a failed transaction to be dropped", checkIn, err)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"link/cinema/api"
+	"time"
+)
+
+const (
+	DefaultWaitTimeout = 30 * time.Second
+
+	waitBaseDelay = 250 * time.Millisecond
+	waitMaxDelay  = 4 * time.Second
+)
+
+var (
+	ErrTxTimeout = errors.New("timed out waiting for transaction")
+)
+
+// TxFailedError is a transaction which was included in a block but failed.
+type TxFailedError struct {
+	TxHash    string `json:"txHash"`
+	Code      int    `json:"code"`
+	Codespace string `json:"codespace,omitempty"`
+	Message   string `json:"message"`
+}
+
+func (e *TxFailedError) Error() string {
+	return fmt.Sprintf("transaction %s failed with code %d: %s", e.TxHash, e.Code, e.Message)
+}
+
+// newTxFailedError reads the failure of tx from its raw log, which is
+// either a JSON object with code and message or plain text.
+func newTxFailedError(tx *Transaction) *TxFailedError {
+	txErr := &TxFailedError{
+		TxHash:  tx.TxHash,
+		Code:    tx.Code,
+		Message: tx.RawLog,
+	}
+	rawLog := struct {
+		Codespace string `json:"codespace"`
+		Message   string `json:"message"`
+	}{}
+	if err := json.Unmarshal([]byte(tx.RawLog), &rawLog); err == nil && rawLog.Message != "" {
+		txErr.Codespace = rawLog.Codespace
+		txErr.Message = rawLog.Message
+	}
+	return txErr
+}
+
+// WaitForTx polls LBD with backoff until the transaction is included in a
+// block. It returns a *TxFailedError when the transaction failed, and
+// ErrTxTimeout when it is not included within timeout.
+func WaitForTx(ctx context.Context, txHash string, timeout time.Duration) (*Transaction, error) {
+	if timeout <= 0 {
+		timeout = DefaultWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := waitBaseDelay
+	for {
+		tx, err := GetTransaction(ctx, txHash)
+		switch {
+		case err == nil && tx.Code != 0:
+			return tx, newTxFailedError(tx)
+		case err == nil:
+			return tx, nil
+		case ctx.Err() != nil:
+			return nil, waitError(ctx, txHash)
+		case !errors.Is(err, api.ErrNotFound):
+			return nil, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, waitError(ctx, txHash)
+		case <-timer.C:
+		}
+		delay *= 2
+		if delay > waitMaxDelay {
+			delay = waitMaxDelay
+		}
+	}
+}
+
+func waitError(ctx context.Context, txHash string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s", ErrTxTimeout, txHash)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"link/cinema/lbdfake"
+	"testing"
+	"time"
+)
+
+func TestWaitForTx(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBDWith(t, func(cfg *lbdfake.Config) {
+		cfg.InclusionDelay = 300 * time.Millisecond
+	})
+	defer closeServer()
+
+	accepted, err := TransferBaseCoin(ctx, testUserID, "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetTransaction(ctx, accepted.TxHash); err == nil {
+		t.Fatal("Expected the transaction to be pending")
+	}
+	tx, err := WaitForTx(ctx, accepted.TxHash, 5*time.Second)
+	if err != nil || tx.TxHash != accepted.TxHash {
+		t.Fatal("Unexpected transaction", tx, err)
+	}
+
+	accepted, err = TransferBaseCoin(ctx, testUserID, "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WaitForTx(ctx, accepted.TxHash, 100*time.Millisecond); !errors.Is(err, ErrTxTimeout) {
+		t.Error("Expected a timeout", err)
+	}
+
+	if err := fake.FailTransaction(accepted.TxHash, 5, "sdk", "insufficient funds"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = WaitForTx(ctx, accepted.TxHash, 5*time.Second)
+	var txErr *TxFailedError
+	if !errors.As(err, &txErr) || txErr.Code != 5 || txErr.Codespace != "sdk" || txErr.Message != "insufficient funds" {
+		t.Error("Expected a failed transaction", err)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultHistoryPageSize = 20
+	DefaultHistoryLimit    = 5
+	DefaultHistoryMaxPages = 20
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// HistoryQuery selects transactions from a user's history. Before and After
+// are exclusive bounds; Filter drops transactions after they are fetched, so
+// Limit counts only matching ones. MaxPages bounds the number of pages
+// fetched per iteration, leaving a cursor to continue from.
+type HistoryQuery struct {
+	Before   time.Time
+	After    time.Time
+	PageSize int
+	OrderBy  string
+	MsgType  string
+	Filter   func(tx *Transaction) bool
+	Limit    int
+	MaxPages int
+	Cursor   string
+}
+
+type TransactionPage struct {
+	Transactions []*Transaction `json:"transactions"`
+	NextCursor   string         `json:"nextCursor,omitempty"`
+	Freshness    *Freshness     `json:"freshness,omitempty"`
+}
+
+// historyCursor is the position of the next unread transaction. Before pins
+// the upper bound of a newest-first history, so transactions arriving
+// between requests do not shift the pages. Key is set instead when the
+// history is read from the local store.
+type historyCursor struct {
+	Page     int    `json:"p"`
+	Offset   int    `json:"o"`
+	PageSize int    `json:"s"`
+	Before   int64  `json:"b,omitempty"`
+	Key      string `json:"k,omitempty"`
+}
+
+func decodeCursor(cursor string) (*historyCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	decoded := &historyCursor{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if decoded.Page < 1 || decoded.Offset < 0 || decoded.PageSize < 1 {
+		return nil, ErrInvalidCursor
+	}
+	return decoded, nil
+}
+
+func (c *historyCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// HistoryIterator walks a user's transaction history page by page.
+type HistoryIterator struct {
+	ctx    context.Context
+	userID string
+	query  HistoryQuery
+
+	page      int
+	offset    int
+	buf       []*Transaction
+	loaded    bool
+	pages     int
+	returned  int
+	exhausted bool
+	err       error
+}
+
+func IterateTransactionHistory(ctx context.Context, userID string, query HistoryQuery) (*HistoryIterator, error) {
+	if query.PageSize <= 0 {
+		query.PageSize = DefaultHistoryPageSize
+	}
+	if query.OrderBy == "" {
+		query.OrderBy = OrderDesc
+	}
+
+	it := &HistoryIterator{
+		ctx:    ctx,
+		userID: userID,
+		query:  query,
+		page:   1,
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		it.page = cursor.Page
+		it.offset = cursor.Offset
+		it.query.PageSize = cursor.PageSize
+		if cursor.Before != 0 {
+			it.query.Before = fromMillis(cursor.Before)
+		}
+	}
+	return it, nil
+}
+
+// Next returns the next matching transaction. It returns false when the
+// history is exhausted, the limit or page budget is reached, or an error
+// occurred; check Err and Cursor to tell them apart.
+func (it *HistoryIterator) Next() (*Transaction, bool) {
+	for {
+		if it.err != nil || it.exhausted {
+			return nil, false
+		}
+		if it.query.Limit > 0 && it.returned >= it.query.Limit {
+			return nil, false
+		}
+
+		if !it.loaded {
+			if it.query.MaxPages > 0 && it.pages >= it.query.MaxPages {
+				return nil, false
+			}
+			if err := it.load(); err != nil {
+				it.err = err
+				return nil, false
+			}
+		}
+
+		if it.offset >= len(it.buf) {
+			if len(it.buf) < it.query.PageSize {
+				it.exhausted = true
+				return nil, false
+			}
+			it.page++
+			it.offset = 0
+			it.loaded = false
+			continue
+		}
+
+		tx := it.buf[it.offset]
+		it.offset++
+		if it.query.Filter == nil || it.query.Filter(tx) {
+			it.returned++
+			return tx, true
+		}
+	}
+}
+
+func (it *HistoryIterator) load() error {
+	before, after := "", ""
+	if !it.query.Before.IsZero() {
+		before = strconv.FormatInt(toMillis(it.query.Before), 10)
+	}
+	if !it.query.After.IsZero() {
+		after = strconv.FormatInt(toMillis(it.query.After), 10)
+	}
+
+	txs, err := GetTransactionHistory(it.ctx, it.userID, before, after, strconv.Itoa(it.query.PageSize), strconv.Itoa(it.page), it.query.OrderBy, it.query.MsgType)
+	if err != nil {
+		return err
+	}
+	it.pages++
+	it.buf = txs
+	it.loaded = true
+
+	// pin the upper bound once the newest transaction is known. Timestamps
+	// may be truncated to seconds, so the bound is the start of the next one.
+	if it.query.OrderBy == OrderDesc && it.query.Before.IsZero() && it.page == 1 && len(txs) > 0 {
+		if newest, ok := transactionTime(txs[0]); ok {
+			it.query.Before = newest.Truncate(time.Second).Add(time.Second)
+		}
+	}
+	return nil
+}
+
+func (it *HistoryIterator) Err() error {
+	return it.err
+}
+
+// Exhausted reports whether the whole history has been read.
+func (it *HistoryIterator) Exhausted() bool {
+	return it.exhausted
+}
+
+// Cursor returns where a later iteration should resume, or "" when the
+// history is exhausted.
+func (it *HistoryIterator) Cursor() string {
+	if it.exhausted {
+		return ""
+	}
+	cursor := &historyCursor{
+		Page:     it.page,
+		Offset:   it.offset,
+		PageSize: it.query.PageSize,
+	}
+	if !it.query.Before.IsZero() {
+		cursor.Before = toMillis(it.query.Before)
+	}
+	return cursor.encode()
+}
+
+// Collect reads the remaining matching transactions into a page.
+func (it *HistoryIterator) Collect() (*TransactionPage, error) {
+	result := &TransactionPage{
+		Transactions: make([]*Transaction, 0),
+	}
+	for {
+		tx, ok := it.Next()
+		if !ok {
+			break
+		}
+		result.Transactions = append(result.Transactions, tx)
+	}
+	if it.err != nil {
+		return result, it.err
+	}
+	result.NextCursor = it.Cursor()
+	return result, nil
+}
+
+// transactionTime parses the timestamp of tx, given either in RFC 3339 or
+// in milliseconds.
+func transactionTime(tx *Transaction) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, tx.Timestamp); err == nil {
+		return t, true
+	}
+	if millis, err := strconv.ParseInt(tx.Timestamp, 10, 64); err == nil {
+		return fromMillis(millis), true
+	}
+	return time.Time{}, false
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
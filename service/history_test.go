@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestHistoryIterator(t *testing.T) {
+	ctx, _, closeServer := newFakeLBD(t)
+	defer closeServer()
+
+	hashes := make([]string, 0)
+	for i := 0; i < 7; i++ {
+		tx, err := TransferBaseCoin(ctx, testUserID, "1000000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, tx.TxHash)
+		if _, err := MintFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := HistoryQuery{
+		PageSize: 3,
+		MsgType:  "link/MsgSend",
+		Limit:    4,
+	}
+	first, err := GetBaseCoinTransactionHistory(ctx, testUserID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Transactions) != 4 || first.NextCursor == "" {
+		t.Fatal("Unexpected first page", len(first.Transactions), first.NextCursor)
+	}
+
+	query.Cursor = first.NextCursor
+	second, err := GetBaseCoinTransactionHistory(ctx, testUserID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Transactions) != 3 || second.NextCursor != "" {
+		t.Fatal("Unexpected second page", len(second.Transactions), second.NextCursor)
+	}
+
+	all := append(first.Transactions, second.Transactions...)
+	for i, tx := range all {
+		if tx.TxHash != hashes[len(hashes)-1-i] {
+			t.Error("Unexpected order", i, tx.TxHash)
+		}
+	}
+
+	it, err := IterateTransactionHistory(ctx, testUserID, HistoryQuery{
+		PageSize: 2,
+		MaxPages: 2,
+		Filter: func(tx *Transaction) bool {
+			return tx.Tx.Value.Message[0].Type == "collection/MsgMintFT"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Transactions) != 2 || page.NextCursor == "" || it.Exhausted() {
+		t.Error("Expected the page budget to stop the iteration", len(page.Transactions), page.NextCursor)
+	}
+
+	if _, err := IterateTransactionHistory(ctx, testUserID, HistoryQuery{Cursor: "invalid"}); err != ErrInvalidCursor {
+		t.Error("Expected an invalid cursor", err)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"errors"
+	"link/cinema/store"
+	"time"
+)
+
+const (
+	// IdempotencyKeyTTL is how long the response to a request is replayed
+	// for requests with the same key.
+	IdempotencyKeyTTL = 24 * time.Hour
+
+	// a claim left by a request which never finished expires after
+	// idempotencyClaimTTL, so the key can be retried
+	idempotencyClaimTTL = 10 * time.Minute
+
+	idempotencyBucket = "idempotency-keys"
+)
+
+var (
+	ErrIdempotencyConflict   = errors.New("idempotency key was used for a different request")
+	ErrIdempotencyInProgress = errors.New("request with the same idempotency key is in progress")
+)
+
+// IdempotentResponse is a response saved to be replayed.
+type IdempotentResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+type idempotencyRecord struct {
+	Fingerprint string              `json:"fingerprint"`
+	Response    *IdempotentResponse `json:"response,omitempty"`
+	CreatedAt   time.Time           `json:"createdAt"`
+}
+
+func (r *idempotencyRecord) expired(now time.Time) bool {
+	if r.Response == nil {
+		return now.Sub(r.CreatedAt) > idempotencyClaimTTL
+	}
+	return now.Sub(r.CreatedAt) > IdempotencyKeyTTL
+}
+
+// ClaimIdempotencyKey claims key for a request with fingerprint and returns
+// nil, or returns the saved response of the request which claimed it
+// before. A request with another fingerprint, or one made while the first
+// is in progress, is refused.
+func ClaimIdempotencyKey(key, fingerprint string) (*IdempotentResponse, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+
+	var saved *IdempotentResponse
+	err := db.Update(func(tx *store.Tx) error {
+		now := time.Now()
+		record := &idempotencyRecord{}
+		found, err := tx.Get(idempotencyBucket, key, record)
+		if err != nil {
+			return err
+		}
+		if found && !record.expired(now) {
+			switch {
+			case record.Fingerprint != fingerprint:
+				return ErrIdempotencyConflict
+			case record.Response == nil:
+				return ErrIdempotencyInProgress
+			}
+			saved = record.Response
+			return nil
+		}
+		return tx.Put(idempotencyBucket, key, &idempotencyRecord{Fingerprint: fingerprint, CreatedAt: now})
+	})
+	return saved, err
+}
+
+// SaveIdempotentResponse saves the response to the request which claimed
+// key.
+func SaveIdempotentResponse(key string, resp *IdempotentResponse) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Update(func(tx *store.Tx) error {
+		record := &idempotencyRecord{}
+		found, err := tx.Get(idempotencyBucket, key, record)
+		if err != nil || !found {
+			return err
+		}
+		record.Response = resp
+		return tx.Put(idempotencyBucket, key, record)
+	})
+}
+
+// ReleaseIdempotencyKey drops the claim on key, so the request can be
+// retried with it.
+func ReleaseIdempotencyKey(key string) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Delete(idempotencyBucket, key)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"link/cinema/api"
+	"link/cinema/config"
+	"link/cinema/lbdfake"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testUserID = "U0000000000000000000000000000001"
+)
+
+var (
+	testConfig = config.APIConfig{
+		APIKey:               "api-key",
+		APISecret:            "api-secret",
+		WalletAddress:        "tlink1servicewallet",
+		WalletSecret:         "wallet-secret",
+		ServiceContractID:    "9636a07e",
+		ItemContractID:       "61e14383",
+		FungibleTokenType:    "00000001",
+		NonFungibleTokenType: "10000001",
+		UserID:               testUserID,
+	}
+)
+
+// newFakeLBD starts a fake LBD server and returns a context whose calls go
+// to it.
+func newFakeLBD(t *testing.T) (context.Context, *lbdfake.Server, func()) {
+	return newFakeLBDWith(t, func(*lbdfake.Config) {})
+}
+
+// newFakeLBDWith is newFakeLBD with the fake configured by configure.
+func newFakeLBDWith(t *testing.T, configure func(cfg *lbdfake.Config)) (context.Context, *lbdfake.Server, func()) {
+	cfg := testConfig
+	fakeConfig := lbdfake.ConfigFromAPIConfig(&cfg)
+	configure(&fakeConfig)
+	fake := lbdfake.New(fakeConfig)
+	fake.AddUser(testUserID)
+
+	server := httptest.NewServer(fake)
+	fake.SetEndpoint(server.URL)
+	cfg.LBDAPIEndpoint = server.URL
+
+	client := api.NewClient(&cfg, nil, nil)
+	return api.NewContext(context.Background(), client), fake, server.Close
+}
+
+func commitAuthorized(t *testing.T, ctx context.Context, fake *lbdfake.Server, req *TransferRequestResult) *TransactionAccepted {
+	if err := fake.Authorize(req.RequestSessionToken); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := CommitTransferRequest(ctx, req.RequestSessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestPurchaseAgainstFakeLBD(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+
+	if _, err := TransferBaseCoin(ctx, testUserID, "100000000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MintFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType, "10"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BurnFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType, "1"); err == nil {
+		t.Error("Expected burning without a proxy to fail")
+	}
+	proxyReq, err := RequestProxy(ctx, testUserID, testConfig.ItemContractID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitAuthorized(t, ctx, fake, proxyReq)
+	if approved, err := GetProxySetting(ctx, testUserID, testConfig.ItemContractID); err != nil || !approved {
+		t.Fatal("Expected the proxy to be approved", err)
+	}
+	if _, err := BurnFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	pointTx, err := TransferServiceToken(ctx, testUserID, testConfig.ServiceContractID, "1500000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paymentReq, err := RequestBaseCoinTransfer(ctx, testUserID, "15000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CommitTransferRequest(ctx, paymentReq.RequestSessionToken); err == nil {
+		t.Error("Expected committing an unauthorized request to fail")
+	}
+	paymentTx := commitAuthorized(t, ctx, fake, paymentReq)
+
+	meta := NonFungibleMetadata{
+		MovieInfo:  DefaultMovie,
+		TicketInfo: DefaultTicket,
+		PaymentInfo: PaymentInfo{
+			PaymentDate:        time.Now(),
+			PaymentTransaction: paymentTx.TxHash,
+			PointTransaction:   pointTx.TxHash,
+		},
+	}
+	mintTx, err := MintNonFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseCoin, err := GetBaseCoinBalance(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseCoin.Amount != "85000000" {
+		t.Error("Unexpected base coin balance", baseCoin.Amount)
+	}
+	fungible, err := GetFungibleBalance(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fungible.Amount != "9" {
+		t.Error("Unexpected fungible balance", fungible.Amount)
+	}
+
+	tickets, err := GetNonFungibleInfo(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tickets) != 1 {
+		t.Fatal("Unexpected tickets", tickets)
+	}
+	storedMeta := NonFungibleMetadata{}
+	if err := json.Unmarshal([]byte(tickets[0].Meta), &storedMeta); err != nil {
+		t.Fatal(err)
+	}
+	if storedMeta.PaymentInfo.PaymentTransaction != paymentTx.TxHash {
+		t.Error("Unexpected ticket meta", tickets[0].Meta)
+	}
+
+	history, err := GetNonFungibleTransactionHistory(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType, tickets[0].TokenIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.MintTransaction == nil || history.MintTransaction.TxHash != mintTx.TxHash {
+		t.Error("Unexpected mint transaction", history.MintTransaction)
+	}
+	if history.PaymentTransaction == nil || history.PaymentTransaction.TxHash != paymentTx.TxHash {
+		t.Error("Unexpected payment transaction", history.PaymentTransaction)
+	}
+	if history.PointTransaction == nil || history.PointTransaction.TxHash != pointTx.TxHash {
+		t.Error("Unexpected point transaction", history.PointTransaction)
+	}
+
+	txs, err := GetBaseCoinTransactionHistory(ctx, testUserID, HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs.Transactions) != 2 || txs.Transactions[0].TxHash != paymentTx.TxHash {
+		t.Error("Unexpected base coin history", txs.Transactions)
+	}
+}
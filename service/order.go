@@ -0,0 +1,291 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"link/cinema/store"
+	"time"
+)
+
+const (
+	OrderCreated     = "created"
+	OrderCommitting  = "committing"
+	OrderCompleted   = "completed"
+	OrderRollingBack = "rolling-back"
+	OrderRolledBack  = "rolled-back"
+	OrderFailed      = "failed"
+
+	DefaultOrderPageSize = 20
+
+	ordersBucket        = "orders"
+	orderSessionsBucket = "order-sessions"
+	orderQuotesBucket   = "order-quotes"
+	userOrdersPrefix    = "user-orders:"
+)
+
+var (
+	ErrNoStore = errors.New("local store is not configured")
+
+	purchaseOrderStatuses = map[string]string{
+		PurchaseRunning:      OrderCommitting,
+		PurchaseCompleted:    OrderCompleted,
+		PurchaseCompensating: OrderRollingBack,
+		PurchaseCompensated:  OrderRolledBack,
+		PurchaseFailed:       OrderFailed,
+	}
+)
+
+// Order is the record of a ticket purchase, from the payment request to the
+// minted ticket.
+type Order struct {
+	ID                string          `json:"id"`
+	UserID            string          `json:"userId"`
+	QuoteID           string          `json:"quoteId"`
+	ShowtimeID        string          `json:"showtimeId"`
+	MovieInfo         MovieInfo       `json:"movieInfo"`
+	TicketInfo        TicketInfo      `json:"ticketInfo"`
+	PriceInfo         PriceInfo       `json:"priceInfo"`
+	Tickets           []CartTicket    `json:"tickets,omitempty"`
+	PaymentSession    string          `json:"paymentSession"`
+	MovieTokenSession string          `json:"movieTokenSession,omitempty"`
+	PurchaseID        string          `json:"purchaseId,omitempty"`
+	Status            string          `json:"status"`
+	Steps             []*PurchaseStep `json:"steps,omitempty"`
+	Error             string          `json:"error,omitempty"`
+	Timeline          []OrderEvent    `json:"timeline"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
+}
+
+type OrderEvent struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+type OrderPage struct {
+	Orders     []*Order `json:"orders"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// PurchaseInfo returns the movie, ticket and price the order was placed
+// with.
+func (o *Order) PurchaseInfo() PurchaseInfo {
+	return PurchaseInfo{
+		MovieInfo:  o.MovieInfo,
+		TicketInfo: o.TicketInfo,
+		PriceInfo:  o.PriceInfo,
+		Tickets:    o.Tickets,
+	}
+}
+
+func (o *Order) setStatus(status string, at time.Time) {
+	if o.Status == status {
+		return
+	}
+	o.Status = status
+	o.Timeline = append(o.Timeline, OrderEvent{Status: status, At: at})
+}
+
+// CreateOrder records a purchase at the price of quote, whose payment was
+// requested with the base coin transfer session paymentSession.
+func CreateOrder(quote *Quote, paymentSession string) (*Order, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+
+	now := time.Now()
+	order := &Order{
+		ID:             newRecordID(),
+		UserID:         quote.UserID,
+		QuoteID:        quote.ID,
+		ShowtimeID:     quote.ShowtimeID,
+		MovieInfo:      quote.MovieInfo,
+		TicketInfo:     quote.TicketInfo,
+		PriceInfo:      quote.PriceInfo,
+		Tickets:        quote.Tickets,
+		PaymentSession: paymentSession,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	order.setStatus(OrderCreated, now)
+
+	err := db.Update(func(tx *store.Tx) error {
+		if err := tx.Put(ordersBucket, order.ID, order); err != nil {
+			return err
+		}
+		if err := tx.Put(orderSessionsBucket, paymentSession, order.ID); err != nil {
+			return err
+		}
+		if err := tx.Put(orderQuotesBucket, quote.ID, order.ID); err != nil {
+			return err
+		}
+		return tx.Put(userOrdersPrefix+order.UserID, userOrderKey(order), order.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func userOrderKey(order *Order) string {
+	return fmt.Sprintf("%020d-%s", toMillis(order.CreatedAt), order.ID)
+}
+
+// GetOrder returns an order, or nil when there is none.
+func GetOrder(id string) (*Order, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	order := &Order{}
+	found, err := db.Get(ordersBucket, id, order)
+	if err != nil || !found {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetOrderBySession returns the order paid with a base coin transfer
+// session, or nil when there is none.
+func GetOrderBySession(paymentSession string) (*Order, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	id := ""
+	found, err := db.Get(orderSessionsBucket, paymentSession, &id)
+	if err != nil || !found {
+		return nil, err
+	}
+	return GetOrder(id)
+}
+
+// GetOrderByQuote returns the order placed at a quote, or nil when there is
+// none.
+func GetOrderByQuote(quoteID string) (*Order, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	id := ""
+	found, err := db.Get(orderQuotesBucket, quoteID, &id)
+	if err != nil || !found {
+		return nil, err
+	}
+	return GetOrder(id)
+}
+
+// SetMovieTokenSession records the movie token transfer session requested
+// for an order, which its purchase must then be committed with.
+func SetMovieTokenSession(orderID, movieTokenSession string) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Update(func(tx *store.Tx) error {
+		order := &Order{}
+		found, err := tx.Get(ordersBucket, orderID, order)
+		if err != nil || !found {
+			return err
+		}
+		order.MovieTokenSession = movieTokenSession
+		order.UpdatedAt = time.Now()
+		return tx.Put(ordersBucket, order.ID, order)
+	})
+}
+
+// ListOrders returns the orders of a user, newest first, resuming after
+// cursor when it is set.
+func ListOrders(userID string, limit int, cursor string) (*OrderPage, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	if limit <= 0 {
+		limit = DefaultOrderPageSize
+	}
+	start := ""
+	if cursor != "" {
+		key, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		start = string(key)
+	}
+
+	result := &OrderPage{
+		Orders: make([]*Order, 0),
+	}
+	err := db.View(func(tx *store.Tx) error {
+		return tx.Scan(userOrdersPrefix+userID, start, true, func(key string, value []byte) (bool, error) {
+			if len(result.Orders) >= limit {
+				result.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(start))
+				return false, nil
+			}
+			start = key
+
+			id := ""
+			if err := json.Unmarshal(value, &id); err != nil {
+				return false, err
+			}
+			order := &Order{}
+			found, err := tx.Get(ordersBucket, id, order)
+			if err != nil || !found {
+				return err == nil, err
+			}
+			result.Orders = append(result.Orders, order)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// updateOrder copies the state of a purchase to the order paid with the
+// same session, if any.
+func updateOrder(p *Purchase) error {
+	db := GetStore()
+	if db == nil {
+		return nil
+	}
+	return db.Update(func(tx *store.Tx) error {
+		id := ""
+		found, err := tx.Get(orderSessionsBucket, p.PaymentSession, &id)
+		if err != nil || !found {
+			return err
+		}
+		order := &Order{}
+		found, err = tx.Get(ordersBucket, id, order)
+		if err != nil || !found {
+			return err
+		}
+
+		order.PurchaseID = p.ID
+		order.MovieTokenSession = p.MovieTokenSession
+		order.Steps = p.Steps
+		order.Error = p.Error
+		order.UpdatedAt = p.UpdatedAt
+		order.setStatus(purchaseOrderStatuses[p.Status], p.UpdatedAt)
+		return tx.Put(ordersBucket, order.ID, order)
+	})
+}
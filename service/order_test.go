@@ -0,0 +1,58 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrderFollowsPurchase(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	paymentSession, movieSession := preparePurchase(t, ctx, fake)
+	if err := fake.Authorize(paymentSession); err != nil {
+		t.Fatal(err)
+	}
+	quote := &Quote{ID: "quote", UserID: testUserID, PurchaseInfo: testPurchaseInfo}
+	order, err := CreateOrder(quote, paymentSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// orders are listed by creation time in milliseconds
+	time.Sleep(2 * time.Millisecond)
+	other, err := CreateOrder(quote, "other-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := CommitPurchase(ctx, testUserID, order.PurchaseInfo(), paymentSession, movieSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, err = GetOrderBySession(paymentSession)
+	if err != nil || order == nil {
+		t.Fatal("Expected the order", err)
+	}
+	if order.Status != OrderCompleted || order.PurchaseID != p.ID || order.MovieTokenSession != movieSession {
+		t.Error("Unexpected order", order.Status, order.PurchaseID, order.MovieTokenSession)
+	}
+	statuses := make([]string, 0)
+	for _, event := range order.Timeline {
+		statuses = append(statuses, event.Status)
+	}
+	if len(statuses) != 3 || statuses[0] != OrderCreated || statuses[1] != OrderCommitting || statuses[2] != OrderCompleted {
+		t.Error("Unexpected timeline", statuses)
+	}
+
+	page, err := ListOrders(testUserID, 1, "")
+	if err != nil || len(page.Orders) != 1 || page.Orders[0].ID != other.ID || page.NextCursor == "" {
+		t.Fatal("Unexpected first page", page, err)
+	}
+	page, err = ListOrders(testUserID, 1, page.NextCursor)
+	if err != nil || len(page.Orders) != 1 || page.Orders[0].ID != order.ID || page.NextCursor != "" {
+		t.Error("Unexpected second page", page, err)
+	}
+}
@@ -0,0 +1,537 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"link/cinema/api"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	PurchaseRunning      = "running"
+	PurchaseCompleted    = "completed"
+	PurchaseCompensating = "compensating"
+	PurchaseCompensated  = "compensated"
+	// PurchaseFailed purchases could neither be completed nor rolled back
+	// and need an operator.
+	PurchaseFailed = "failed"
+
+	StepPending      = "pending"
+	StepStarted      = "started"
+	StepDone         = "done"
+	StepFailed       = "failed"
+	StepSkipped      = "skipped"
+	StepCompensating = "compensating"
+	StepCompensated  = "compensated"
+
+	StepBurnFungible     = "burn-fungible"
+	StepRewardPoints     = "reward-points"
+	StepCommitMovieToken = "commit-movie-token"
+	StepCommitPayment    = "commit-payment"
+	StepMintTicket       = "mint-ticket"
+
+	purchasesBucket        = "purchases"
+	purchaseSessionsBucket = "purchase-sessions"
+)
+
+var (
+	ErrPurchaseInProgress = errors.New("purchase in progress")
+	ErrPurchaseFailed     = errors.New("purchase needs manual recovery")
+	ErrPurchaseNotFound   = errors.New("purchase not found")
+
+	purchaseWaitTimeout = DefaultWaitTimeout
+
+	purchaseMu      sync.Mutex
+	activePurchases = make(map[string]bool)
+)
+
+// Purchase is a ticket purchase run as a saga: its steps are applied in
+// order and, when one fails, the applied ones are compensated in reverse.
+// It is saved after every change so another process can resume it.
+type Purchase struct {
+	ID                string          `json:"id"`
+	UserID            string          `json:"userId"`
+	PurchaseInfo      PurchaseInfo    `json:"purchaseInfo"`
+	PaymentSession    string          `json:"paymentSession"`
+	MovieTokenSession string          `json:"movieTokenSession,omitempty"`
+	Status            string          `json:"status"`
+	Steps             []*PurchaseStep `json:"steps"`
+	Error             string          `json:"error,omitempty"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
+}
+
+// PurchaseStep is a step of a purchase. Ticket is the index in the cart of
+// the ticket a mint step mints.
+type PurchaseStep struct {
+	Name               string `json:"name"`
+	Ticket             int    `json:"ticket,omitempty"`
+	Status             string `json:"status"`
+	TxHash             string `json:"txHash,omitempty"`
+	CompensationTxHash string `json:"compensationTxHash,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+type purchaseAction struct {
+	run        func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error)
+	compensate func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error)
+}
+
+var purchaseActions = map[string]purchaseAction{
+	StepBurnFungible: {
+		run: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			cfg := api.FromContext(ctx).Config()
+			return BurnFungible(ctx, p.UserID, cfg.ItemContractID, cfg.FungibleTokenType, strconv.Itoa(p.PurchaseInfo.PriceInfo.UsedFungible))
+		},
+		compensate: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			cfg := api.FromContext(ctx).Config()
+			return MintFungible(ctx, p.UserID, cfg.ItemContractID, cfg.FungibleTokenType, strconv.Itoa(p.PurchaseInfo.PriceInfo.UsedFungible))
+		},
+	},
+	StepRewardPoints: {
+		run: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			cfg := api.FromContext(ctx).Config()
+			return TransferServiceToken(ctx, p.UserID, cfg.ServiceContractID, p.rewardAmount())
+		},
+		compensate: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			cfg := api.FromContext(ctx).Config()
+			return BurnServiceTokenFrom(ctx, p.UserID, cfg.ServiceContractID, p.rewardAmount())
+		},
+	},
+	StepCommitMovieToken: {
+		run: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			return CommitTransferRequest(ctx, p.MovieTokenSession)
+		},
+		compensate: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			cfg := api.FromContext(ctx).Config()
+			return TransferServiceToken(ctx, p.UserID, cfg.ServiceContractID, microUnits(p.PurchaseInfo.PriceInfo.UsedServiceToken))
+		},
+	},
+	StepCommitPayment: {
+		run: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			return CommitTransferRequest(ctx, p.PaymentSession)
+		},
+		compensate: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			return TransferBaseCoin(ctx, p.UserID, microUnits(p.PurchaseInfo.PriceInfo.GrandTotal))
+		},
+	},
+	StepMintTicket: {
+		run: func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error) {
+			cfg := api.FromContext(ctx).Config()
+			ticket := p.PurchaseInfo.Cart()[step.Ticket]
+			meta := NonFungibleMetadata{
+				MovieInfo:  p.PurchaseInfo.MovieInfo,
+				TicketInfo: p.PurchaseInfo.ticketInfo(ticket),
+				PaymentInfo: PaymentInfo{
+					PaymentDate:        time.Now(),
+					PaymentTransaction: p.step(StepCommitPayment).TxHash,
+					PointTransaction:   p.step(StepRewardPoints).TxHash,
+				},
+			}
+			return MintNonFungible(ctx, ticket.recipient(p.UserID), cfg.ItemContractID, cfg.NonFungibleTokenType, meta)
+		},
+	},
+}
+
+// microUnits converts an amount shown to users to token units.
+func microUnits(amount int) string {
+	return new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(1000000)).String()
+}
+
+// rewardAmount is the service token reward of the purchase, 10% of the
+// grand total in points.
+func (p *Purchase) rewardAmount() string {
+	amount := new(big.Int).Mul(big.NewInt(int64(p.PurchaseInfo.PriceInfo.GrandTotal)), big.NewInt(1000000))
+	amount.Div(amount, big.NewInt(10))
+	amount.Mul(amount, big.NewInt(1000))
+	return amount.String()
+}
+
+// NewPurchase plans the steps of a purchase paid with the base coin
+// transfer session paymentSession, minting a ticket for every seat of the
+// cart. movieTokenSession is the movie token
+// transfer session used for a discount, or "" when there is none.
+func NewPurchase(userID string, info PurchaseInfo, paymentSession, movieTokenSession string) *Purchase {
+	now := time.Now()
+	p := &Purchase{
+		ID:                newRecordID(),
+		UserID:            userID,
+		PurchaseInfo:      info,
+		PaymentSession:    paymentSession,
+		MovieTokenSession: movieTokenSession,
+		Status:            PurchaseRunning,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	// the user's transfers are committed first, so nothing is burnt,
+	// rewarded or minted for a purchase that is not paid
+	for _, name := range []string{StepCommitPayment, StepCommitMovieToken, StepBurnFungible, StepRewardPoints} {
+		p.Steps = append(p.Steps, &PurchaseStep{Name: name, Status: StepPending})
+	}
+	for i := range info.Cart() {
+		p.Steps = append(p.Steps, &PurchaseStep{Name: StepMintTicket, Ticket: i, Status: StepPending})
+	}
+	if info.PriceInfo.UsedFungible <= 0 {
+		p.step(StepBurnFungible).Status = StepSkipped
+	}
+	if movieTokenSession == "" {
+		p.step(StepCommitMovieToken).Status = StepSkipped
+	}
+	return p
+}
+
+func newRecordID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (p *Purchase) step(name string) *PurchaseStep {
+	for _, step := range p.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return &PurchaseStep{Name: name, Status: StepSkipped}
+}
+
+// minted reports whether a ticket of the purchase has been minted.
+func (p *Purchase) minted() bool {
+	for _, step := range p.Steps {
+		if step.Name == StepMintTicket && step.Status == StepDone {
+			return true
+		}
+	}
+	return false
+}
+
+// TxHashes returns the hashes of the coupon burn, the committed transfers
+// and the ticket mints of a completed purchase.
+func (p *Purchase) TxHashes() []string {
+	hashes := make([]string, 0)
+	for _, step := range p.Steps {
+		if step.Status == StepDone && step.Name != StepRewardPoints {
+			hashes = append(hashes, step.TxHash)
+		}
+	}
+	return hashes
+}
+
+// CommitPurchase runs the purchase paid with paymentSession. A purchase
+// already started with the same session is resumed instead of started
+// again, and a finished one is returned as it is. A purchase of another user
+// is not found. The seat of the ticket is
+// sold to a new purchase before any step runs, failing with ErrSeatTaken when
+// another purchase holds it, and freed when the purchase is rolled back.
+func CommitPurchase(ctx context.Context, userID string, info PurchaseInfo, paymentSession, movieTokenSession string) (*Purchase, error) {
+	if !checkUrlParam(paymentSession) || (movieTokenSession != "" && !checkUrlParam(movieTokenSession)) {
+		return nil, ErrInvalidParam
+	}
+
+	p, err := purchaseBySession(paymentSession)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil && p.UserID != userID {
+		return nil, ErrPurchaseNotFound
+	}
+	if p == nil {
+		if err := sellSeats(info, userID, paymentSession); err != nil {
+			return nil, err
+		}
+		p = NewPurchase(userID, info, paymentSession, movieTokenSession)
+		if err := p.save(); err != nil {
+			return nil, err
+		}
+		if db := GetStore(); db != nil {
+			if err := db.Put(purchaseSessionsBucket, paymentSession, p.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, p.execute(ctx)
+}
+
+// GetPurchase returns a saved purchase, or nil when there is none.
+func GetPurchase(id string) (*Purchase, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, nil
+	}
+	p := &Purchase{}
+	found, err := db.Get(purchasesBucket, id, p)
+	if err != nil || !found {
+		return nil, err
+	}
+	return p, nil
+}
+
+func purchaseBySession(paymentSession string) (*Purchase, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, nil
+	}
+	id := ""
+	found, err := db.Get(purchaseSessionsBucket, paymentSession, &id)
+	if err != nil || !found {
+		return nil, err
+	}
+	return GetPurchase(id)
+}
+
+// ResumePurchases finishes purchases left in flight by a previous process.
+// Purchases whose payment was committed are completed, the others are
+// rolled back.
+func ResumePurchases(ctx context.Context) error {
+	db := GetStore()
+	if db == nil {
+		return nil
+	}
+	ids := make([]string, 0)
+	err := db.ForEach(purchasesBucket, func(key string, value []byte) error {
+		ids = append(ids, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, id := range ids {
+		p, err := GetPurchase(id)
+		if err != nil {
+			return err
+		}
+		if p.Status != PurchaseRunning && p.Status != PurchaseCompensating {
+			continue
+		}
+		if p.Status == PurchaseRunning && p.step(StepCommitPayment).Status != StepDone {
+			p.Status = PurchaseCompensating
+			p.Error = "interrupted before the payment was committed"
+		}
+		// a rolled back purchase is resolved as well
+		if err := p.execute(ctx); err != nil && p.Status != PurchaseCompensated && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *Purchase) execute(ctx context.Context) error {
+	if !acquirePurchase(p.ID) {
+		return fmt.Errorf("%w: %s", ErrPurchaseInProgress, p.ID)
+	}
+	defer releasePurchase(p.ID)
+
+	switch p.Status {
+	case PurchaseRunning:
+		return p.forward(ctx)
+	case PurchaseCompensating:
+		return p.rollback(ctx, nil)
+	case PurchaseCompensated:
+		return fmt.Errorf("purchase %s was rolled back: %s", p.ID, p.Error)
+	case PurchaseFailed:
+		return fmt.Errorf("%w: %s: %s", ErrPurchaseFailed, p.ID, p.Error)
+	}
+	return nil
+}
+
+func acquirePurchase(id string) bool {
+	purchaseMu.Lock()
+	defer purchaseMu.Unlock()
+	if activePurchases[id] {
+		return false
+	}
+	activePurchases[id] = true
+	return true
+}
+
+func releasePurchase(id string) {
+	purchaseMu.Lock()
+	defer purchaseMu.Unlock()
+	delete(activePurchases, id)
+}
+
+func (p *Purchase) forward(ctx context.Context) error {
+	for _, step := range p.Steps {
+		if step.Status == StepDone || step.Status == StepSkipped {
+			continue
+		}
+		settled, err := p.apply(ctx, step, StepStarted, purchaseActions[step.Name].run, &step.TxHash)
+		if !settled {
+			return err
+		}
+		if err != nil && step.Name == StepMintTicket && p.minted() {
+			// minted tickets cannot be taken back from their owners
+			step.Status = StepFailed
+			step.Error = err.Error()
+			return p.fail(fmt.Sprintf("minting ticket %d failed after others were minted: %v", step.Ticket+1, err))
+		}
+		if err != nil {
+			step.Status = StepFailed
+			step.Error = err.Error()
+			p.Status = PurchaseCompensating
+			p.Error = fmt.Sprintf("%s failed: %v", step.Name, err)
+			if saveErr := p.save(); saveErr != nil {
+				return saveErr
+			}
+			return p.rollback(ctx, err)
+		}
+		step.Status = StepDone
+		if err := p.save(); err != nil {
+			return err
+		}
+	}
+	p.Status = PurchaseCompleted
+	return p.save()
+}
+
+// rollback compensates the applied steps in reverse and returns cause
+// once they are all compensated.
+func (p *Purchase) rollback(ctx context.Context, cause error) error {
+	for i := len(p.Steps) - 1; i >= 0; i-- {
+		step := p.Steps[i]
+		if step.Status == StepStarted && step.TxHash == "" {
+			// a previous process stopped between sending the transaction and
+			// saving its hash, so it may be applied with nothing to refund it
+			return p.fail(fmt.Sprintf("outcome of %s is unknown", step.Name))
+		}
+		if step.Status == StepStarted {
+			// the step was sent before the purchase was interrupted
+			settled, err := p.apply(ctx, step, StepStarted, purchaseActions[step.Name].run, &step.TxHash)
+			if !settled {
+				return err
+			}
+			step.Status = StepDone
+			if err != nil {
+				step.Status = StepFailed
+				step.Error = err.Error()
+			}
+		}
+		compensate := purchaseActions[step.Name].compensate
+		if (step.Status != StepDone && step.Status != StepCompensating) || compensate == nil {
+			continue
+		}
+		settled, err := p.apply(ctx, step, StepCompensating, compensate, &step.CompensationTxHash)
+		if !settled {
+			return err
+		}
+		if err != nil {
+			step.Error = err.Error()
+			return p.fail(fmt.Sprintf("compensating %s failed: %v", step.Name, err))
+		}
+		step.Status = StepCompensated
+		if err := p.save(); err != nil {
+			return err
+		}
+	}
+
+	p.Status = PurchaseCompensated
+	if err := p.save(); err != nil {
+		return err
+	}
+	if cause == nil {
+		return fmt.Errorf("purchase %s was rolled back: %s", p.ID, p.Error)
+	}
+	return fmt.Errorf("purchase %s was rolled back: %w", p.ID, cause)
+}
+
+// apply sends the transaction of an action unless txHash already holds
+// one, marking step with status meanwhile, and waits for it. It returns settled when the transaction is known
+// to be applied, with a nil error, or known not to be, with the reason.
+// Otherwise the purchase is left to be resumed or for an operator.
+func (p *Purchase) apply(ctx context.Context, step *PurchaseStep, status string, action func(ctx context.Context, p *Purchase, step *PurchaseStep) (*TransactionAccepted, error), txHash *string) (bool, error) {
+	if *txHash == "" {
+		if step.Status == status {
+			// a previous process stopped between sending the transaction
+			// and saving its hash
+			return false, p.fail(fmt.Sprintf("outcome of %s is unknown", step.Name))
+		}
+		step.Status = status
+		if err := p.save(); err != nil {
+			return false, err
+		}
+
+		accepted, err := action(ctx, p, step)
+		if err != nil {
+			if outcomeUnknown(err) {
+				return false, p.fail(fmt.Sprintf("outcome of %s is unknown: %v", step.Name, err))
+			}
+			return true, err
+		}
+		*txHash = accepted.TxHash
+		if err := p.save(); err != nil {
+			return false, err
+		}
+	}
+
+	_, err := WaitForTx(ctx, *txHash, purchaseWaitTimeout)
+	var txErr *TxFailedError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &txErr):
+		return true, err
+	}
+	return false, fmt.Errorf("%w: %s: %v", ErrPurchaseInProgress, p.ID, err)
+}
+
+// outcomeUnknown reports whether a failed call may have been applied by
+// LBD anyway.
+func outcomeUnknown(err error) bool {
+	if apiErr, ok := api.AsError(err); ok {
+		return apiErr.Retryable
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (p *Purchase) fail(reason string) error {
+	p.Status = PurchaseFailed
+	p.Error = reason
+	if err := p.save(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %s", ErrPurchaseFailed, p.ID, reason)
+}
+
+func (p *Purchase) save() error {
+	p.UpdatedAt = time.Now()
+	db := GetStore()
+	if db == nil {
+		return nil
+	}
+	if err := db.Put(purchasesBucket, p.ID, p); err != nil {
+		return err
+	}
+	if p.Status == PurchaseCompensated {
+		if err := releaseSeats(p.PurchaseInfo, p.PaymentSession); err != nil {
+			return err
+		}
+	}
+	return updateOrder(p)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"link/cinema/lbdfake"
+	"testing"
+	"time"
+)
+
+var (
+	testPurchaseInfo = PurchaseInfo{
+		MovieInfo:  DefaultMovie,
+		TicketInfo: DefaultTicket,
+		PriceInfo: PriceInfo{
+			UsedFungible:     1,
+			UsedServiceToken: 100,
+			SubTotal:         15,
+			Discount:         3,
+			GrandTotal:       12,
+		},
+	}
+)
+
+// preparePurchase funds the test user and returns authorized payment and
+// movie token sessions for testPurchaseInfo.
+func preparePurchase(t *testing.T, ctx context.Context, fake *lbdfake.Server) (string, string) {
+	if _, err := TransferBaseCoin(ctx, testUserID, "100000000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TransferServiceToken(ctx, testUserID, testConfig.ServiceContractID, "1000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MintFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType, "5"); err != nil {
+		t.Fatal(err)
+	}
+	for _, contractID := range []string{testConfig.ItemContractID, testConfig.ServiceContractID} {
+		if err := fake.ApproveProxy(testUserID, contractID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	movieReq, err := RequestServiceTransfer(ctx, testUserID, testConfig.ServiceContractID, microUnits(testPurchaseInfo.PriceInfo.UsedServiceToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Authorize(movieReq.RequestSessionToken); err != nil {
+		t.Fatal(err)
+	}
+	paymentReq, err := RequestBaseCoinTransfer(ctx, testUserID, microUnits(testPurchaseInfo.PriceInfo.GrandTotal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paymentReq.RequestSessionToken, movieReq.RequestSessionToken
+}
+
+func balances(t *testing.T, ctx context.Context) (string, string, string) {
+	baseCoin, err := GetBaseCoinBalance(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceToken, err := GetServiceTokenBalance(ctx, testUserID, testConfig.ServiceContractID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fungible, err := GetFungibleBalance(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return baseCoin.Amount, serviceToken.Amount, fungible.Amount
+}
+
+func TestCommitPurchase(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	paymentSession, movieSession := preparePurchase(t, ctx, fake)
+	if err := fake.Authorize(paymentSession); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := CommitPurchase(ctx, testUserID, testPurchaseInfo, paymentSession, movieSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != PurchaseCompleted || len(p.TxHashes()) != 4 {
+		t.Error("Unexpected purchase", p.Status, p.TxHashes())
+	}
+
+	again, err := CommitPurchase(ctx, testUserID, testPurchaseInfo, paymentSession, movieSession)
+	if err != nil || again.ID != p.ID {
+		t.Error("Expected the same purchase", again, err)
+	}
+	if other, err := CommitPurchase(ctx, "other-user", testPurchaseInfo, paymentSession, movieSession); !errors.Is(err, ErrPurchaseNotFound) || other != nil {
+		t.Error("Expected the purchase of another user not to be found", other, err)
+	}
+	tickets, err := GetNonFungibleInfo(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType)
+	if err != nil || len(tickets) != 1 {
+		t.Error("Expected one ticket", tickets, err)
+	}
+}
+
+func TestCommitPurchaseUnpaid(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	// the payment session is never authorized, so committing it fails
+	paymentSession, movieSession := preparePurchase(t, ctx, fake)
+	baseCoin, serviceToken, fungible := balances(t, ctx)
+
+	p, err := CommitPurchase(ctx, testUserID, testPurchaseInfo, paymentSession, movieSession)
+	if err == nil {
+		t.Fatal("Expected the purchase to fail")
+	}
+	if p.Status != PurchaseCompensated {
+		t.Fatal("Unexpected purchase status", p.Status, p.Error)
+	}
+	if step := p.step(StepCommitPayment); step.Status != StepFailed {
+		t.Error("Expected the payment to fail", step)
+	}
+	for _, name := range []string{StepCommitMovieToken, StepBurnFungible, StepRewardPoints} {
+		if step := p.step(name); step.Status != StepPending || step.TxHash != "" {
+			t.Error("Expected the step not to run before the payment", step)
+		}
+	}
+
+	afterBaseCoin, afterServiceToken, afterFungible := balances(t, ctx)
+	if afterBaseCoin != baseCoin || afterServiceToken != serviceToken || afterFungible != fungible {
+		t.Error("Unexpected balances", afterBaseCoin, afterServiceToken, afterFungible)
+	}
+}
+
+func TestCommitPurchaseCompensates(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	paymentSession, movieSession := preparePurchase(t, ctx, fake)
+	if err := fake.Authorize(paymentSession); err != nil {
+		t.Fatal(err)
+	}
+	baseCoin, serviceToken, fungible := balances(t, ctx)
+
+	// the ticket is for a user LBD does not know, so minting it fails
+	// after the points are rewarded
+	info := testPurchaseInfo
+	info.Tickets = []CartTicket{{Sit: DefaultTicket.Sit, RecipientID: "unknown-user"}}
+	p, err := CommitPurchase(ctx, testUserID, info, paymentSession, movieSession)
+	if err == nil {
+		t.Fatal("Expected the purchase to fail")
+	}
+	if p.Status != PurchaseCompensated {
+		t.Fatal("Unexpected purchase status", p.Status, p.Error)
+	}
+	for _, name := range []string{StepCommitPayment, StepCommitMovieToken, StepBurnFungible, StepRewardPoints} {
+		if step := p.step(name); step.Status != StepCompensated || step.CompensationTxHash == "" {
+			t.Error("Expected the step to be compensated", step)
+		}
+	}
+	if step := p.step(StepMintTicket); step.Status != StepFailed {
+		t.Error("Expected the mint to fail", step)
+	}
+
+	afterBaseCoin, afterServiceToken, afterFungible := balances(t, ctx)
+	if afterBaseCoin != baseCoin || afterServiceToken != serviceToken || afterFungible != fungible {
+		t.Error("Unexpected balances", afterBaseCoin, afterServiceToken, afterFungible)
+	}
+
+	stored, err := GetPurchase(p.ID)
+	if err != nil || stored == nil || stored.Status != PurchaseCompensated {
+		t.Error("Expected the purchase to be saved", stored, err)
+	}
+}
+
+func TestResumePurchase(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBDWith(t, func(cfg *lbdfake.Config) {
+		cfg.InclusionDelay = 200 * time.Millisecond
+	})
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	paymentSession, movieSession := preparePurchase(t, ctx, fake)
+	if err := fake.Authorize(paymentSession); err != nil {
+		t.Fatal(err)
+	}
+	baseCoin, _, fungible := balances(t, ctx)
+
+	purchaseWaitTimeout = 10 * time.Millisecond
+	p, err := CommitPurchase(ctx, testUserID, testPurchaseInfo, paymentSession, movieSession)
+	purchaseWaitTimeout = DefaultWaitTimeout
+	if !errors.Is(err, ErrPurchaseInProgress) {
+		t.Fatal("Expected the purchase to be in progress", err)
+	}
+	if step := p.step(StepCommitPayment); step.Status != StepStarted || step.TxHash == "" {
+		t.Fatal("Expected the payment to be sent", step)
+	}
+
+	if err := ResumePurchases(ctx); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := GetPurchase(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Status != PurchaseCompensated || resumed.step(StepCommitPayment).Status != StepCompensated {
+		t.Error("Expected the purchase to be rolled back", resumed.Status, resumed.Error)
+	}
+	if step := resumed.step(StepBurnFungible); step.Status != StepPending {
+		t.Error("Expected the burn not to run", step)
+	}
+	if afterBaseCoin, _, afterFungible := balances(t, ctx); afterBaseCoin != baseCoin || afterFungible != fungible {
+		t.Error("Unexpected balances", afterBaseCoin, afterFungible)
+	}
+}
+
+func TestRollbackUnknownOutcome(t *testing.T) {
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	p := NewPurchase(testUserID, testPurchaseInfo, "payment-session", "movie-session")
+	p.Status = PurchaseCompensating
+	p.Steps[0].Status = StepStarted
+	if err := p.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.execute(context.Background()); !errors.Is(err, ErrPurchaseFailed) {
+		t.Error("Expected the purchase to need recovery", err)
+	}
+	if p.Status != PurchaseFailed || p.Steps[0].Status != StepStarted {
+		t.Error("Expected the step sent with no hash to be left for an operator", p.Status, p.Steps[0])
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"link/cinema/api"
+	"link/cinema/pricing"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultQuoteTTL = 10 * time.Minute
+)
+
+var (
+	ErrInvalidQuote = errors.New("invalid quote")
+	ErrQuoteExpired = errors.New("quote expired")
+)
+
+// Quote is a price computed by the server for a user. Its ID carries the
+// quote signed with the quote secret, so the price can be checked when the
+// client sends the ID back.
+type Quote struct {
+	ID         string `json:"quoteId"`
+	UserID     string `json:"userId"`
+	ShowtimeID string `json:"showtimeId"`
+	PurchaseInfo
+	Balances    pricing.Balances     `json:"balances"`
+	Adjustments []pricing.Adjustment `json:"adjustments"`
+	IssuedAt    time.Time            `json:"issuedAt"`
+	ExpiresAt   time.Time            `json:"expiresAt"`
+}
+
+// quoteKey returns the key quotes are signed with, derived from the API
+// secret unless a quote secret is configured.
+func quoteKey(ctx context.Context) []byte {
+	cfg := api.FromContext(ctx).Config()
+	if cfg.QuoteSecret != "" {
+		return []byte(cfg.QuoteSecret.Reveal())
+	}
+	key := sha256.Sum256([]byte("quote:" + cfg.APISecret.Reveal()))
+	return key[:]
+}
+
+func quoteTTL(ctx context.Context) time.Duration {
+	if seconds := api.FromContext(ctx).Config().QuoteTTLSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return DefaultQuoteTTL
+}
+
+func pricingEngine(ctx context.Context) (*pricing.Engine, error) {
+	return pricing.New(api.FromContext(ctx).Config().Pricing)
+}
+
+// findShowtime returns the showtime with id, or the earliest one when id is
+// empty.
+func findShowtime(id string) (*Showtime, error) {
+	if id != "" {
+		showtime, err := GetShowtime(id)
+		if err == nil && showtime == nil {
+			err = fmt.Errorf("%w: showtime %s", ErrNotInCatalog, id)
+		}
+		return showtime, err
+	}
+	showtimes, err := ListShowtimes("")
+	if err != nil {
+		return nil, err
+	}
+	if len(showtimes) == 0 {
+		return nil, fmt.Errorf("%w: no showtimes", ErrNotInCatalog)
+	}
+	return showtimes[0], nil
+}
+
+// IssueQuote prices the tickets of a cart for a catalog showtime for a user
+// by the pricing rules, redeeming the tokens the user holds, and signs it.
+// The earliest showtime is picked when showtimeID is empty, the first
+// available seats for tickets without a seat, and one ticket for an empty
+// cart. Quoting a seat does not hold it.
+func IssueQuote(ctx context.Context, userID, showtimeID string, tickets []CartTicket) (*Quote, error) {
+	cfg := api.FromContext(ctx).Config()
+	engine, err := pricingEngine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	showtime, err := findShowtime(showtimeID)
+	if err != nil {
+		return nil, err
+	}
+	tickets, err = fillCart(showtime.ID, tickets)
+	if err != nil {
+		return nil, err
+	}
+	for _, ticket := range tickets {
+		if ticket.RecipientID == "" || ticket.RecipientID == userID {
+			continue
+		}
+		if _, err := GetUserInfo(ctx, ticket.RecipientID); err != nil {
+			return nil, err
+		}
+	}
+	purchaseInfo, err := showtime.PurchaseInfo(tickets[0].Sit)
+	if err != nil {
+		return nil, err
+	}
+	if len(tickets) > 1 {
+		purchaseInfo.Tickets = tickets
+	}
+
+	fungibleBalance, err := GetFungibleBalance(ctx, userID, cfg.ItemContractID, cfg.FungibleTokenType)
+	if err != nil {
+		return nil, err
+	}
+	fungibleAmt, err := strconv.Atoi(fungibleBalance.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceTokenBalance, err := GetServiceTokenBalance(ctx, userID, cfg.ServiceContractID)
+	if err != nil {
+		return nil, err
+	}
+	serviceAmt, ok := new(big.Int).SetString(serviceTokenBalance.Amount, 10)
+	if !ok {
+		return nil, errors.New("invalid movie token amount")
+	}
+	for i := 0; i < serviceTokenBalance.Decimals; i++ {
+		serviceAmt.Div(serviceAmt, big.NewInt(10))
+	}
+	// no rule redeems more tokens than fit in an int
+	if !serviceAmt.IsInt64() || serviceAmt.Int64() > math.MaxInt32 {
+		serviceAmt.SetInt64(math.MaxInt32)
+	}
+
+	now := time.Now()
+	quote := &Quote{
+		UserID:       userID,
+		ShowtimeID:   showtime.ID,
+		PurchaseInfo: purchaseInfo,
+		Balances: pricing.Balances{
+			pricing.TokenMovieDiscount: fungibleAmt,
+			pricing.TokenMovie:         int(serviceAmt.Int64()),
+		},
+		IssuedAt:  now,
+		ExpiresAt: now.Add(quoteTTL(ctx)),
+	}
+	quote.price(engine, showtime)
+
+	if err := quote.sign(ctx); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// price sets the price of q for showtime by engine, from its balances at the
+// time it was issued.
+func (q *Quote) price(engine *pricing.Engine, showtime *Showtime) {
+	req := pricing.Request{
+		ShowtimeID: showtime.ID,
+		Showtime:   showtime.StartsAt,
+		Theater:    q.TicketInfo.Theater,
+		ListPrice:  showtime.Price,
+		Quantity:   len(q.Cart()),
+		At:         q.IssuedAt,
+		Balances:   q.Balances,
+	}
+	price := engine.Price(req)
+	q.TicketInfo.Price = engine.BasePrice(req)
+	q.PriceInfo = PriceInfo{
+		UsedFungible:     price.Used[pricing.TokenMovieDiscount],
+		UsedServiceToken: price.Used[pricing.TokenMovie],
+		SubTotal:         price.SubTotal,
+		Discount:         price.Discount,
+		GrandTotal:       price.GrandTotal,
+	}
+	q.Adjustments = price.Adjustments
+}
+
+// sign sets the ID of q to its encoding followed by its signature.
+func (q *Quote) sign(ctx context.Context) error {
+	q.ID = ""
+	payload, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	q.ID = encoded + "." + signQuote(ctx, encoded)
+	return nil
+}
+
+func signQuote(ctx context.Context, encoded string) string {
+	mac := hmac.New(sha256.New, quoteKey(ctx))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseQuote checks the signature of a quote ID issued to userID and
+// returns the quote, even when it has expired.
+func ParseQuote(ctx context.Context, id, userID string) (*Quote, error) {
+	parts := strings.Split(id, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signQuote(ctx, parts[0]))) {
+		return nil, ErrInvalidQuote
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidQuote
+	}
+	quote := &Quote{}
+	if err := json.Unmarshal(payload, quote); err != nil || quote.UserID != userID {
+		return nil, ErrInvalidQuote
+	}
+	quote.ID = id
+	return quote, nil
+}
+
+// VerifyQuote is ParseQuote refusing expired quotes and quotes the pricing
+// rules and the catalog now price differently.
+func VerifyQuote(ctx context.Context, id, userID string) (*Quote, error) {
+	quote, err := ParseQuote(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(quote.ExpiresAt) {
+		return nil, ErrQuoteExpired
+	}
+
+	engine, err := pricingEngine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	showtime, err := GetShowtime(quote.ShowtimeID)
+	if err != nil {
+		return nil, err
+	}
+	if showtime == nil {
+		return nil, fmt.Errorf("%w: showtime no longer in the catalog", ErrInvalidQuote)
+	}
+	repriced := *quote
+	repriced.price(engine, showtime)
+	if repriced.PriceInfo != quote.PriceInfo || repriced.TicketInfo != quote.TicketInfo {
+		return nil, fmt.Errorf("%w: priced by rules no longer in effect", ErrInvalidQuote)
+	}
+	return quote, nil
+}
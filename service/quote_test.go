@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"link/cinema/api"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuote(t *testing.T) {
+	ctx, _, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+	if err := SeedCatalog(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := TransferServiceToken(ctx, testUserID, testConfig.ServiceContractID, "1000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MintFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.FungibleTokenType, "5"); err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := IssueQuote(ctx, testUserID, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	price := quote.PriceInfo
+	if price.UsedFungible != 1 || price.UsedServiceToken != 1000 {
+		t.Error("Unexpected tokens used", price.UsedFungible, price.UsedServiceToken)
+	}
+	if price.Discount != -6 || price.GrandTotal != DefaultTicket.Price-6 || len(quote.Adjustments) != 2 {
+		t.Error("Unexpected price", price.Discount, price.GrandTotal, quote.Adjustments)
+	}
+
+	verified, err := VerifyQuote(ctx, quote.ID, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.PriceInfo != price || verified.UserID != testUserID {
+		t.Error("Unexpected quote", verified)
+	}
+
+	if _, err := VerifyQuote(ctx, quote.ID, "other-user"); !errors.Is(err, ErrInvalidQuote) {
+		t.Error("Expected a quote of another user to be refused", err)
+	}
+	parts := strings.Split(quote.ID, ".")
+	tampered := parts[0] + "x." + parts[1]
+	if _, err := VerifyQuote(ctx, tampered, testUserID); !errors.Is(err, ErrInvalidQuote) {
+		t.Error("Expected a tampered quote to be refused", err)
+	}
+
+	cfg := api.FromContext(ctx).Config()
+	cfg.Pricing.BasePrice = 30
+	if _, err := VerifyQuote(ctx, quote.ID, testUserID); !errors.Is(err, ErrInvalidQuote) {
+		t.Error("Expected a quote priced by other rules to be refused", err)
+	}
+	cfg.Pricing.BasePrice = 0
+
+	quote.ExpiresAt = time.Now().Add(-time.Second)
+	if err := quote.sign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyQuote(ctx, quote.ID, testUserID); !errors.Is(err, ErrQuoteExpired) {
+		t.Error("Expected an expired quote to be refused", err)
+	}
+	if _, err := ParseQuote(ctx, quote.ID, testUserID); err != nil {
+		t.Error("Expected an expired quote to parse", err)
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"link/cinema/api"
+	"link/cinema/store"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultSeatHoldTTL = 10 * time.Minute
+
+	SeatAvailable = "available"
+	SeatHeld      = "held"
+	SeatSold      = "sold"
+
+	seatsPrefix = "seats:"
+)
+
+var (
+	ErrSeatTaken   = errors.New("seat is taken")
+	ErrUnknownSeat = errors.New("no such seat")
+)
+
+// SeatRow is a row of numbered seats named by the row and the number, like
+// M14.
+type SeatRow struct {
+	Name  string `json:"name"`
+	Seats int    `json:"seats"`
+}
+
+// SeatHold is a seat of a showtime held for, or sold to, the purchase with
+// the base coin transfer session Session.
+type SeatHold struct {
+	Seat      string    `json:"seat"`
+	UserID    string    `json:"userId"`
+	Session   string    `json:"session"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type SeatStatus struct {
+	Seat   string `json:"seat"`
+	Status string `json:"status"`
+}
+
+// Seats returns the seats of a screen, row by row.
+func (s Screen) Seats() []string {
+	seats := make([]string, 0)
+	for _, row := range s.Rows {
+		for i := 1; i <= row.Seats; i++ {
+			seats = append(seats, row.Name+strconv.Itoa(i))
+		}
+	}
+	return seats
+}
+
+func (s Screen) hasSeat(seat string) bool {
+	for _, row := range s.Rows {
+		if len(seat) <= len(row.Name) || seat[:len(row.Name)] != row.Name {
+			continue
+		}
+		n, err := strconv.Atoi(seat[len(row.Name):])
+		if err == nil && n >= 1 && n <= row.Seats && strconv.Itoa(n) == seat[len(row.Name):] {
+			return true
+		}
+	}
+	return false
+}
+
+// active reports whether h keeps the seat from others at now.
+func (h *SeatHold) active(now time.Time) bool {
+	return h.Status == SeatSold || now.Before(h.ExpiresAt)
+}
+
+func seatHoldTTL(ctx context.Context) time.Duration {
+	if seconds := api.FromContext(ctx).Config().SeatHoldSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return DefaultSeatHoldTTL
+}
+
+func showtimeScreen(showtimeID string) (Screen, error) {
+	showtime, err := GetShowtime(showtimeID)
+	if err != nil {
+		return Screen{}, err
+	}
+	if showtime == nil {
+		return Screen{}, fmt.Errorf("%w: showtime %s", ErrNotInCatalog, showtimeID)
+	}
+	theater, err := GetTheater(showtime.TheaterID)
+	if err != nil {
+		return Screen{}, err
+	}
+	if theater == nil {
+		return Screen{}, fmt.Errorf("%w: theater of showtime %s", ErrNotInCatalog, showtimeID)
+	}
+	screen, ok := theater.screen(showtime.ScreenID)
+	if !ok {
+		return Screen{}, fmt.Errorf("%w: screen of showtime %s", ErrNotInCatalog, showtimeID)
+	}
+	return screen, nil
+}
+
+// SeatMap returns the seats of a showtime with whether they are available,
+// held or sold.
+func SeatMap(showtimeID string) ([]SeatStatus, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	screen, err := showtimeScreen(showtimeID)
+	if err != nil {
+		return nil, err
+	}
+
+	holds := make(map[string]*SeatHold)
+	now := time.Now()
+	err = db.ForEach(seatsPrefix+showtimeID, func(key string, value []byte) error {
+		hold := &SeatHold{}
+		if err := json.Unmarshal(value, hold); err != nil {
+			return err
+		}
+		if hold.active(now) {
+			holds[key] = hold
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seats := make([]SeatStatus, 0)
+	for _, seat := range screen.Seats() {
+		status := SeatAvailable
+		if hold, ok := holds[seat]; ok {
+			status = hold.Status
+		}
+		seats = append(seats, SeatStatus{Seat: seat, Status: status})
+	}
+	return seats, nil
+}
+
+// checkSeat fails unless seat is a seat of the showtime that nobody holds.
+func checkSeat(showtimeID, seat string) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	screen, err := showtimeScreen(showtimeID)
+	if err != nil {
+		return err
+	}
+	if !screen.hasSeat(seat) {
+		return fmt.Errorf("%w: %s", ErrUnknownSeat, seat)
+	}
+	hold := &SeatHold{}
+	found, err := db.Get(seatsPrefix+showtimeID, seat, hold)
+	if err != nil {
+		return err
+	}
+	if found && hold.active(time.Now()) {
+		return fmt.Errorf("%w: %s", ErrSeatTaken, seat)
+	}
+	return nil
+}
+
+// HoldSeats holds the seats of the tickets of info for the purchase with the
+// base coin transfer session paymentSession until the holds expire or the
+// purchase is rolled back. Either every seat is held or none is.
+func HoldSeats(ctx context.Context, info PurchaseInfo, userID, paymentSession string) ([]*SeatHold, error) {
+	screen, err := showtimeScreen(info.TicketInfo.ShowtimeID)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(seatHoldTTL(ctx))
+	holds := make([]*SeatHold, 0)
+	for _, ticket := range info.Cart() {
+		if !screen.hasSeat(ticket.Sit) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSeat, ticket.Sit)
+		}
+		holds = append(holds, &SeatHold{
+			Seat:      ticket.Sit,
+			UserID:    userID,
+			Session:   paymentSession,
+			Status:    SeatHeld,
+			ExpiresAt: expiresAt,
+		})
+	}
+	if err := putSeatHolds(info.TicketInfo.ShowtimeID, holds); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// sellSeats marks the seats of the tickets of info sold to the purchase with
+// the base coin transfer session paymentSession, unless another purchase
+// holds or bought one of them. Tickets of no showtime have no seat to sell;
+// the others need the store.
+func sellSeats(info PurchaseInfo, userID, paymentSession string) error {
+	if info.TicketInfo.ShowtimeID == "" {
+		return nil
+	}
+	holds := make([]*SeatHold, 0)
+	for _, ticket := range info.Cart() {
+		holds = append(holds, &SeatHold{
+			Seat:    ticket.Sit,
+			UserID:  userID,
+			Session: paymentSession,
+			Status:  SeatSold,
+		})
+	}
+	return putSeatHolds(info.TicketInfo.ShowtimeID, holds)
+}
+
+// putSeatHolds puts holds in one transaction with the check that no other
+// purchase holds their seats, so a seat is never sold twice.
+func putSeatHolds(showtimeID string, holds []*SeatHold) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Update(func(tx *store.Tx) error {
+		for _, hold := range holds {
+			current := &SeatHold{}
+			found, err := tx.Get(seatsPrefix+showtimeID, hold.Seat, current)
+			if err != nil {
+				return err
+			}
+			if found && current.Session != hold.Session && current.active(time.Now()) {
+				return fmt.Errorf("%w: %s", ErrSeatTaken, hold.Seat)
+			}
+			if found && current.Session == hold.Session && current.Status == SeatSold {
+				continue
+			}
+			if err := tx.Put(seatsPrefix+showtimeID, hold.Seat, hold); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// releaseSeats frees the seats of the tickets of info held for, or sold to,
+// the purchase with the base coin transfer session paymentSession.
+func releaseSeats(info PurchaseInfo, paymentSession string) error {
+	db := GetStore()
+	if info.TicketInfo.ShowtimeID == "" || db == nil {
+		return nil
+	}
+	bucket := seatsPrefix + info.TicketInfo.ShowtimeID
+	return db.Update(func(tx *store.Tx) error {
+		for _, ticket := range info.Cart() {
+			current := &SeatHold{}
+			found, err := tx.Get(bucket, ticket.Sit, current)
+			if err != nil {
+				return err
+			}
+			if !found || current.Session != paymentSession {
+				continue
+			}
+			if err := tx.Delete(bucket, ticket.Sit); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
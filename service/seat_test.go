@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSeatHolds(t *testing.T) {
+	ctx, fake, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+	if err := SeedCatalog(); err != nil {
+		t.Fatal(err)
+	}
+
+	seats, err := SeatMap(DefaultShowtimeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seats) != 13*20 || seats[0].Seat != "A1" || seats[0].Status != SeatAvailable {
+		t.Fatal("Unexpected seat map", len(seats), seats[0])
+	}
+
+	info := testPurchaseInfo
+	info.TicketInfo.ShowtimeID = DefaultShowtimeID
+	info.TicketInfo.Sit = "M14"
+	if _, err := HoldSeats(ctx, info, "other-user", "other-session"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IssueQuote(ctx, testUserID, DefaultShowtimeID, []CartTicket{{Sit: "M14"}}); !errors.Is(err, ErrSeatTaken) {
+		t.Error("Expected a held seat not to be quoted", err)
+	}
+	if _, err := IssueQuote(ctx, testUserID, DefaultShowtimeID, []CartTicket{{Sit: "Z1"}}); !errors.Is(err, ErrUnknownSeat) {
+		t.Error("Expected an unknown seat not to be quoted", err)
+	}
+
+	paymentSession, movieSession := preparePurchase(t, ctx, fake)
+	if _, err := HoldSeats(ctx, info, testUserID, paymentSession); !errors.Is(err, ErrSeatTaken) {
+		t.Error("Expected a held seat not to be held again", err)
+	}
+	if _, err := CommitPurchase(ctx, testUserID, info, paymentSession, movieSession); !errors.Is(err, ErrSeatTaken) {
+		t.Error("Expected a held seat not to be sold", err)
+	}
+
+	// the hold of the other purchase expires
+	if err := putSeatHolds(DefaultShowtimeID, []*SeatHold{{Seat: "M14", Session: "other-session", Status: SeatHeld, ExpiresAt: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HoldSeats(ctx, info, testUserID, paymentSession); err != nil {
+		t.Fatal(err)
+	}
+
+	// the payment is never authorized, so the purchase is rolled back and
+	// the seat freed
+	p, err := CommitPurchase(ctx, testUserID, info, paymentSession, movieSession)
+	if err == nil || p.Status != PurchaseCompensated {
+		t.Fatal("Expected the purchase to be rolled back", err)
+	}
+	if err := checkSeat(DefaultShowtimeID, "M14"); err != nil {
+		t.Error("Expected the seat to be freed", err)
+	}
+
+	paymentSession, movieSession = preparePurchase(t, ctx, fake)
+	if err := fake.Authorize(paymentSession); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CommitPurchase(ctx, testUserID, info, paymentSession, movieSession); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HoldSeats(ctx, info, "other-user", "third-session"); !errors.Is(err, ErrSeatTaken) {
+		t.Error("Expected a sold seat not to be held", err)
+	}
+	seats, err = SeatMap(DefaultShowtimeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seat := range seats {
+		if (seat.Seat == "M14") != (seat.Status == SeatSold) || seat.Status == SeatHeld {
+			t.Error("Unexpected seat", seat)
+		}
+	}
+}
+
+func TestSeatsWithoutStore(t *testing.T) {
+	if _, err := SeatMap(DefaultShowtimeID); !errors.Is(err, ErrNoStore) {
+		t.Error("Expected the seat map to need the store", err)
+	}
+	if err := checkSeat(DefaultShowtimeID, "A1"); !errors.Is(err, ErrNoStore) {
+		t.Error("Expected checking a seat to need the store", err)
+	}
+	info := testPurchaseInfo
+	info.TicketInfo.ShowtimeID = DefaultShowtimeID
+	if err := sellSeats(info, testUserID, "payment-session"); !errors.Is(err, ErrNoStore) {
+		t.Error("Expected selling a seat to need the store", err)
+	}
+	if err := sellSeats(testPurchaseInfo, testUserID, "payment-session"); err != nil {
+		t.Error("Expected a ticket of no showtime to have no seat to sell", err)
+	}
+}
@@ -16,19 +16,19 @@ under the License
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"link/cinema/api"
-	"link/cinema/config"
+	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
 )
 
 
 var (
-	errInvalidParam = errors.New("invalid URL params")
+	ErrInvalidParam = errors.New("invalid URL params")
 )
 
 func checkUrlParam(params ...string) bool {
@@ -44,13 +44,13 @@ func checkUrlParam(params ...string) bool {
 	return true
 }
 
-func GetUserInfo(userID string) (*UserInfo, error) {
-	if checkUrlParam(userID) {
-		return nil, errInvalidParam
+func GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	if !checkUrlParam(userID) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s", userID)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -65,13 +65,13 @@ func GetUserInfo(userID string) (*UserInfo, error) {
 	return user, nil
 }
 
-func GetServiceTokenBalance(userID, contractID string) (*ServiceTokenBalance, error) {
-	if checkUrlParam(userID, contractID) {
-		return nil, errInvalidParam
+func GetServiceTokenBalance(ctx context.Context, userID, contractID string) (*ServiceTokenBalance, error) {
+	if !checkUrlParam(userID, contractID) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/service-tokens/%s", userID, contractID)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -86,13 +86,13 @@ func GetServiceTokenBalance(userID, contractID string) (*ServiceTokenBalance, er
 	return serviceTokenBalance, nil
 }
 
-func GetFungibleBalance(userID, contractID, tokenType string) (*FungibleBalance, error) {
-	if checkUrlParam(userID, contractID, tokenType) {
-		return nil, errInvalidParam
+func GetFungibleBalance(ctx context.Context, userID, contractID, tokenType string) (*FungibleBalance, error) {
+	if !checkUrlParam(userID, contractID, tokenType) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/item-tokens/%s/fungibles/%s", userID, contractID, tokenType)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -106,13 +106,13 @@ func GetFungibleBalance(userID, contractID, tokenType string) (*FungibleBalance,
 	return fungibleBalance, nil
 }
 
-func GetNonFungibleInfo(userID, contractID, tokenType string) ([]*NonFungibleInfo, error) {
-	if checkUrlParam(userID, contractID, tokenType) {
-		return nil, errInvalidParam
+func GetNonFungibleInfo(ctx context.Context, userID, contractID, tokenType string) ([]*NonFungibleInfo, error) {
+	if !checkUrlParam(userID, contractID, tokenType) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/item-tokens/%s/non-fungibles/%s", userID, contractID, tokenType)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -128,13 +128,13 @@ func GetNonFungibleInfo(userID, contractID, tokenType string) ([]*NonFungibleInf
 
 }
 
-func GetBaseCoinBalance(userID string) (*BaseCoinBalance, error) {
-	if checkUrlParam(userID) {
-		return nil, errInvalidParam
+func GetBaseCoinBalance(ctx context.Context, userID string) (*BaseCoinBalance, error) {
+	if !checkUrlParam(userID) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/base-coin", userID)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -148,13 +148,13 @@ func GetBaseCoinBalance(userID string) (*BaseCoinBalance, error) {
 
 	return baseCoinBalance, nil
 }
-func GetTransaction(txHash string) (*Transaction, error) {
-	if checkUrlParam(txHash) {
-		return nil, errInvalidParam
+func GetTransaction(ctx context.Context, txHash string) (*Transaction, error) {
+	if !checkUrlParam(txHash) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/transactions/%s", txHash)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -168,40 +168,39 @@ func GetTransaction(txHash string) (*Transaction, error) {
 	return tx, nil
 }
 
-func GetTransactionHistory(userID, before, after, limit, page, orderBy, msgType string) ([]*Transaction, error) {
-	if checkUrlParam(userID) {
-		return nil, errInvalidParam
+func GetTransactionHistory(ctx context.Context, userID, before, after, limit, page, orderBy, msgType string) ([]*Transaction, error) {
+	if !checkUrlParam(userID) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/transactions", userID)
 
-	query := map[string]string{
-	}
+	query := url.Values{}
 
 	if before != "" {
-		query["before"] = before
+		query.Set("before", before)
 	}
 
 	if after != "" {
-		query["after"] = after
+		query.Set("after", after)
 	}
 
 	if limit != "" {
-		query["limit"] = limit
+		query.Set("limit", limit)
 	}
 
 	if page != "" {
-		query["page"] = page
+		query.Set("page", page)
 	}
 
 	if orderBy != "" {
-		query["orderBy"] = orderBy
+		query.Set("orderBy", orderBy)
 	}
 
 	if msgType != "" {
-		query["msgType"] = msgType
+		query.Set("msgType", msgType)
 	}
 
-	apiResult, err := api.CallAPI(path, "GET", query, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", query, nil)
 
 	if err != nil {
 		return nil, err
@@ -216,199 +215,204 @@ func GetTransactionHistory(userID, before, after, limit, page, orderBy, msgType
 	return txs, nil
 }
 
-func GetBaseCoinTransactionHistory(userID string) ([]*Transaction, error) {
-	result := make([]*Transaction, 0)
-	var (
-		txs []*Transaction
-		err error
-	)
-	for page := 1; ; page++ {
-		txs, err = GetTransactionHistory(userID, "", "", "", strconv.Itoa(page), "", "link/MsgSend")
-		if err != nil {
-			return result, err
-		}
+func GetBaseCoinTransactionHistory(ctx context.Context, userID string, query HistoryQuery) (*TransactionPage, error) {
+	query.MsgType = "link/MsgSend"
 
-		if txs == nil || len(txs) == 0 {
-			return result, nil
-		}
+	return readHistory(ctx, userID, query)
+}
 
-		for _, tx := range txs {
-			result = append(result, tx)
-			//TODO make limit dynamic
-			if len(result) == 5 {
-				return result, nil
-			}
-		}
-	}
+func GetServiceTokenTransactionHistory(ctx context.Context, userID, contractID string, query HistoryQuery) (*TransactionPage, error) {
+	query.MsgType = "token/MsgTransfer"
+	query.Filter = serviceTokenFilter(contractID, query.Filter)
+
+	return readHistory(ctx, userID, query)
 }
 
-func GetServiceTokenTransactionHistory(userID, contractID string) ([]*Transaction, error) {
-	result := make([]*Transaction, 0)
-	var (
-		txs []*Transaction
-		err error
-	)
-	for page := 1; ; page++ {
-		txs, err = GetTransactionHistory(userID, "", "", "", strconv.Itoa(page), "", "token/MsgTransfer")
-		if err != nil {
-			return result, err
-		}
+func GetFungibleTransactionHistory(ctx context.Context, userID, contractID, tokenType string, query HistoryQuery) (*TransactionPage, error) {
+	query.Filter = fungibleFilter(contractID, tokenType, query.Filter)
 
-		if txs == nil || len(txs) == 0 {
-			return result, nil
+	return readHistory(ctx, userID, query)
+}
+
+// serviceTokenFilter matches service token transfers of contractID which
+// also satisfy next, if any.
+func serviceTokenFilter(contractID string, next func(tx *Transaction) bool) func(tx *Transaction) bool {
+	return func(tx *Transaction) bool {
+		for _, msg := range tx.Tx.Value.Message {
+			val := TransferServiceTokenMsg{}
+			marshaled, _ := json.Marshal(msg.Value)
+			if err := json.Unmarshal(marshaled, &val); err == nil {
+				if val.ContractID == contractID {
+					return next == nil || next(tx)
+				}
+			}
 		}
+		return false
+	}
+}
 
-		for _, tx := range txs {
-			for _, msg := range tx.Tx.Value.Message {
-				val := TransferServiceTokenMsg{}
+// fungibleFilter matches mints, burns and transfers of a fungible token
+// type which also satisfy next, if any.
+func fungibleFilter(contractID, tokenType string, next func(tx *Transaction) bool) func(tx *Transaction) bool {
+	return func(tx *Transaction) bool {
+		for _, msg := range tx.Tx.Value.Message {
+			if msg.Type == "collection/MsgBurnFT" || msg.Type == "collection/MsgBurnFTFrom" || msg.Type == "collection/MsgMintFT" || msg.Type == "collection/MsgTransferFT" {
+				val := FungibleMsg{}
 				marshaled, _ := json.Marshal(msg.Value)
 				if err := json.Unmarshal(marshaled, &val); err == nil {
 					if val.ContractID == contractID {
-						result = append(result, tx)
-						//TODO make limit dynamic
-						if len(result) == 5 {
-							return result, nil
+						for _, amt := range val.Amount {
+							if strings.HasPrefix(amt.TokenID, tokenType) {
+								return next == nil || next(tx)
+							}
 						}
 					}
 				}
 			}
 		}
+		return false
 	}
 }
 
-func GetFungibleTransactionHistory(userID, contractID, tokenType string) ([]*Transaction, error) {
-	result := make([]*Transaction, 0)
-	var (
-		txs []*Transaction
-		err error
-	)
-	for page := 1; ; page++ {
-		txs, err = GetTransactionHistory(userID, "", "", "", strconv.Itoa(page), "", "")
-		if err != nil {
-			return result, err
-		}
-
-		if txs == nil || len(txs) == 0 {
-			return result, nil
-		}
-
-		for _, tx := range txs {
-			for _, msg := range tx.Tx.Value.Message {
-				if msg.Type == "collection/MsgBurnFT" || msg.Type == "collection/MsgBurnFTFrom" || msg.Type == "collection/MsgMintFT" || msg.Type == "collection/MsgTransferFT" {
-					val := FungibleMsg{}
-					marshaled, _ := json.Marshal(msg.Value)
-					if err := json.Unmarshal(marshaled, &val); err == nil {
-						if val.ContractID == contractID {
-							hasToken := false
-							for _, amt := range val.Amount {
-								if strings.HasPrefix(amt.TokenID, tokenType) {
-									hasToken = true
-									break
-								}
-							}
-							if hasToken {
-								result = append(result, tx)
-								//TODO make limit dynamic
-								if len(result) == 5 {
-									return result, nil
-								}
-							}
-						}
+// mintedTokenID returns the contract ID and token ID minted by tx.
+func mintedTokenID(tx *Transaction) (string, string) {
+	innerContractID := ""
+	innerTokenID := ""
+	for _, log := range tx.Logs {
+		for _, event := range log.Events {
+			if event.Type == "mint_nft" {
+				for _, attr := range event.Attributes {
+					if attr.Key == "contract_id" {
+						innerContractID = attr.Value
+					}
+					if attr.Key == "token_id" {
+						innerTokenID = attr.Value
 					}
 				}
 			}
 		}
 	}
+	return innerContractID, innerTokenID
 }
 
-//TODO store txhash with tokenID as a key in localDB
-func GetNonFungibleTransactionHistory(userID, contractID, tokenType, tokenIndex string) (*NonFungibleTxHistory, error) {
+// GetNonFungibleTransactionHistory returns the mint, payment and point
+// transactions of a ticket. They are looked up in the token index, falling
+// back to scanning the user's mints, which are indexed along the way.
+func GetNonFungibleTransactionHistory(ctx context.Context, userID, contractID, tokenType, tokenIndex string) (*NonFungibleTxHistory, error) {
 	result := &NonFungibleTxHistory{}
-	tokenID := contractID + tokenType + tokenIndex
-	var (
-		txs []*Transaction
-		err error
-	)
-	for page := 1; ; page++ {
-		txs, err = GetTransactionHistory(userID, "", "", "", strconv.Itoa(page), "", "collection/MsgMintNFT")
-		if err != nil {
+
+	entry, found, err := LookupTokenTransactions(ctx, contractID, tokenType+tokenIndex)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// scanning the mints indexes the token when it is found
+		result.MintTransaction, err = findMintTransaction(ctx, userID, contractID+tokenType+tokenIndex)
+		if err != nil || result.MintTransaction == nil {
 			return result, err
 		}
-
-		if txs == nil || len(txs) == 0 {
-			return result, nil
+		entry, found, err = LookupTokenTransactions(ctx, contractID, tokenType+tokenIndex)
+		if err != nil {
+			return nil, err
 		}
-
-		for _, tx := range txs {
-			innerContractID := ""
-			innerTokenID := ""
-			for _, log := range tx.Logs {
-				for _, event := range log.Events {
-					if event.Type == "mint_nft" {
-						for _, attr := range event.Attributes {
-							if attr.Key == "contract_id" {
-								innerContractID = attr.Value
-							}
-							if attr.Key == "token_id" {
-								innerTokenID = attr.Value
-							}
-						}
-					}
-				}
-			}
-			if tokenID == innerContractID+innerTokenID {
-				result.MintTransaction = tx
-				break
-			}
+		if !found {
+			// without a store there is no index to read the hashes from
+			entry = mintEntry(result.MintTransaction)
 		}
-		if result.MintTransaction != nil {
-			break
+	} else {
+		result.MintTransaction, err = GetTransaction(ctx, entry.MintTransaction)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	mintMsg := MintNonFungibleMsg{}
-	for _, msg := range result.MintTransaction.Tx.Value.Message {
-		marshaledMintMsg, err := json.Marshal(msg.Value)
+	if entry.PaymentTransaction != "" {
+		result.PaymentTransaction, err = GetTransaction(ctx, entry.PaymentTransaction)
 		if err != nil {
 			return nil, err
 		}
-		if err := json.Unmarshal(marshaledMintMsg, &mintMsg); err != nil {
+	}
+
+	if entry.PointTransaction != "" {
+		result.PointTransaction, err = GetTransaction(ctx, entry.PointTransaction)
+		if err != nil {
 			return nil, err
 		}
 	}
 
-	meta := NonFungibleMetadata{}
-	if err := json.Unmarshal([]byte(mintMsg.Meta), &meta); err != nil {
+	return result, nil
+
+}
+
+// findMintTransaction scans a user's mints for the one of tokenID, which is
+// prefixed by its contract ID. It returns nil when there is none.
+func findMintTransaction(ctx context.Context, userID, tokenID string) (*Transaction, error) {
+	it, err := IterateTransactionHistory(ctx, userID, HistoryQuery{
+		MsgType: "collection/MsgMintNFT",
+		Limit:   1,
+		Filter: func(tx *Transaction) bool {
+			_ = IndexTransaction(tx)
+			innerContractID, innerTokenID := mintedTokenID(tx)
+			return tokenID == innerContractID+innerTokenID
+		},
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	result.PaymentTransaction, err = GetTransaction(meta.PaymentInfo.PaymentTransaction)
-	if err != nil {
+	mintTx, found := it.Next()
+	if err := it.Err(); err != nil {
 		return nil, err
 	}
+	if !found {
+		return nil, nil
+	}
+	return mintTx, nil
+}
+
+func TransferBaseCoin(ctx context.Context, userID, amount string) (*TransactionAccepted, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(cfg.WalletAddress) {
+		return nil, ErrInvalidParam
+	}
+	path := fmt.Sprintf("/v1/wallets/%s/base-coin/transfer", cfg.WalletAddress)
+
+	params := map[string]interface{}{
+		"walletSecret": cfg.WalletSecret.Reveal(),
+		"toUserId":     userID,
+		"amount":       amount,
+	}
+
+	apiResult, err := api.CallAPI(ctx, path, "POST", nil, params)
 
-	result.PointTransaction, err = GetTransaction(meta.PaymentInfo.PointTransaction)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	txAccepted := &TransactionAccepted{}
+
+	if err := json.Unmarshal(apiResult, txAccepted); err != nil {
+		return nil, err
+	}
+
+	return txAccepted, nil
 
 }
 
-func TransferBaseCoin(userID, amount string) (*TransactionAccepted, error) {
-	if checkUrlParam(config.GetAPIConfig().WalletAddress) {
-		return nil, errInvalidParam
+func TransferServiceToken(ctx context.Context, userID, contractID, amount string) (*TransactionAccepted, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(cfg.WalletAddress, contractID) {
+		return nil, ErrInvalidParam
 	}
-	path := fmt.Sprintf("/v1/wallets/%s/base-coin/transfer", config.GetAPIConfig().WalletAddress)
+	path := fmt.Sprintf("/v1/wallets/%s/service-tokens/%s/transfer", cfg.WalletAddress, contractID)
 
 	params := map[string]interface{}{
-		"walletSecret": config.GetAPIConfig().WalletSecret,
+		"walletSecret": cfg.WalletSecret.Reveal(),
 		"toUserId":     userID,
 		"amount":       amount,
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", nil, params)
+	apiResult, err := api.CallAPI(ctx, path, "POST", nil, params)
 
 	if err != nil {
 		return nil, err
@@ -424,19 +428,21 @@ func TransferBaseCoin(userID, amount string) (*TransactionAccepted, error) {
 
 }
 
-func TransferServiceToken(userID, contractID, amount string) (*TransactionAccepted, error) {
-	if checkUrlParam(config.GetAPIConfig().WalletAddress, contractID) {
-		return nil, errInvalidParam
+func BurnServiceTokenFrom(ctx context.Context, userID, contractID, amount string) (*TransactionAccepted, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(contractID) {
+		return nil, ErrInvalidParam
 	}
-	path := fmt.Sprintf("/v1/wallets/%s/service-tokens/%s/transfer", config.GetAPIConfig().WalletAddress, contractID)
+	path := fmt.Sprintf("/v1/service-tokens/%s/burn-from", contractID)
 
 	params := map[string]interface{}{
-		"walletSecret": config.GetAPIConfig().WalletSecret,
-		"toUserId":     userID,
+		"ownerAddress": cfg.WalletAddress,
+		"ownerSecret":  cfg.WalletSecret.Reveal(),
+		"fromUserId":   userID,
 		"amount":       amount,
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", nil, params)
+	apiResult, err := api.CallAPI(ctx, path, "POST", nil, params)
 
 	if err != nil {
 		return nil, err
@@ -449,23 +455,23 @@ func TransferServiceToken(userID, contractID, amount string) (*TransactionAccept
 	}
 
 	return txAccepted, nil
-
 }
 
-func MintFungible(userID, contractID, tokenType, amount string) (*TransactionAccepted, error) {
-	if checkUrlParam(contractID, tokenType) {
-		return nil, errInvalidParam
+func MintFungible(ctx context.Context, userID, contractID, tokenType, amount string) (*TransactionAccepted, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(contractID, tokenType) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/item-tokens/%s/fungibles/%s/mint", contractID, tokenType)
 
 	params := map[string]interface{}{
 		"toUserId":     userID,
-		"ownerAddress": config.GetAPIConfig().WalletAddress,
-		"ownerSecret":  config.GetAPIConfig().WalletSecret,
+		"ownerAddress": cfg.WalletAddress,
+		"ownerSecret":  cfg.WalletSecret.Reveal(),
 		"amount":       amount,
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", nil, params)
+	apiResult, err := api.CallAPI(ctx, path, "POST", nil, params)
 	if err != nil {
 		return nil, err
 	}
@@ -480,9 +486,10 @@ func MintFungible(userID, contractID, tokenType, amount string) (*TransactionAcc
 
 }
 
-func MintNonFungible(userID, contractID, tokenType string, meta NonFungibleMetadata) (*TransactionAccepted, error) {
-	if checkUrlParam(contractID, tokenType) {
-		return nil, errInvalidParam
+func MintNonFungible(ctx context.Context, userID, contractID, tokenType string, meta NonFungibleMetadata) (*TransactionAccepted, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(contractID, tokenType) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/item-tokens/%s/non-fungibles/%s/mint", contractID, tokenType)
 
@@ -495,11 +502,46 @@ func MintNonFungible(userID, contractID, tokenType string, meta NonFungibleMetad
 		"toUserId":     userID,
 		"name":         "MovieTicket",
 		"meta":         string(marshaledMeta),
-		"ownerAddress": config.GetAPIConfig().WalletAddress,
-		"ownerSecret":  config.GetAPIConfig().WalletSecret,
+		"ownerAddress": cfg.WalletAddress,
+		"ownerSecret":  cfg.WalletSecret.Reveal(),
+	}
+
+	apiResult, err := api.CallAPI(ctx, path, "POST", nil, params)
+	if err != nil {
+		return nil, err
+	}
+
+	txAccepted := &TransactionAccepted{}
+
+	if err := json.Unmarshal(apiResult, txAccepted); err != nil {
+		return nil, err
+	}
+
+	trackTransaction(userID, txAccepted)
+	return txAccepted, nil
+}
+
+// UpdateNonFungible replaces the metadata of a non-fungible token.
+func UpdateNonFungible(ctx context.Context, userID, contractID, tokenType, tokenIndex string, meta NonFungibleMetadata) (*TransactionAccepted, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(contractID, tokenType, tokenIndex) {
+		return nil, ErrInvalidParam
+	}
+	path := fmt.Sprintf("/v1/item-tokens/%s/non-fungibles/%s/%s", contractID, tokenType, tokenIndex)
+
+	marshaledMeta, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{
+		"name":         "MovieTicket",
+		"meta":         string(marshaledMeta),
+		"ownerAddress": cfg.WalletAddress,
+		"ownerSecret":  cfg.WalletSecret.Reveal(),
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", nil, params)
+	apiResult, err := api.CallAPI(ctx, path, "PUT", nil, params)
 	if err != nil {
 		return nil, err
 	}
@@ -513,20 +555,21 @@ func MintNonFungible(userID, contractID, tokenType string, meta NonFungibleMetad
 	return txAccepted, nil
 }
 
-func BurnFungible(userID, contractID, tokenType, amount string) (*TransactionAccepted, error) {
-	if checkUrlParam(contractID, tokenType) {
-		return nil, errInvalidParam
+func BurnFungible(ctx context.Context, userID, contractID, tokenType, amount string) (*TransactionAccepted, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(contractID, tokenType) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/item-tokens/%s/fungibles/%s/burn", contractID, tokenType)
 
 	params := map[string]interface{}{
 		"amount":       amount,
 		"fromUserId":   userID,
-		"ownerAddress": config.GetAPIConfig().WalletAddress,
-		"ownerSecret":  config.GetAPIConfig().WalletSecret,
+		"ownerAddress": cfg.WalletAddress,
+		"ownerSecret":  cfg.WalletSecret.Reveal(),
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", nil, params)
+	apiResult, err := api.CallAPI(ctx, path, "POST", nil, params)
 
 	if err != nil {
 		return nil, err
@@ -541,23 +584,24 @@ func BurnFungible(userID, contractID, tokenType, amount string) (*TransactionAcc
 	return txAccepted, nil
 }
 
-func RequestBaseCoinTransfer(userID, amount string) (*TransferRequestResult, error) {
-	if checkUrlParam(userID) {
-		return nil, errInvalidParam
+func RequestBaseCoinTransfer(ctx context.Context, userID, amount string) (*TransferRequestResult, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(userID) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/base-coin/request-transfer/", userID)
 
-	query := map[string]string{
-		"requestType": "redirectUri",
+	query := url.Values{
+		"requestType": {"redirectUri"},
 	}
 
 	params := map[string]interface{}{
-		"toAddress": config.GetAPIConfig().WalletAddress,
+		"toAddress": cfg.WalletAddress,
 		"amount":    amount,
-		//"landingUri": fmt.Sprintf("%s/swagger/index.html", config.GetAPIConfig().Endpoint),
+		//"landingUri": fmt.Sprintf("%s/swagger/index.html", cfg.Endpoint),
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", query, params)
+	apiResult, err := api.CallAPI(ctx, path, "POST", query, params)
 
 	if err != nil {
 		return nil, err
@@ -571,23 +615,24 @@ func RequestBaseCoinTransfer(userID, amount string) (*TransferRequestResult, err
 	return txReqResult, nil
 }
 
-func RequestServiceTransfer(userID, contractID, amount string) (*TransferRequestResult, error) {
-	if checkUrlParam(userID, contractID) {
-		return nil, errInvalidParam
+func RequestServiceTransfer(ctx context.Context, userID, contractID, amount string) (*TransferRequestResult, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(userID, contractID) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/service-tokens/%s/request-transfer", userID, contractID)
 
-	query := map[string]string{
-		"requestType": "redirectUri",
+	query := url.Values{
+		"requestType": {"redirectUri"},
 	}
 
 	params := map[string]interface{}{
-		"toAddress": config.GetAPIConfig().WalletAddress,
+		"toAddress": cfg.WalletAddress,
 		"amount":    amount,
-		//"landingUri": fmt.Sprintf("%s/swagger/index.html", config.GetAPIConfig().Endpoint),
+		//"landingUri": fmt.Sprintf("%s/swagger/index.html", cfg.Endpoint),
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", query, params)
+	apiResult, err := api.CallAPI(ctx, path, "POST", query, params)
 
 	if err != nil {
 		return nil, err
@@ -601,22 +646,23 @@ func RequestServiceTransfer(userID, contractID, amount string) (*TransferRequest
 	return txReqResult, nil
 }
 
-func RequestProxy(userID, contractID string) (*TransferRequestResult, error) {
-	if checkUrlParam(userID, contractID) {
-		return nil, errInvalidParam
+func RequestProxy(ctx context.Context, userID, contractID string) (*TransferRequestResult, error) {
+	cfg := api.FromContext(ctx).Config()
+	if !checkUrlParam(userID, contractID) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/item-tokens/%s/request-proxy", userID, contractID)
 
-	query := map[string]string{
-		"requestType": "redirectUri",
+	query := url.Values{
+		"requestType": {"redirectUri"},
 	}
 
 	params := map[string]interface{}{
-		"ownerAddress": config.GetAPIConfig().WalletAddress,
-		//"landingUri":   fmt.Sprintf("%s/swagger/index.html", config.GetAPIConfig().Endpoint),
+		"ownerAddress": cfg.WalletAddress,
+		//"landingUri":   fmt.Sprintf("%s/swagger/index.html", cfg.Endpoint),
 	}
 
-	apiResult, err := api.CallAPI(path, "POST", query, params)
+	apiResult, err := api.CallAPI(ctx, path, "POST", query, params)
 
 	if err != nil {
 		return nil, err
@@ -630,13 +676,13 @@ func RequestProxy(userID, contractID string) (*TransferRequestResult, error) {
 	return txReqResult, nil
 }
 
-func GetProxyStatus(token string) ([]byte, error) {
-	if checkUrlParam(token) {
-		return nil, errInvalidParam
+func GetProxyStatus(ctx context.Context, token string) ([]byte, error) {
+	if !checkUrlParam(token) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/user-requests/%s", token)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -645,13 +691,13 @@ func GetProxyStatus(token string) ([]byte, error) {
 	return apiResult, nil
 }
 
-func GetProxySetting(userID, contractID string) (bool, error) {
-	if checkUrlParam(userID, contractID) {
-		return false, errInvalidParam
+func GetProxySetting(ctx context.Context, userID, contractID string) (bool, error) {
+	if !checkUrlParam(userID, contractID) {
+		return false, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/users/%s/item-tokens/%s/proxy", userID, contractID)
 
-	apiResult, err := api.CallAPI(path, "GET", nil, nil)
+	apiResult, err := api.CallAPI(ctx, path, "GET", nil, nil)
 
 	if err != nil {
 		return false, err
@@ -666,13 +712,15 @@ func GetProxySetting(userID, contractID string) (bool, error) {
 	return result["isApproved"], nil
 }
 
-func CommitTransferRequest(token string) (*TransactionAccepted, error) {
-	if checkUrlParam(token) {
-		return nil, errInvalidParam
+func CommitTransferRequest(ctx context.Context, token string) (*TransactionAccepted, error) {
+	if !checkUrlParam(token) {
+		return nil, ErrInvalidParam
 	}
 	path := fmt.Sprintf("/v1/user-requests/%s/commit", token)
 
-	apiResult, err := api.CallAPI(path, "POST", nil, nil)
+	// a session token can be committed only once, so resending is safe
+	ctx = api.WithIdempotent(ctx)
+	apiResult, err := api.CallAPI(ctx, path, "POST", nil, nil)
 	if err != nil {
 		return nil, err
 	}
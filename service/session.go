@@ -0,0 +1,229 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"link/cinema/api"
+	"link/cinema/store"
+	"time"
+)
+
+const (
+	DefaultSessionIdleTTL = 2 * time.Hour
+	DefaultSessionMaxAge  = 7 * 24 * time.Hour
+
+	// the last use of a session is saved at most this often, so not every
+	// request writes to the store
+	sessionTouchInterval = time.Minute
+
+	sessionsBucket = "sessions"
+)
+
+// Session is a browser session kept in the local store; the cookie only
+// carries its ID. A session expires when it is idle for longer than the idle
+// TTL, or when it is older than the max age, whichever comes first.
+type Session struct {
+	ID          string            `json:"-"`
+	UserID      string            `json:"userId,omitempty"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Values      map[string]string `json:"values,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	LastSeenAt  time.Time         `json:"lastSeenAt"`
+}
+
+func sessionTTLs(ctx context.Context) (time.Duration, time.Duration) {
+	cfg := api.FromContext(ctx).Config()
+	idle, maxAge := DefaultSessionIdleTTL, DefaultSessionMaxAge
+	if cfg.SessionIdleMinutes > 0 {
+		idle = time.Duration(cfg.SessionIdleMinutes) * time.Minute
+	}
+	if cfg.SessionMaxAgeHours > 0 {
+		maxAge = time.Duration(cfg.SessionMaxAgeHours) * time.Hour
+	}
+	return idle, maxAge
+}
+
+// ExpiresAt returns when the session expires unless it is used again.
+func (s *Session) ExpiresAt(ctx context.Context) time.Time {
+	idle, maxAge := sessionTTLs(ctx)
+	expiresAt := s.LastSeenAt.Add(idle)
+	if end := s.CreatedAt.Add(maxAge); end.Before(expiresAt) {
+		return end
+	}
+	return expiresAt
+}
+
+// EndsAt returns when the session expires however often it is used.
+func (s *Session) EndsAt(ctx context.Context) time.Time {
+	_, maxAge := sessionTTLs(ctx)
+	return s.CreatedAt.Add(maxAge)
+}
+
+// sessionKey is the store key of a session. The ID is hashed so the store
+// does not hold anything a cookie can be made from.
+func sessionKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSessionID() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// NewSession returns an anonymous session, saved once SaveSession is
+// called.
+func NewSession() (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Session{
+		ID:         id,
+		Values:     make(map[string]string),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}, nil
+}
+
+// GetSession returns the session with id, or nil when there is none or it
+// has expired. An expired session is deleted.
+func GetSession(ctx context.Context, id string) (*Session, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, ErrNoStore
+	}
+	session := &Session{}
+	found, err := db.Get(sessionsBucket, sessionKey(id), session)
+	if err != nil || !found {
+		return nil, err
+	}
+	if !time.Now().Before(session.ExpiresAt(ctx)) {
+		return nil, db.Delete(sessionsBucket, sessionKey(id))
+	}
+	session.ID = id
+	if session.Values == nil {
+		session.Values = make(map[string]string)
+	}
+	return session, nil
+}
+
+func SaveSession(session *Session) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Put(sessionsBucket, sessionKey(session.ID), session)
+}
+
+// TouchSession records that the session is in use, keeping it from idling
+// out.
+func TouchSession(session *Session) error {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+	session.LastSeenAt = now
+	return SaveSession(session)
+}
+
+// RotateSession moves the session to a new ID, so an ID known before a
+// login is of no use after it. The session is saved under the new ID.
+func RotateSession(session *Session) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *store.Tx) error {
+		if err := tx.Delete(sessionsBucket, sessionKey(session.ID)); err != nil {
+			return err
+		}
+		session.ID = id
+		return tx.Put(sessionsBucket, sessionKey(id), session)
+	})
+}
+
+func DeleteSession(id string) error {
+	db := GetStore()
+	if db == nil {
+		return ErrNoStore
+	}
+	return db.Delete(sessionsBucket, sessionKey(id))
+}
+
+// RevokeUserSessions logs userID out of every session and returns how many
+// there were.
+func RevokeUserSessions(userID string) (int, error) {
+	return deleteSessions(func(session *Session) bool {
+		return session.UserID == userID
+	})
+}
+
+// PruneSessions deletes the expired sessions nobody came back to, and
+// returns how many there were.
+func PruneSessions(ctx context.Context) (int, error) {
+	now := time.Now()
+	return deleteSessions(func(session *Session) bool {
+		return !now.Before(session.ExpiresAt(ctx))
+	})
+}
+
+func deleteSessions(match func(session *Session) bool) (int, error) {
+	db := GetStore()
+	if db == nil {
+		return 0, ErrNoStore
+	}
+	deleted := 0
+	err := db.Update(func(tx *store.Tx) error {
+		keys := make([]string, 0)
+		err := tx.ForEach(sessionsBucket, func(key string, value []byte) error {
+			session := &Session{}
+			if err := json.Unmarshal(value, session); err != nil {
+				return err
+			}
+			if match(session) {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// bolt buckets must not change while they are iterated
+		for _, key := range keys {
+			if err := tx.Delete(sessionsBucket, key); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	closeStore := newTestStore(t)
+	defer closeStore()
+	ctx := context.Background()
+
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.UserID = testUserID
+	if err := SaveSession(session); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := GetSession(ctx, session.ID)
+	if err != nil || saved == nil || saved.UserID != testUserID {
+		t.Fatal("Expected the session to be saved", saved, err)
+	}
+
+	oldID := session.ID
+	if err := RotateSession(session); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := GetSession(ctx, oldID); err != nil || saved != nil {
+		t.Error("Expected the old session ID to be dropped", saved, err)
+	}
+	if saved, err := GetSession(ctx, session.ID); err != nil || saved == nil || saved.UserID != testUserID {
+		t.Error("Expected the session under its new ID", saved, err)
+	}
+
+	// idle for too long
+	idle, _ := NewSession()
+	idle.LastSeenAt = time.Now().Add(-DefaultSessionIdleTTL)
+	// used a minute ago, but too old
+	old, _ := NewSession()
+	old.CreatedAt = time.Now().Add(-DefaultSessionMaxAge)
+	old.LastSeenAt = time.Now().Add(-time.Minute)
+	for _, expired := range []*Session{idle, old} {
+		if err := SaveSession(expired); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if saved, err := GetSession(ctx, old.ID); err != nil || saved != nil {
+		t.Error("Expected a session past its max age to expire", saved, err)
+	}
+	if pruned, err := PruneSessions(ctx); err != nil || pruned != 1 {
+		t.Error("Expected the idle session to be pruned", pruned, err)
+	}
+
+	if err := TouchSession(old); err != nil || !old.LastSeenAt.After(time.Now().Add(-time.Second)) {
+		t.Error("Expected a session unused for a minute to be touched", old.LastSeenAt, err)
+	}
+
+	other, _ := NewSession()
+	other.UserID = "other-user"
+	if err := SaveSession(other); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := RevokeUserSessions(testUserID); err != nil || revoked != 1 {
+		t.Error("Expected the session of the user to be revoked", revoked, err)
+	}
+	if saved, err := GetSession(ctx, session.ID); err != nil || saved != nil {
+		t.Error("Expected a revoked session to be gone", saved, err)
+	}
+	if saved, err := GetSession(ctx, other.ID); err != nil || saved == nil {
+		t.Error("Expected the session of another user to stay", saved, err)
+	}
+}
@@ -0,0 +1,368 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"link/cinema/store"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSyncInterval = time.Minute
+	DefaultSyncMaxAge   = 5 * time.Minute
+
+	SourceStore = "store"
+	SourceLBD   = "lbd"
+
+	syncUsersBucket     = "sync-users"
+	historyBucketPrefix = "history:"
+
+	// timestamps may be truncated to seconds, so each sync re-reads the
+	// second of the latest stored transaction
+	syncOverlap = time.Second
+)
+
+// SyncState is how far the history of a user has been copied to the local
+// store.
+type SyncState struct {
+	UserID            string    `json:"userId"`
+	SyncedAt          time.Time `json:"syncedAt"`
+	LatestTransaction time.Time `json:"latestTransaction"`
+	LastError         string    `json:"lastError,omitempty"`
+}
+
+// Freshness tells where a history page was read from and, for the local
+// store, when it was last synced with LBD.
+type Freshness struct {
+	Source   string     `json:"source"`
+	SyncedAt *time.Time `json:"syncedAt,omitempty"`
+}
+
+// TransactionRecord is a stored transaction with its messages decoded.
+type TransactionRecord struct {
+	Transaction           *Transaction               `json:"transaction"`
+	MsgTypes              []string                   `json:"msgTypes"`
+	BaseCoinTransfers     []*TransferBaseCoinMsg     `json:"baseCoinTransfers,omitempty"`
+	ServiceTokenTransfers []*TransferServiceTokenMsg `json:"serviceTokenTransfers,omitempty"`
+	Fungibles             []*FungibleMsg             `json:"fungibles,omitempty"`
+	NonFungibleMints      []*MintNonFungibleMsg      `json:"nonFungibleMints,omitempty"`
+}
+
+// NewTransactionRecord decodes the messages of tx by their types.
+func NewTransactionRecord(tx *Transaction) (*TransactionRecord, error) {
+	record := &TransactionRecord{
+		Transaction: tx,
+		MsgTypes:    make([]string, 0, len(tx.Tx.Value.Message)),
+	}
+	for _, msg := range tx.Tx.Value.Message {
+		record.MsgTypes = append(record.MsgTypes, msg.Type)
+
+		var target interface{}
+		switch msg.Type {
+		case "link/MsgSend":
+			val := &TransferBaseCoinMsg{}
+			record.BaseCoinTransfers = append(record.BaseCoinTransfers, val)
+			target = val
+		case "token/MsgTransfer":
+			val := &TransferServiceTokenMsg{}
+			record.ServiceTokenTransfers = append(record.ServiceTokenTransfers, val)
+			target = val
+		case "collection/MsgMintFT", "collection/MsgBurnFT", "collection/MsgBurnFTFrom", "collection/MsgTransferFT":
+			val := &FungibleMsg{}
+			record.Fungibles = append(record.Fungibles, val)
+			target = val
+		case "collection/MsgMintNFT":
+			val := &MintNonFungibleMsg{}
+			record.NonFungibleMints = append(record.NonFungibleMints, val)
+			target = val
+		default:
+			continue
+		}
+
+		marshaled, err := json.Marshal(msg.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(marshaled, target); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+func (r *TransactionRecord) hasMsgType(msgType string) bool {
+	for _, t := range r.MsgTypes {
+		if t == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterSyncUser adds a user to those the Syncer keeps in sync.
+func RegisterSyncUser(userID string) error {
+	db := GetStore()
+	if db == nil || !checkUrlParam(userID) {
+		return nil
+	}
+	return db.Update(func(tx *store.Tx) error {
+		state := &SyncState{}
+		found, err := tx.Get(syncUsersBucket, userID, state)
+		if err != nil || found {
+			return err
+		}
+		return tx.Put(syncUsersBucket, userID, &SyncState{UserID: userID})
+	})
+}
+
+// GetSyncState returns the sync state of a user, or nil when the user is
+// not synced.
+func GetSyncState(userID string) (*SyncState, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, nil
+	}
+	state := &SyncState{}
+	found, err := db.Get(syncUsersBucket, userID, state)
+	if err != nil || !found {
+		return nil, err
+	}
+	return state, nil
+}
+
+// SyncUserHistory copies the transactions of a user added since the last
+// sync to the local store and returns how many were read.
+func SyncUserHistory(ctx context.Context, userID string) (int, error) {
+	db := GetStore()
+	if db == nil {
+		return 0, nil
+	}
+	state := &SyncState{UserID: userID}
+	if _, err := db.Get(syncUsersBucket, userID, state); err != nil {
+		return 0, err
+	}
+
+	query := HistoryQuery{OrderBy: OrderAsc}
+	if !state.LatestTransaction.IsZero() {
+		query.After = state.LatestTransaction.Add(-syncOverlap)
+	}
+
+	count := 0
+	it, err := IterateTransactionHistory(ctx, userID, query)
+	if err != nil {
+		return 0, err
+	}
+	for tx, ok := it.Next(); ok; tx, ok = it.Next() {
+		if err := storeTransaction(userID, tx, state); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if err := it.Err(); err != nil {
+		state.LastError = err.Error()
+	} else {
+		state.LastError = ""
+		state.SyncedAt = time.Now()
+	}
+	if err := db.Put(syncUsersBucket, userID, state); err != nil {
+		return count, err
+	}
+	return count, it.Err()
+}
+
+func storeTransaction(userID string, tx *Transaction, state *SyncState) error {
+	timestamp, ok := transactionTime(tx)
+	if !ok {
+		return fmt.Errorf("invalid transaction timestamp: %s", tx.Timestamp)
+	}
+	record, err := NewTransactionRecord(tx)
+	if err != nil {
+		return err
+	}
+	if err := GetStore().Put(historyBucketPrefix+userID, historyKey(timestamp, tx.TxHash), record); err != nil {
+		return err
+	}
+	if timestamp.After(state.LatestTransaction) {
+		state.LatestTransaction = timestamp
+	}
+	return IndexTransaction(tx)
+}
+
+// historyKey orders stored transactions by time.
+func historyKey(timestamp time.Time, txHash string) string {
+	return fmt.Sprintf("%020d-%s", toMillis(timestamp), txHash)
+}
+
+func historyKeyTime(key string) time.Time {
+	millis, _ := strconv.ParseInt(strings.SplitN(key, "-", 2)[0], 10, 64)
+	return fromMillis(millis)
+}
+
+// SyncAllUsers syncs every registered user, carrying on past failures,
+// and returns the first error.
+func SyncAllUsers(ctx context.Context) error {
+	db := GetStore()
+	if db == nil {
+		return nil
+	}
+	userIDs := make([]string, 0)
+	err := db.ForEach(syncUsersBucket, func(key string, value []byte) error {
+		userIDs = append(userIDs, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, userID := range userIDs {
+		if _, err := SyncUserHistory(ctx, userID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Syncer keeps the local history of registered users in sync with LBD.
+type Syncer struct {
+	interval time.Duration
+}
+
+func NewSyncer(interval time.Duration) *Syncer {
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+	return &Syncer{interval: interval}
+}
+
+// Run syncs all users right away and then every interval until ctx is
+// done.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := SyncAllUsers(ctx); err != nil {
+			log.Println("history sync failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// storedHistory reads a page of a user's history from the local store. It
+// returns nil when the user has not been synced within DefaultSyncMaxAge,
+// unless the cursor was issued by the store.
+func storedHistory(userID string, query HistoryQuery) (*TransactionPage, error) {
+	start := ""
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Key == "" {
+			return nil, nil
+		}
+		start = cursor.Key
+	}
+
+	state, err := GetSyncState(userID)
+	if err != nil || state == nil || state.SyncedAt.IsZero() {
+		return nil, err
+	}
+	if start == "" && time.Since(state.SyncedAt) > DefaultSyncMaxAge {
+		return nil, nil
+	}
+
+	reverse := query.OrderBy != OrderAsc
+	if start == "" {
+		if reverse && !query.Before.IsZero() {
+			start = fmt.Sprintf("%020d", toMillis(query.Before))
+		}
+		if !reverse && !query.After.IsZero() {
+			start = fmt.Sprintf("%020d", toMillis(query.After)+1)
+		}
+	} else if !reverse {
+		start += "\x00"
+	}
+
+	result := &TransactionPage{
+		Transactions: make([]*Transaction, 0),
+	}
+	syncedAt := state.SyncedAt
+	result.Freshness = &Freshness{Source: SourceStore, SyncedAt: &syncedAt}
+
+	err = GetStore().Scan(historyBucketPrefix+userID, start, reverse, func(key string, value []byte) (bool, error) {
+		timestamp := historyKeyTime(key)
+		if reverse && !query.After.IsZero() && !timestamp.After(query.After) {
+			return false, nil
+		}
+		if !reverse && !query.Before.IsZero() && !timestamp.Before(query.Before) {
+			return false, nil
+		}
+		if query.Limit > 0 && len(result.Transactions) >= query.Limit {
+			result.NextCursor = (&historyCursor{Page: 1, PageSize: 1, Key: start}).encode()
+			return false, nil
+		}
+
+		record := &TransactionRecord{}
+		if err := json.Unmarshal(value, record); err != nil {
+			return false, err
+		}
+		start = key
+		if query.MsgType != "" && !record.hasMsgType(query.MsgType) {
+			return true, nil
+		}
+		if query.Filter != nil && !query.Filter(record.Transaction) {
+			return true, nil
+		}
+		result.Transactions = append(result.Transactions, record.Transaction)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readHistory reads a page of a user's history from the local store when
+// it is fresh, and from LBD otherwise.
+func readHistory(ctx context.Context, userID string, query HistoryQuery) (*TransactionPage, error) {
+	page, err := storedHistory(userID, query)
+	if err != nil || page != nil {
+		return page, err
+	}
+
+	it, err := IterateTransactionHistory(ctx, userID, query)
+	if err != nil {
+		return nil, err
+	}
+	page, err = it.Collect()
+	if err != nil {
+		return nil, err
+	}
+	page.Freshness = &Freshness{Source: SourceLBD}
+	return page, nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestSyncUserHistory(t *testing.T) {
+	ctx, _, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	for i := 0; i < 3; i++ {
+		if _, err := TransferBaseCoin(ctx, testUserID, "100"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := TransferServiceToken(ctx, testUserID, testConfig.ServiceContractID, "100"); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := GetBaseCoinTransactionHistory(ctx, testUserID, HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Freshness == nil || page.Freshness.Source != SourceLBD {
+		t.Error("Expected history from LBD before the first sync", page.Freshness)
+	}
+
+	if n, err := SyncUserHistory(ctx, testUserID); err != nil || n != 4 {
+		t.Fatal("Unexpected sync", n, err)
+	}
+	if _, err := TransferBaseCoin(ctx, testUserID, "100"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SyncUserHistory(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = GetBaseCoinTransactionHistory(ctx, testUserID, HistoryQuery{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Freshness == nil || page.Freshness.Source != SourceStore || page.Freshness.SyncedAt == nil {
+		t.Fatal("Expected history from the store", page.Freshness)
+	}
+	if len(page.Transactions) != 3 || page.NextCursor == "" {
+		t.Fatal("Unexpected first page", len(page.Transactions), page.NextCursor)
+	}
+
+	seen := make(map[string]bool)
+	for _, tx := range page.Transactions {
+		seen[tx.TxHash] = true
+	}
+	page, err = GetBaseCoinTransactionHistory(ctx, testUserID, HistoryQuery{Limit: 3, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Transactions) != 1 || page.NextCursor != "" || seen[page.Transactions[0].TxHash] {
+		t.Error("Unexpected second page", page.Transactions, page.NextCursor)
+	}
+
+	state, err := GetSyncState(testUserID)
+	if err != nil || state == nil || state.LatestTransaction.IsZero() {
+		t.Error("Unexpected sync state", state, err)
+	}
+}
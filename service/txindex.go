@@ -0,0 +1,283 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"link/cinema/api"
+	"link/cinema/store"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	tokenIndexBucket   = "token-index"
+	pendingTxBucket    = "pending-transactions"
+	maxTransferHistory = 20
+
+	// pendingTxTTL is how long LBD may not know a tracked transaction
+	// before it is dropped.
+	pendingTxTTL = 10 * time.Minute
+	// maxPendingResolves caps the transactions looked up in LBD by a
+	// single token lookup.
+	maxPendingResolves = 10
+)
+
+var (
+	storeMu    sync.RWMutex
+	localStore *store.DB
+)
+
+// GetStore returns the local store, or nil when the service runs without
+// one.
+func GetStore() *store.DB {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return localStore
+}
+
+func SetStore(db *store.DB) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	localStore = db
+}
+
+// TokenTransactions are the transactions of a non-fungible token, indexed
+// by contract ID and token ID.
+type TokenTransactions struct {
+	ContractID           string   `json:"contractId"`
+	TokenID              string   `json:"tokenId"`
+	Owner                string   `json:"owner"`
+	MintTransaction      string   `json:"mintTransaction"`
+	PaymentTransaction   string   `json:"paymentTransaction,omitempty"`
+	PointTransaction     string   `json:"pointTransaction,omitempty"`
+	TransferTransactions []string `json:"transferTransactions,omitempty"`
+	BurnTransaction      string   `json:"burnTransaction,omitempty"`
+}
+
+type pendingTransaction struct {
+	TxHash    string    `json:"txHash"`
+	UserID    string    `json:"userId"`
+	TrackedAt time.Time `json:"trackedAt"`
+}
+
+// trackTransaction remembers a non-fungible mint, transfer or burn sent by
+// the service, to be indexed once LBD has it.
+func trackTransaction(userID string, accepted *TransactionAccepted) {
+	db := GetStore()
+	if db == nil || accepted.TxHash == "" {
+		return
+	}
+	_ = db.Put(pendingTxBucket, accepted.TxHash, pendingTransaction{
+		TxHash:    accepted.TxHash,
+		UserID:    userID,
+		TrackedAt: time.Now(),
+	})
+	_ = RegisterSyncUser(userID)
+}
+
+// IndexTransaction records the non-fungible mints, transfers and burns of
+// tx in the token index.
+func IndexTransaction(tx *Transaction) error {
+	db := GetStore()
+	if db == nil {
+		return nil
+	}
+	return db.Update(func(stx *store.Tx) error {
+		for _, log := range tx.Logs {
+			for _, event := range log.Events {
+				if err := indexEvent(stx, tx, event); err != nil {
+					return err
+				}
+			}
+		}
+		return stx.Delete(pendingTxBucket, tx.TxHash)
+	})
+}
+
+func indexEvent(stx *store.Tx, tx *Transaction, event Event) error {
+	attrs := make(map[string]string)
+	for _, attr := range event.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	key := attrs["contract_id"] + attrs["token_id"]
+
+	switch event.Type {
+	case "mint_nft":
+		entry := mintEntry(tx)
+		entry.ContractID = attrs["contract_id"]
+		entry.TokenID = attrs["token_id"]
+		entry.Owner = attrs["to"]
+		return stx.Put(tokenIndexBucket, key, entry)
+	case "transfer_nft", "burn_nft":
+		entry := &TokenTransactions{}
+		found, err := stx.Get(tokenIndexBucket, key, entry)
+		if err != nil || !found {
+			return err
+		}
+		if event.Type == "burn_nft" {
+			entry.BurnTransaction = tx.TxHash
+		} else {
+			entry.Owner = attrs["to"]
+			entry.TransferTransactions = appendTransfer(entry.TransferTransactions, tx.TxHash)
+		}
+		return stx.Put(tokenIndexBucket, key, entry)
+	}
+	return nil
+}
+
+func appendTransfer(hashes []string, txHash string) []string {
+	for _, hash := range hashes {
+		if hash == txHash {
+			return hashes
+		}
+	}
+	hashes = append(hashes, txHash)
+	if len(hashes) > maxTransferHistory {
+		hashes = hashes[len(hashes)-maxTransferHistory:]
+	}
+	return hashes
+}
+
+// LookupTokenTransactions returns the indexed transactions of a token.
+// Transactions sent by the service but not yet indexed are looked up
+// first, so a freshly minted token is found without a backfill.
+func LookupTokenTransactions(ctx context.Context, contractID, tokenID string) (*TokenTransactions, bool, error) {
+	db := GetStore()
+	if db == nil {
+		return nil, false, nil
+	}
+
+	entry := &TokenTransactions{}
+	found, err := db.Get(tokenIndexBucket, contractID+tokenID, entry)
+	if err != nil || found {
+		return entry, found, err
+	}
+
+	if err := resolvePendingTransactions(ctx); err != nil {
+		return nil, false, err
+	}
+	found, err = db.Get(tokenIndexBucket, contractID+tokenID, entry)
+	return entry, found, err
+}
+
+// resolvePendingTransactions indexes the oldest tracked transactions LBD
+// has committed, at most maxPendingResolves of them. Those LBD still does
+// not know after pendingTxTTL are dropped; the rest stay pending.
+func resolvePendingTransactions(ctx context.Context) error {
+	db := GetStore()
+	pending := make([]pendingTransaction, 0)
+	err := db.ForEach(pendingTxBucket, func(key string, value []byte) error {
+		entry := pendingTransaction{}
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return err
+		}
+		pending = append(pending, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].TrackedAt.Before(pending[j].TrackedAt)
+	})
+	if len(pending) > maxPendingResolves {
+		pending = pending[:maxPendingResolves]
+	}
+
+	for _, entry := range pending {
+		tx, err := GetTransaction(ctx, entry.TxHash)
+		if errors.Is(err, api.ErrNotFound) {
+			if time.Since(entry.TrackedAt) > pendingTxTTL {
+				if err := db.Delete(pendingTxBucket, entry.TxHash); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := IndexTransaction(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillTokenIndex indexes every non-fungible mint in a user's history
+// and returns the number of mints found.
+func BackfillTokenIndex(ctx context.Context, userID string) (int, error) {
+	if GetStore() == nil {
+		return 0, nil
+	}
+
+	count := 0
+	query := HistoryQuery{MsgType: "collection/MsgMintNFT"}
+	for {
+		it, err := IterateTransactionHistory(ctx, userID, query)
+		if err != nil {
+			return count, err
+		}
+		for tx, ok := it.Next(); ok; tx, ok = it.Next() {
+			if err := IndexTransaction(tx); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := it.Err(); err != nil {
+			return count, err
+		}
+		if it.Exhausted() {
+			return count, nil
+		}
+		query.Cursor = it.Cursor()
+	}
+}
+
+// mintEntry returns the transactions of the token minted by tx, with the
+// payment and point transactions its metadata names.
+func mintEntry(tx *Transaction) *TokenTransactions {
+	entry := &TokenTransactions{MintTransaction: tx.TxHash}
+	if meta, err := mintMetadata(tx); err == nil {
+		entry.PaymentTransaction = meta.PaymentInfo.PaymentTransaction
+		entry.PointTransaction = meta.PaymentInfo.PointTransaction
+	}
+	return entry
+}
+
+// mintMetadata decodes the ticket metadata of a non-fungible mint.
+func mintMetadata(tx *Transaction) (*NonFungibleMetadata, error) {
+	mintMsg := MintNonFungibleMsg{}
+	for _, msg := range tx.Tx.Value.Message {
+		marshaledMintMsg, err := json.Marshal(msg.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(marshaledMintMsg, &mintMsg); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := &NonFungibleMetadata{}
+	if err := json.Unmarshal([]byte(mintMsg.Meta), meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
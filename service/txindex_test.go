@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"link/cinema/store"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) func() {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetStore(db)
+	return func() {
+		SetStore(nil)
+		db.Close()
+	}
+}
+
+func TestTokenIndex(t *testing.T) {
+	ctx, _, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer func() { closeStore() }()
+
+	pointTx, err := TransferServiceToken(ctx, testUserID, testConfig.ServiceContractID, "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paymentTx, err := TransferBaseCoin(ctx, testUserID, "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := NonFungibleMetadata{
+		MovieInfo:  DefaultMovie,
+		TicketInfo: DefaultTicket,
+		PaymentInfo: PaymentInfo{
+			PaymentDate:        time.Now(),
+			PaymentTransaction: paymentTx.TxHash,
+			PointTransaction:   pointTx.TxHash,
+		},
+	}
+	mintTx, err := MintNonFungible(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tickets, err := GetNonFungibleInfo(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType)
+	if err != nil || len(tickets) != 1 {
+		t.Fatal("Unexpected tickets", tickets, err)
+	}
+	tokenID := testConfig.NonFungibleTokenType + tickets[0].TokenIndex
+
+	entry, found, err := LookupTokenTransactions(ctx, testConfig.ItemContractID, tokenID)
+	if err != nil || !found {
+		t.Fatal("Expected the minted token to be indexed", err)
+	}
+	if entry.MintTransaction != mintTx.TxHash || entry.PaymentTransaction != paymentTx.TxHash || entry.PointTransaction != pointTx.TxHash {
+		t.Error("Unexpected index entry", entry)
+	}
+
+	entry.PointTransaction = ""
+	if err := GetStore().Put(tokenIndexBucket, testConfig.ItemContractID+tokenID, entry); err != nil {
+		t.Fatal(err)
+	}
+	history, err := GetNonFungibleTransactionHistory(ctx, testUserID, testConfig.ItemContractID, testConfig.NonFungibleTokenType, tickets[0].TokenIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.MintTransaction.TxHash != mintTx.TxHash || history.PaymentTransaction.TxHash != paymentTx.TxHash {
+		t.Error("Unexpected history", history)
+	}
+	if history.PointTransaction != nil {
+		t.Error("Expected the history to follow the index", history.PointTransaction)
+	}
+
+	closeStore()
+	closeStore = newTestStore(t)
+	if _, found, _ := LookupTokenTransactions(ctx, testConfig.ItemContractID, tokenID); found {
+		t.Error("Expected an empty index")
+	}
+	count, err := BackfillTokenIndex(ctx, testUserID)
+	if err != nil || count != 1 {
+		t.Error("Unexpected backfill", count, err)
+	}
+	entry, found, err = LookupTokenTransactions(ctx, testConfig.ItemContractID, tokenID)
+	if err != nil || !found || entry.MintTransaction != mintTx.TxHash {
+		t.Error("Expected the backfilled token to be indexed", entry, err)
+	}
+}
+
+func countPending(t *testing.T) int {
+	count := 0
+	err := GetStore().ForEach(pendingTxBucket, func(key string, value []byte) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestPendingTransactions(t *testing.T) {
+	ctx, _, closeServer := newFakeLBD(t)
+	defer closeServer()
+	closeStore := newTestStore(t)
+	defer closeStore()
+
+	if _, err := TransferBaseCoin(ctx, testUserID, "100"); err != nil {
+		t.Fatal(err)
+	}
+	if count := countPending(t); count != 0 {
+		t.Fatal("Expected only non-fungible transactions to be tracked", count)
+	}
+
+	fresh := pendingTransaction{TxHash: "FRESH", TrackedAt: time.Now()}
+	if err := GetStore().Put(pendingTxBucket, fresh.TxHash, fresh); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxPendingResolves; i++ {
+		stale := pendingTransaction{
+			TxHash:    fmt.Sprintf("STALE%02d", i),
+			TrackedAt: time.Now().Add(-pendingTxTTL - time.Duration(maxPendingResolves-i)*time.Second),
+		}
+		if err := GetStore().Put(pendingTxBucket, stale.TxHash, stale); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := resolvePendingTransactions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	found, err := GetStore().Get(pendingTxBucket, fresh.TxHash, &pendingTransaction{})
+	if err != nil || !found || countPending(t) != 1 {
+		t.Error("Expected the stale transactions to be dropped", countPending(t), err)
+	}
+
+	for i := 0; i <= maxPendingResolves; i++ {
+		stale := pendingTransaction{TxHash: fmt.Sprintf("STALE%02d", i)}
+		if err := GetStore().Put(pendingTxBucket, stale.TxHash, stale); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := resolvePendingTransactions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count := countPending(t); count != 2 {
+		t.Error("Expected at most maxPendingResolves transactions to be resolved", count)
+	}
+}
@@ -47,10 +47,11 @@ type MovieInfo struct {
 }
 
 type TicketInfo struct {
-	Date    time.Time `json:"date"`
-	Theater string    `json:"theater"`
-	Sit     string    `json:"sit"`
-	Price   int       `json:"price"`
+	ShowtimeID string    `json:"showtimeId,omitempty"`
+	Date       time.Time `json:"date"`
+	Theater    string    `json:"theater"`
+	Sit        string    `json:"sit"`
+	Price      int       `json:"price"`
 }
 
 type PaymentInfo struct {
@@ -68,13 +69,14 @@ type PriceInfo struct {
 }
 
 type PurchaseInfo struct {
-	MovieInfo  MovieInfo  `json:"movieInfo"`
-	TicketInfo TicketInfo `json:"ticketInfo"`
-	PriceInfo  PriceInfo  `json:"priceInfo"`
+	MovieInfo  MovieInfo    `json:"movieInfo"`
+	TicketInfo TicketInfo   `json:"ticketInfo"`
+	PriceInfo  PriceInfo    `json:"priceInfo"`
+	Tickets    []CartTicket `json:"tickets,omitempty"`
 }
 
 type UserInfo struct {
-	userID        string `json:"userId"`
+	UserID        string `json:"userId"`
 	WalletAddress string `json:"walletAddress"`
 }
 
@@ -215,6 +217,7 @@ type NonFungibleMetadata struct {
 	MovieInfo   MovieInfo   `json:"movieInfo"`
 	TicketInfo  TicketInfo  `json:"ticketInfo"`
 	PaymentInfo PaymentInfo `json:"paymentInfo"`
+	CheckedInAt *time.Time  `json:"checkedInAt,omitempty"`
 }
 
 type TransactionAccepted struct {
@@ -0,0 +1,192 @@
+/*
+Copyright 2020 LINE Corporation
+
+LINE Corporation licenses this file to you under the Apache License,
+version 2.0 (the "License"); you may not use this file except in compliance
+with the License. You may obtain a copy of the License at:
+
+  https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License
+*/
+// Package store keeps the service's local records in an embedded BoltDB
+// file, with values encoded as JSON.
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	openTimeout = 5 * time.Second
+)
+
+type DB struct {
+	bolt *bolt.DB
+}
+
+// Tx is a read or read-write transaction on a DB.
+type Tx struct {
+	bolt *bolt.Tx
+}
+
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &DB{bolt: db}, nil
+}
+
+func (db *DB) Close() error {
+	return db.bolt.Close()
+}
+
+// Update runs fn in a read-write transaction, committed if fn returns nil.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		return fn(&Tx{bolt: tx})
+	})
+}
+
+// View runs fn in a read-only transaction.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	return db.bolt.View(func(tx *bolt.Tx) error {
+		return fn(&Tx{bolt: tx})
+	})
+}
+
+func (db *DB) Put(bucket, key string, value interface{}) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Put(bucket, key, value)
+	})
+}
+
+// Get decodes the value of key into value and reports whether it exists.
+func (db *DB) Get(bucket, key string, value interface{}) (bool, error) {
+	found := false
+	err := db.View(func(tx *Tx) error {
+		var err error
+		found, err = tx.Get(bucket, key, value)
+		return err
+	})
+	return found, err
+}
+
+func (db *DB) Delete(bucket, key string) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Delete(bucket, key)
+	})
+}
+
+// ForEach calls fn for every key of bucket in key order.
+func (db *DB) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	return db.View(func(tx *Tx) error {
+		return tx.ForEach(bucket, fn)
+	})
+}
+
+func (db *DB) Scan(bucket, start string, reverse bool, fn func(key string, value []byte) (bool, error)) error {
+	return db.View(func(tx *Tx) error {
+		return tx.Scan(bucket, start, reverse, fn)
+	})
+}
+
+func (tx *Tx) Put(bucket, key string, value interface{}) error {
+	b, err := tx.bolt.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+func (tx *Tx) Get(bucket, key string, value interface{}) (bool, error) {
+	b := tx.bolt.Bucket([]byte(bucket))
+	if b == nil {
+		return false, nil
+	}
+	data := b.Get([]byte(key))
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+func (tx *Tx) Delete(bucket, key string) error {
+	b := tx.bolt.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(key))
+}
+
+// DeleteBucket removes a bucket with all its keys.
+func (tx *Tx) DeleteBucket(bucket string) error {
+	err := tx.bolt.DeleteBucket([]byte(bucket))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
+
+func (tx *Tx) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	b := tx.bolt.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(k, v []byte) error {
+		return fn(string(k), v)
+	})
+}
+
+// Scan calls fn for the keys of bucket from start upwards, or for the keys
+// below start when reverse is set, until fn returns false. An empty start
+// scans the whole bucket.
+func (tx *Tx) Scan(bucket, start string, reverse bool, fn func(key string, value []byte) (bool, error)) error {
+	b := tx.bolt.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	c := b.Cursor()
+	var k, v []byte
+	switch {
+	case start == "" && reverse:
+		k, v = c.Last()
+	case start == "":
+		k, v = c.First()
+	case reverse:
+		k, v = c.Seek([]byte(start))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+	default:
+		k, v = c.Seek([]byte(start))
+	}
+
+	for k != nil {
+		more, err := fn(string(k), v)
+		if err != nil || !more {
+			return err
+		}
+		if reverse {
+			k, v = c.Prev()
+		} else {
+			k, v = c.Next()
+		}
+	}
+	return nil
+}